@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// deletedAccountID is the placeholder account, created by a migration, that keeps the
+// tombstones of deleted accounts' chirps that others still reply to, rechirp or quote.
+var deletedAccountID = uuid.Nil
+
+// handleDeleteAccount serves DELETE /api/users/me. Without a grace period the account goes
+// at once; with one the user is logged out everywhere and can log in again to keep it.
+func (cfg *apiConfig) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// Deleting an account is permanent, so the password is asked for again
+	currentUser, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not delete account")
+		return
+	}
+	user, err := cfg.DB.AuthUser(r.Context(), currentUser.Email)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not delete account")
+		return
+	}
+	err = authy.CheckPasswordHash(req.Password, user.HashedPassword)
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect password")
+		return
+	} else if err != nil {
+		log.Printf("Unexpected error during password hash check: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not verify password")
+		return
+	}
+
+	if cfg.DeletionGrace == 0 {
+		if err := cfg.deleteAccount(r.Context(), userID); err != nil {
+			log.Printf("Error deleting account: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not delete account")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	deleteAfter := time.Now().UTC().Add(cfg.DeletionGrace)
+	tx, err := cfg.DB.BeginTx(r.Context())
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not delete account")
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.ScheduleAccountDeletion(r.Context(), database.ScheduleAccountDeletionParams{
+		DeleteAfter: deleteAfter,
+		ID:          userID,
+	})
+	if err == nil {
+		_, err = tx.RevokeAllUserSessions(r.Context(), userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error scheduling account deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not delete account")
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, struct {
+		DeleteAfter time.Time `json:"delete_after"`
+	}{
+		DeleteAfter: deleteAfter,
+	})
+}
+
+// deleteAccount removes a user and everything they own in one transaction. Chirps that other
+// users still reply to, rechirp or quote stay behind as tombstones of the placeholder account.
+func (cfg *apiConfig) deleteAccount(ctx context.Context, userID uuid.UUID) error {
+	tx, err := cfg.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for moved := int64(1); moved > 0 && err == nil; {
+		moved, err = tx.AnonymizeReferencedChirps(ctx, database.AnonymizeReferencedChirpsParams{
+			PlaceholderID: deletedAccountID,
+			UserID:        userID,
+		})
+	}
+	if err == nil {
+		err = tx.DeleteUserChirps(ctx, userID)
+	}
+	if err == nil {
+		err = tx.DeleteUserRefreshTokens(ctx, userID)
+	}
+	if err == nil {
+		// Follows, likes, sessions and the rest go with the user
+		_, err = tx.DeleteUser(ctx, userID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sweep removes accounts whose grace period has ended and export archives that have expired,
+// and fails exports whose build was cut off, every SweepInterval.
+func (cfg *apiConfig) sweep() {
+	ticker := time.NewTicker(config.SweepInterval * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		if err := cfg.DB.DeleteExpiredDataExports(ctx, time.Now().UTC()); err != nil {
+			log.Printf("Error deleting expired data exports: %s", err)
+		}
+		if err := cfg.DB.FailStaleDataExports(ctx, staleExportCutoff()); err != nil {
+			log.Printf("Error failing stale data exports: %s", err)
+		}
+
+		due, err := cfg.DB.ListAccountsDueForDeletion(ctx, time.Now().UTC())
+		if err != nil {
+			log.Printf("Error listing accounts due for deletion: %s", err)
+			continue
+		}
+		for _, userID := range due {
+			if err := cfg.deleteAccount(ctx, userID); err != nil {
+				log.Printf("Error deleting account %s: %s", userID, err)
+			}
+		}
+	}
+}
@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"database/sql"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
@@ -45,3 +52,214 @@ func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Write([]byte("All chirps, refresh tokens, and users deleted. Hits counter reset to 0"))
 }
+
+// AdminUser is a user as administrators see them, with their roles and suspension.
+type AdminUser struct {
+	User
+	Roles       []string   `json:"roles"`
+	SuspendedAt *time.Time `json:"suspended_at"`
+}
+
+func adminUserFromDB(user database.ListUsersRow) AdminUser {
+	responseUser := AdminUser{
+		User: User{
+			ID:            user.ID,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+			Email:         user.Email,
+			IsChirpyRed:   user.IsChirpyRed,
+			Username:      user.Username,
+			EmailVerified: user.EmailVerified,
+		},
+		Roles: user.Roles,
+	}
+	if responseUser.Roles == nil {
+		responseUser.Roles = []string{}
+	}
+	if user.SuspendedAt.Valid {
+		responseUser.SuspendedAt = &user.SuspendedAt.Time
+	}
+	return responseUser
+}
+
+// middlewareRequireRole only lets through requests from users who hold one of the roles.
+// Roles and suspensions are read from the database rather than the access token, so taking
+// a role away or suspending its holder applies at once. Personal access tokens are always
+// turned away.
+func (cfg *apiConfig) middlewareRequireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bearer, err := authy.GetBearerToken(r.Header)
+		if err != nil {
+			log.Printf("Issue parsing bearer token: %s", err)
+			respondWithError(w, http.StatusUnauthorized, "Invalid bearer token")
+			return
+		}
+		if authy.IsPersonalAccessToken(bearer) {
+			respondWithError(w, http.StatusForbidden, "Personal access tokens cannot be used here")
+			return
+		}
+
+		userID, err := cfg.Keys.ValidateJWT(bearer)
+		if err != nil {
+			log.Printf("Issue authenticating bearer: %s", err)
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired access token")
+			return
+		}
+
+		user, err := cfg.DB.GetUser(r.Context(), userID)
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired access token")
+			return
+		} else if err != nil {
+			log.Printf("Error retrieving user: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		if user.SuspendedAt.Valid {
+			respondWithError(w, http.StatusForbidden, "This account has been suspended")
+			return
+		}
+		if !slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(user.Roles, role) }) {
+			log.Printf("User %s attempted to access %s without a required role", userID, r.URL.Path)
+			respondWithError(w, http.StatusForbidden, "You are not allowed to do this")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handlerAdminUsers lists every user, oldest account first.
+func (cfg *apiConfig) handlerAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	users, err := cfg.DB.ListUsers(r.Context(), database.ListUsersParams{
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving users: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve users")
+		return
+	}
+
+	if len(users) > page.Limit {
+		users = users[:page.Limit]
+		last := users[len(users)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, page.Limit)
+	}
+
+	responseUsers := make([]AdminUser, len(users))
+	for i, user := range users {
+		responseUsers[i] = adminUserFromDB(user)
+	}
+
+	respondWithJSON(w, http.StatusOK, responseUsers)
+}
+
+// handlerAdminUserByID serves POST /admin/users/{id}/suspend and /unsuspend.
+func (cfg *apiConfig) handlerAdminUserByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/")
+	if action != "suspend" && action != "unsuspend" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if action == "unsuspend" {
+		updated, err := cfg.DB.UnsuspendUser(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error unsuspending user: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not unsuspend user")
+			return
+		}
+		if updated == 0 {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Ending every session stops refreshes; access tokens already issued run out on their own
+	tx, err := cfg.DB.BeginTx(r.Context())
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not suspend user")
+		return
+	}
+	defer tx.Rollback()
+
+	updated, err := tx.SuspendUser(r.Context(), userID)
+	if err == nil && updated > 0 {
+		_, err = tx.RevokeAllUserSessions(r.Context(), userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error suspending user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not suspend user")
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminChirpByID serves DELETE /admin/chirps/{id}, which removes any user's chirp.
+func (cfg *apiConfig) handlerAdminChirpByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, "/admin/chirps/"))
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err == sql.ErrNoRows || (err == nil && chirp.DeletedAt.Valid) {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp by ID: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	if err := cfg.removeChirp(r.Context(), chirpID); err != nil {
+		log.Printf("Error deleting chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not delete chirp")
+		return
+	}
+
+	log.Printf("Chirp %s by user %s was deleted by an administrator", chirpID, chirp.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
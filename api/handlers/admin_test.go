@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRequireRole(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	alice := s.signup("alice@example.com", "alice")
+	suspended := s.signup("suspended@example.com", "suspended")
+	deleted := s.signup("deleted@example.com", "deleted")
+
+	var pat struct {
+		Token string `json:"token"`
+	}
+	s.expect(http.StatusCreated, http.MethodPost, "/api/tokens", alice.Token, map[string]interface{}{
+		"name":   "everything",
+		"scopes": []string{"chirps:read", "chirps:write", "profile:write"},
+	}, &pat)
+
+	// Access tokens issued before these changes are still valid, so only the database knows
+	if _, err := s.db.SuspendUser(ctx, suspended.ID); err != nil {
+		t.Fatalf("SuspendUser: %v", err)
+	}
+	if _, err := s.db.DeleteUser(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		error  string
+	}{
+		{"no role", alice.Token, http.StatusForbidden, "You are not allowed to do this"},
+		{"personal access token", pat.Token, http.StatusForbidden, "Personal access tokens cannot be used here"},
+		{"suspended user", suspended.Token, http.StatusForbidden, "This account has been suspended"},
+		{"deleted user", deleted.Token, http.StatusUnauthorized, "Invalid or expired access token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.do(http.MethodGet, "/admin/users", tt.token, nil)
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.StatusCode != tt.status || body.Error != tt.error {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body.Error, tt.status, tt.error)
+			}
+		})
+	}
+}
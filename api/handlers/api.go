@@ -2,22 +2,40 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/bruteforce"
 	"github.com/ProjectEmu/chirpy/internal/database"
-	"github.com/joho/godotenv"
+	"github.com/ProjectEmu/chirpy/internal/mailer"
+	"github.com/ProjectEmu/chirpy/internal/moderation"
+	"github.com/ProjectEmu/chirpy/internal/ratelimit"
+	"github.com/ProjectEmu/chirpy/internal/store"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
-	DB             *database.Queries
+	DB             store.Store
 	Platform       string
 	JWTSecret      string
+	Keys           *authy.KeySet
 	Polka_apiKey   string
+	Moderator      moderation.Moderator
+	Mailer         mailer.Mailer
+	BaseURL        string // Public URL links in emails point at
+	LoginGuard     *bruteforce.Guard
+	RateLimiter    *ratelimit.Limiter
+	DeletionGrace  time.Duration // How long a deleted account can be restored by logging in
+	ExportExpiry   time.Duration // How long an export archive can be downloaded
 }
 
 type errorResponse struct {
@@ -39,26 +57,241 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	json.NewEncoder(w).Encode(payload)
 }
 
-func SetupRoutes(mux *http.ServeMux, dbQueries *database.Queries, platform string, JWTSecret string) {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Failed to load environment variables: %v", err)
-	}
-
+func SetupRoutes(mux *http.ServeMux, db store.Store, platform string, JWTSecret string) {
 	apiCfg := &apiConfig{}
-	apiCfg.DB = dbQueries
+	apiCfg.DB = db
 	apiCfg.Platform = platform
 	apiCfg.JWTSecret = JWTSecret
 	apiCfg.Polka_apiKey = os.Getenv("POLKA_KEY")
 
+	keys, err := loadKeySet(JWTSecret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	apiCfg.Keys = keys
+
+	moderator, err := moderation.New(moderation.Config{
+		WordListPath: os.Getenv("MODERATION_WORDS_FILE"),
+		RulesPath:    os.Getenv("MODERATION_RULES_FILE"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to load moderation rules: %v", err)
+	}
+	apiCfg.Moderator = moderator
+
+	mail, err := mailer.New(mailer.Config{
+		From:         os.Getenv("MAIL_FROM"),
+		SMTPAddr:     os.Getenv("SMTP_ADDR"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		Dir:          os.Getenv("MAIL_DIR"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+	apiCfg.Mailer = mail
+
+	guard, err := loadLoginGuard(db)
+	if err != nil {
+		log.Fatalf("Failed to set up login protection: %v", err)
+	}
+	apiCfg.LoginGuard = guard
+
+	limiter, err := loadRateLimiter(db)
+	if err != nil {
+		log.Fatalf("Failed to set up rate limiting: %v", err)
+	}
+	apiCfg.RateLimiter = limiter
+
+	chirpWrites := rateLimitRule{
+		Name:     "chirp-writes",
+		Methods:  []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		Standard: ratelimit.Limit{Requests: config.ChirpWriteRateLimit, Per: time.Minute},
+		Red:      ratelimit.Limit{Requests: config.RedChirpWriteRateLimit, Per: time.Minute},
+	}
+	search := rateLimitRule{
+		Name:     "search",
+		Standard: ratelimit.Limit{Requests: config.SearchRateLimit, Per: time.Minute},
+		Red:      ratelimit.Limit{Requests: config.RedSearchRateLimit, Per: time.Minute},
+	}
+	signup := rateLimitRule{
+		Name:     "signup",
+		Methods:  []string{http.MethodPost},
+		Standard: ratelimit.Limit{Requests: config.SignupRateLimit, Per: time.Hour},
+	}
+	email := rateLimitRule{
+		Name:     "email",
+		Methods:  []string{http.MethodPost},
+		Standard: ratelimit.Limit{Requests: config.EmailRateLimit, Per: time.Hour},
+	}
+
+	grace, err := loadDeletionGrace()
+	if err != nil {
+		log.Fatalf("Failed to set up account deletion: %v", err)
+	}
+	apiCfg.DeletionGrace = grace
+
+	exportExpiry, err := loadExportExpiry()
+	if err != nil {
+		log.Fatalf("Failed to set up data exports: %v", err)
+	}
+	apiCfg.ExportExpiry = exportExpiry
+	go apiCfg.sweep()
+
+	apiCfg.BaseURL = strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if apiCfg.BaseURL == "" {
+		apiCfg.BaseURL = "http://localhost:8080"
+	}
+
 	fileServer := http.FileServer(http.Dir("."))
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", fileServer)))
-	mux.HandleFunc("/admin/metrics", apiCfg.handlerMetrics)
+	mux.HandleFunc("/admin/metrics", apiCfg.middlewareRequireRole(apiCfg.handlerMetrics, authy.RoleAdmin))
 	mux.HandleFunc("/admin/reset", apiCfg.handlerReset)
-	mux.HandleFunc("/api/chirps", apiCfg.handlerChirps)
-	mux.HandleFunc("/api/chirps/", apiCfg.handlerChirpByID)
-	mux.HandleFunc("/api/users", apiCfg.handlerUsers)
+	mux.HandleFunc("/admin/moderation", apiCfg.middlewareRequireRole(apiCfg.handlerModerationQueue, authy.RoleAdmin, authy.RoleModerator))
+	mux.HandleFunc("/admin/moderation/", apiCfg.middlewareRequireRole(apiCfg.handlerModerationDecision, authy.RoleAdmin, authy.RoleModerator))
+	mux.HandleFunc("/admin/users", apiCfg.middlewareRequireRole(apiCfg.handlerAdminUsers, authy.RoleAdmin))
+	mux.HandleFunc("/admin/users/", apiCfg.middlewareRequireRole(apiCfg.handlerAdminUserByID, authy.RoleAdmin))
+	mux.HandleFunc("/admin/chirps/", apiCfg.middlewareRequireRole(apiCfg.handlerAdminChirpByID, authy.RoleAdmin, authy.RoleModerator))
+	mux.HandleFunc("/api/chirps", apiCfg.middlewareRateLimit(chirpWrites, apiCfg.handlerChirps))
+	mux.HandleFunc("/api/chirps/", apiCfg.middlewareRateLimit(chirpWrites, apiCfg.handlerChirpByID))
+	mux.HandleFunc("/api/chirps/import", apiCfg.middlewareRateLimit(chirpWrites, apiCfg.handlerImportChirps))
+	mux.HandleFunc("/api/chirps/search", apiCfg.middlewareRateLimit(search, apiCfg.handlerSearchChirps))
+	mux.HandleFunc("/api/hashtags/", apiCfg.handlerHashtags)
+	mux.HandleFunc("/api/hashtags/trending", apiCfg.handlerTrendingHashtags)
+	mux.HandleFunc("/api/users", apiCfg.middlewareRateLimit(signup, apiCfg.handlerUsers))
+	mux.HandleFunc("/api/users/", apiCfg.handlerUserByID)
+	mux.HandleFunc("/api/timeline", apiCfg.handlerTimeline)
 	mux.HandleFunc("/api/login", apiCfg.handlerUserLogin)
+	mux.HandleFunc("/api/login/mfa", apiCfg.handlerLoginMFA)
 	mux.HandleFunc("/api/revoke", apiCfg.handlerRevokeToken)
 	mux.HandleFunc("/api/refresh", apiCfg.handlerRefreshToken)
+	mux.HandleFunc("/api/sessions", apiCfg.handlerSessions)
+	mux.HandleFunc("/api/sessions/", apiCfg.handlerSessionByID)
+	mux.HandleFunc("/api/tokens", apiCfg.handlerTokens)
+	mux.HandleFunc("/api/tokens/", apiCfg.handlerTokenByID)
+	mux.HandleFunc("/api/password/forgot", apiCfg.middlewareRateLimit(email, apiCfg.handlerForgotPassword))
+	mux.HandleFunc("/api/password/reset", apiCfg.handlerResetPassword)
+	mux.HandleFunc("/api/verify-email", apiCfg.handlerVerifyEmail)
 	mux.HandleFunc("/api/polka/webhooks", apiCfg.handlerPolkaWebhook)
+	mux.HandleFunc("/.well-known/jwks.json", apiCfg.handlerJWKS)
+}
+
+// loadKeySet signs with the PEM key in JWT_SIGNING_KEY_FILE, falling back to the JWTSECRET
+// HMAC secret when it is unset. Keys listed in JWT_VERIFICATION_KEY_FILES are only used to
+// verify, so tokens signed before a rotation stay valid until they expire.
+func loadKeySet(JWTSecret string) (*authy.KeySet, error) {
+	signing := authy.NewHMACKey(JWTSecret)
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		var err error
+		signing, err = authy.LoadKeyPEM(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var verification []*authy.Key
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := authy.LoadKeyPEM(path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+
+	return authy.NewKeySet(signing, verification...)
+}
+
+// loadDeletionGrace reads how many days a deleted account lingers from ACCOUNT_DELETION_GRACE_DAYS.
+// With no grace period accounts are deleted as soon as the user asks.
+func loadDeletionGrace() (time.Duration, error) {
+	days := config.DeletionGracePeriod
+	if value := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("ACCOUNT_DELETION_GRACE_DAYS must be a non-negative number, got %q", value)
+		}
+		days = n
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// loadExportExpiry reads how many days an export archive is kept from DATA_EXPORT_EXPIRY_DAYS.
+func loadExportExpiry() (time.Duration, error) {
+	days := config.DataExportDuration
+	if value := os.Getenv("DATA_EXPORT_EXPIRY_DAYS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("DATA_EXPORT_EXPIRY_DAYS must be a positive number, got %q", value)
+		}
+		days = n
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// loadRateLimiter picks where rate limit buckets live from RATE_LIMIT_STORE: "memory" (the
+// default) keeps them per process, "postgres" shares them between instances at the cost of a
+// write per limited request.
+func loadRateLimiter(db database.Querier) (*ratelimit.Limiter, error) {
+	switch storeName := os.Getenv("RATE_LIMIT_STORE"); storeName {
+	case "", "memory":
+		return ratelimit.NewLimiter(ratelimit.NewMemoryStore()), nil
+	case "postgres":
+		return ratelimit.NewLimiter(ratelimit.NewPostgresStore(db)), nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q, use memory or postgres", storeName)
+	}
+}
+
+// loadLoginGuard builds the failed login limits. LOGIN_ATTEMPT_STORE picks where failures are
+// counted: "postgres" (the default) shares them between instances, "memory" keeps them per process.
+func loadLoginGuard(db database.Querier) (*bruteforce.Guard, error) {
+	var store bruteforce.Store
+	switch storeName := os.Getenv("LOGIN_ATTEMPT_STORE"); storeName {
+	case "", "postgres":
+		store = bruteforce.NewPostgresStore(db)
+	case "memory":
+		store = bruteforce.NewMemoryStore()
+	default:
+		return nil, fmt.Errorf("unknown LOGIN_ATTEMPT_STORE %q, use postgres or memory", storeName)
+	}
+
+	lockoutFailures := config.LoginLockoutFailures
+	if value := os.Getenv("LOGIN_LOCKOUT_FAILURES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("LOGIN_LOCKOUT_FAILURES must be a non-negative number, got %q", value)
+		}
+		lockoutFailures = n
+	}
+
+	lockoutMinutes := config.LoginLockoutDuration
+	if value := os.Getenv("LOGIN_LOCKOUT_MINUTES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("LOGIN_LOCKOUT_MINUTES must be a positive number, got %q", value)
+		}
+		lockoutMinutes = n
+	}
+
+	// A lockout cannot outlast the window, since the failures behind it are forgotten then
+	window := time.Duration(max(config.LoginFailureWindow, lockoutMinutes)) * time.Minute
+	ip := bruteforce.Policy{
+		FreeAttempts: config.LoginIPFreeAttempts,
+		BaseDelay:    time.Second,
+		MaxDelay:     config.MaxLoginBackoff * time.Second,
+		Window:       window,
+	}
+	account := bruteforce.Policy{
+		FreeAttempts:    config.LoginFreeAttempts,
+		BaseDelay:       time.Second,
+		MaxDelay:        config.MaxLoginBackoff * time.Second,
+		LockoutAfter:    lockoutFailures,
+		LockoutDuration: time.Duration(lockoutMinutes) * time.Minute,
+		Window:          window,
+	}
+	return bruteforce.NewGuard(store, ip, account), nil
 }
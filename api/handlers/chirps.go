@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/ProjectEmu/chirpy/config"
 	authy "github.com/ProjectEmu/chirpy/internal/auth"
 	"github.com/ProjectEmu/chirpy/internal/database"
 	"github.com/google/uuid"
@@ -15,15 +19,76 @@ import (
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	Body      string    `json:"body"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	User_id   uuid.UUID `json:"user_id"`
+	ID            uuid.UUID  `json:"id"`
+	Body          string     `json:"body"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	User_id       uuid.UUID  `json:"user_id"`
+	InReplyTo     *uuid.UUID `json:"in_reply_to,omitempty"`
+	RootID        *uuid.UUID `json:"root_id,omitempty"`
+	RechirpOf     *uuid.UUID `json:"rechirp_of,omitempty"`
+	QuoteOf       *uuid.UUID `json:"quote_of,omitempty"`
+	Original      *Chirp     `json:"original,omitempty"`
+	Deleted       bool       `json:"deleted,omitempty"`
+	LikeCount     int64      `json:"like_count"`
+	LikedByMe     *bool      `json:"liked_by_me,omitempty"`
+	RechirpCount  int64      `json:"rechirp_count"`
+	QuoteCount    int64      `json:"quote_count"`
+	RechirpedByMe *bool      `json:"rechirped_by_me,omitempty"`
+	Hashtags      []string   `json:"hashtags"`
+	Mentions      []Mention  `json:"mentions"`
 }
 
 type chirpRequest struct {
-	Body string `json:"body"`
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	RechirpOf *uuid.UUID `json:"rechirp_of"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
+}
+
+// chirpFromDB maps database.Chirp to the Chirp struct to control JSON keys
+func chirpFromDB(chirp database.Chirp) Chirp {
+	responseChirp := Chirp{
+		ID:        chirp.ID,
+		Body:      chirp.Body,
+		User_id:   chirp.UserID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Deleted:   chirp.DeletedAt.Valid,
+		Hashtags:  extractHashtags(chirp.Body),
+		Mentions:  []Mention{},
+	}
+	if chirp.ParentID.Valid {
+		responseChirp.InReplyTo = &chirp.ParentID.UUID
+	}
+	if chirp.RootID.Valid {
+		responseChirp.RootID = &chirp.RootID.UUID
+	}
+	if chirp.RechirpOf.Valid {
+		responseChirp.RechirpOf = &chirp.RechirpOf.UUID
+	}
+	if chirp.QuoteOf.Valid {
+		responseChirp.QuoteOf = &chirp.QuoteOf.UUID
+	}
+	return responseChirp
+}
+
+// decorateChirps fills in everything a Chirp response carries beyond its own row:
+// the rechirped or quoted original, and mentions, like and share counts for both.
+func (cfg *apiConfig) decorateChirps(ctx context.Context, viewer uuid.NullUUID, chirps []*Chirp) error {
+	originals, err := cfg.attachOriginals(ctx, chirps)
+	if err != nil {
+		return err
+	}
+
+	all := slices.Concat(chirps, originals)
+	if err := cfg.attachMentions(ctx, all); err != nil {
+		return err
+	}
+	if err := cfg.attachLikes(ctx, viewer, all); err != nil {
+		return err
+	}
+	return cfg.attachShares(ctx, viewer, all)
 }
 
 // Main handler
@@ -41,9 +106,37 @@ func (cfg *apiConfig) handlerChirps(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) handlerChirpByID(w http.ResponseWriter, r *http.Request) {
+	_, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/chirps/"), "/")
+	switch action {
+	case "":
+	case "rechirp":
+		cfg.handleUndoRechirp(w, r)
+		return
+	case "like":
+		cfg.handlerChirpLike(w, r)
+		return
+	case "likes":
+		cfg.handleGetChirpLikers(w, r)
+		return
+	case "replies":
+		cfg.handleGetChirpReplies(w, r)
+		return
+	case "revisions":
+		cfg.handleGetChirpRevisions(w, r)
+		return
+	case "thread":
+		cfg.handleGetChirpThread(w, r)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		cfg.handleGetChirpByID(w, r)
+	case http.MethodPatch:
+		cfg.handleEditChirp(w, r)
 	case http.MethodDelete:
 		cfg.handleDeleteChirpByID(w, r)
 	default:
@@ -51,17 +144,55 @@ func (cfg *apiConfig) handlerChirpByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func cleanProfanity(body string) string {
-	profanities := []string{"kerfuffle", "sharbert", "fornax"}
-	words := strings.Split(body, " ")
-	for i, word := range words {
-		for _, profanity := range profanities {
-			if strings.EqualFold(word, profanity) {
-				words[i] = "****"
-			}
+// chirpIDFromPath parses the {id} segment of /api/chirps/{id}/...
+func chirpIDFromPath(path string) (uuid.UUID, error) {
+	id, _, _ := strings.Cut(strings.TrimPrefix(path, "/api/chirps/"), "/")
+	return uuid.Parse(id)
+}
+
+// createChirp stores a new chirp along with the hashtags and mentions in its body, in a
+// single transaction.
+func (cfg *apiConfig) createChirp(ctx context.Context, params database.CreateChirpParams) (database.Chirp, error) {
+	tx, err := cfg.DB.BeginTx(ctx)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp, err := tx.CreateChirp(ctx, params)
+	if err == nil {
+		err = indexChirp(ctx, tx, chirp)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// indexChirp stores the hashtags and mentions in a new chirp's body.
+func indexChirp(ctx context.Context, q database.Querier, chirp database.Chirp) error {
+	if tags := extractHashtags(chirp.Body); len(tags) > 0 {
+		err := q.SetChirpTags(ctx, database.SetChirpTagsParams{
+			ChirpID: chirp.ID,
+			Names:   tags,
+		})
+		if err != nil {
+			return fmt.Errorf("tagging chirp: %w", err)
+		}
+	}
+	if mentions := extractMentions(chirp.Body); len(mentions) > 0 {
+		err := q.SetChirpMentions(ctx, database.SetChirpMentionsParams{
+			ChirpID:   chirp.ID,
+			Usernames: mentions,
+		})
+		if err != nil {
+			return fmt.Errorf("storing chirp mentions: %w", err)
 		}
 	}
-	return strings.Join(words, " ")
+	return nil
 }
 
 func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request) {
@@ -70,56 +201,101 @@ func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	bearer, err := authy.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Issue parsing bearer: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Issue parsing bearer")
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
 
 	var req chirpRequest
 	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&req)
+	err := decoder.Decode(&req)
 	if err != nil {
 		log.Printf("Error decoding request: %s", err)
 		respondWithError(w, http.StatusBadRequest, "Something went wrong")
 		return
 	}
 
-	if len(req.Body) > 140 {
+	if len(req.Body) > config.MaxChirpLength {
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
 		return
 	}
 
-	userID, err := authy.ValidateJWT(bearer, cfg.JWTSecret)
-	if err != nil {
-		log.Printf("Issue authenticating bearer: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Issue authenticating bearer")
+	// A rechirp is a pure repost; anything with a body is a quote chirp
+	if req.RechirpOf != nil {
+		if req.Body != "" || req.InReplyTo != nil || req.QuoteOf != nil {
+			respondWithError(w, http.StatusBadRequest, "A rechirp cannot have a body, reply or quote; use quote_of instead")
+			return
+		}
+		cfg.handleCreateRechirp(w, r, userID, *req.RechirpOf)
 		return
 	}
 
-	cleanedBody := cleanProfanity(req.Body)
-
-	// Use SQLC's CreateChirp method
+	if req.QuoteOf != nil && strings.TrimSpace(req.Body) == "" {
+		respondWithError(w, http.StatusBadRequest, "A quote chirp needs a body")
+		return
+	}
 
 	chirpParams := database.CreateChirpParams{
-		Body:   cleanedBody,
+		Body:   req.Body,
 		UserID: userID,
 	}
-	chirp, err := cfg.DB.CreateChirp(r.Context(), chirpParams)
+
+	if req.QuoteOf != nil {
+		original, err := cfg.shareableChirp(r.Context(), *req.QuoteOf)
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Chirp being quoted was not found")
+			return
+		} else if err != nil {
+			log.Printf("Error retrieving quoted chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not chirp")
+			return
+		}
+		chirpParams.QuoteOf = uuid.NullUUID{UUID: original.ID, Valid: true}
+	}
+
+	// Replies point at their parent and at the root of the conversation
+	if req.InReplyTo != nil {
+		parent, err := cfg.shareableChirp(r.Context(), *req.InReplyTo)
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Chirp being replied to was not found")
+			return
+		} else if err != nil {
+			log.Printf("Error retrieving parent chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not chirp")
+			return
+		}
+
+		chirpParams.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		chirpParams.RootID = parent.RootID
+		if !parent.RootID.Valid {
+			chirpParams.RootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	// Moderation runs once the reply and quote targets are known, so a held chirp keeps them
+	body, ok := cfg.moderateChirp(w, r, database.HoldChirpParams{
+		UserID:   userID,
+		Body:     req.Body,
+		ParentID: chirpParams.ParentID,
+		QuoteOf:  chirpParams.QuoteOf,
+	})
+	if !ok {
+		return
+	}
+	chirpParams.Body = body
+
+	chirp, err := cfg.createChirp(r.Context(), chirpParams)
 	if err != nil {
 		log.Printf("Error creating chirp: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not chirp")
 		return
 	}
 
-	// Map database.User to the User struct to control JSON keys
-	responseChirp := Chirp{
-		ID:        chirp.ID,
-		Body:      chirp.Body,
-		User_id:   chirp.UserID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
+	responseChirp := chirpFromDB(chirp)
+	if err := cfg.decorateChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, []*Chirp{&responseChirp}); err != nil {
+		log.Printf("Error decorating chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not chirp")
+		return
 	}
 
 	respondWithJSON(w, http.StatusCreated, responseChirp)
@@ -158,19 +334,48 @@ func (cfg *apiConfig) handleGetChirpByID(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	// Map the database chirp to a response chirp
-	responseChirp := Chirp{
-		ID:        chirp.ID,
-		Body:      chirp.Body,
-		User_id:   chirp.UserID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
+	// Deleted chirps come back as tombstones
+	responseChirp := chirpFromDB(chirp)
+	if err := cfg.decorateChirps(r.Context(), cfg.viewerID(r), []*Chirp{&responseChirp}); err != nil {
+		log.Printf("Error decorating chirp: %s", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
 	// Send back the chirp in JSON format
 	respondWithJSON(w, http.StatusOK, responseChirp)
 }
 
+// removeChirp deletes a chirp. Chirps that are replied to, rechirped or quoted become
+// tombstones instead so those stay intact. The chirp is locked while it is checked, so a
+// reply cannot slip in between the check and the delete.
+func (cfg *apiConfig) removeChirp(ctx context.Context, chirpID uuid.UUID) error {
+	tx, err := cfg.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.GetChirpForUpdate(ctx, chirpID)
+	if err == sql.ErrNoRows {
+		// Removed in the meantime
+		return nil
+	}
+	var referenceCount int64
+	if err == nil {
+		referenceCount, err = tx.CountChirpReferences(ctx, chirpID)
+	}
+	if err == nil && referenceCount > 0 {
+		err = tx.TombstoneChirp(ctx, chirpID)
+	} else if err == nil {
+		err = tx.DeleteChirp(ctx, chirpID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	return err
+}
+
 func (cfg *apiConfig) handleDeleteChirpByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -191,19 +396,8 @@ func (cfg *apiConfig) handleDeleteChirpByID(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Extract Bearer Token from request header
-	bearer, err := authy.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Issue parsing bearer token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Invalid bearer token")
-		return
-	}
-
-	// Validate JWT and get User ID
-	userID, err := authy.ValidateJWT(bearer, cfg.JWTSecret)
-	if err != nil {
-		log.Printf("Issue authenticating bearer token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized access")
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
 
@@ -221,6 +415,12 @@ func (cfg *apiConfig) handleDeleteChirpByID(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// A tombstone has already been deleted
+	if chirp.DeletedAt.Valid {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	}
+
 	// Check if the authenticated user is the author of the chirp
 	if chirp.UserID != userID {
 		log.Printf("User %s attempted to delete chirp %s, which does not belong to them", userID, chirpID)
@@ -228,9 +428,7 @@ func (cfg *apiConfig) handleDeleteChirpByID(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Use SQLC's DeleteChirp method to delete the chirp
-	err = cfg.DB.DeleteChirp(r.Context(), chirpID)
-	if err != nil {
+	if err := cfg.removeChirp(r.Context(), chirpID); err != nil {
 		log.Printf("Error deleting chirp: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not delete chirp")
 		return
@@ -249,7 +447,7 @@ func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request)
 	// Log the raw query values for verification
 	log.Printf("Received query parameters: %v", r.URL.Query())
 
-	// Extract query parameters for author_id and sort
+	// Extract query parameters for author_id and sort; cursor and limit are handled by parsePageRequest
 	authorIDParam := r.URL.Query().Get("author_id")
 	sortOrder := r.URL.Query().Get("sort")
 
@@ -263,9 +461,15 @@ func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Invalid sort parameter, must be 'asc' or 'desc'")
 		return
 	}
-	queryParams := database.GetChirpsWithFilterAndSortParams{}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
 	// Parse author ID if provided
-	var authorID uuid.UUID
+	var authorID uuid.NullUUID
 	if authorIDParam != "" {
 		parsedUUID, err := uuid.Parse(authorIDParam)
 		if err != nil {
@@ -274,37 +478,51 @@ func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		log.Printf("Successfully parsed author_id: %s", parsedUUID)
-		authorID = parsedUUID
-		queryParams.Column1 = authorID
+		authorID = uuid.NullUUID{UUID: parsedUUID, Valid: true}
+	}
+	log.Printf("Parsed author_id: %s, sort_order: %s, limit: %d", authorID.UUID, sortOrder, page.Limit)
+
+	// Execute the keyset query matching the requested sort order
+	var chirps []database.Chirp
+	if sortOrder == "desc" {
+		chirps, err = cfg.DB.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: page.cursorCreatedAt(),
+			CursorID:        page.cursorID(),
+			PageLimit:       page.fetchLimit(),
+		})
 	} else {
-		log.Println("No author_id provided, defaulting to empty UUID.")
-		queryParams.Column1 = uuid.Nil
+		chirps, err = cfg.DB.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			CursorCreatedAt: page.cursorCreatedAt(),
+			CursorID:        page.cursorID(),
+			PageLimit:       page.fetchLimit(),
+		})
 	}
-	queryParams.Column2 = sortOrder
-	log.Printf("Parsed author_id: %s, sort_order: %s", authorID, sortOrder)
-
-	log.Printf("Query Params Struct: %+v", queryParams)
-
-	// Execute the SQL query with appropriate parameters
-	chirps, err := cfg.DB.GetChirpsWithFilterAndSort(r.Context(), queryParams)
 	if err != nil {
 		log.Printf("Error retrieving chirps: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not retrieve chirps")
 		return
 	}
 
+	// The extra row only tells us there is another page
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, page.Limit)
+	}
+
 	log.Printf("Number of chirps retrieved: %d", len(chirps))
 
 	// Prepare the response
 	responseChirps := make([]Chirp, len(chirps))
 	for i, chirp := range chirps {
-		responseChirps[i] = Chirp{
-			ID:        chirp.ID,
-			Body:      chirp.Body,
-			User_id:   chirp.UserID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-		}
+		responseChirps[i] = chirpFromDB(chirp)
+	}
+	if err := cfg.decorateChirps(r.Context(), cfg.viewerID(r), chirpRefs(responseChirps)); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve chirps")
+		return
 	}
 
 	log.Printf("Returning %d chirps in response", len(responseChirps))
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestChirpCRUD(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	bob := s.signup("bob@example.com", "bob")
+
+	chirp := s.chirp(alice.Token, "hello #world")
+	if chirp.Body != "hello #world" || chirp.User_id != alice.ID {
+		t.Errorf("created chirp = %+v", chirp)
+	}
+	if len(chirp.Hashtags) != 1 || chirp.Hashtags[0] != "world" {
+		t.Errorf("hashtags = %v, want [world]", chirp.Hashtags)
+	}
+
+	var got Chirp
+	s.expect(http.StatusOK, http.MethodGet, "/api/chirps/"+chirp.ID.String(), "", nil, &got)
+	if got.ID != chirp.ID || got.Body != chirp.Body {
+		t.Errorf("got chirp %+v, want %+v", got, chirp)
+	}
+
+	s.expect(http.StatusBadRequest, http.MethodPost, "/api/chirps", alice.Token, map[string]string{
+		"body": strings.Repeat("a", 141),
+	}, nil)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/chirps", "", map[string]string{"body": "anonymous"}, nil)
+	s.expect(http.StatusBadRequest, http.MethodGet, "/api/chirps/not-an-id", "", nil, nil)
+
+	// Only the author can delete a chirp, and it is gone afterwards
+	path := "/api/chirps/" + chirp.ID.String()
+	s.expect(http.StatusForbidden, http.MethodDelete, path, bob.Token, nil, nil)
+	s.expect(http.StatusNoContent, http.MethodDelete, path, alice.Token, nil, nil)
+	s.expect(http.StatusNotFound, http.MethodGet, path, "", nil, nil)
+	s.expect(http.StatusNotFound, http.MethodDelete, path, alice.Token, nil, nil)
+}
+
+func TestChirpLengthIsCheckedBeforeAndAfterMasking(t *testing.T) {
+	dir := t.TempDir()
+	words, rules := filepath.Join(dir, "words.txt"), filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(words, []byte("supercalifragilisticexpialidocious\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rules, []byte(`[{"name": "x", "pattern": "x", "action": "mask"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MODERATION_WORDS_FILE", words)
+	t.Setenv("MODERATION_RULES_FILE", rules)
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	// Masking the long word would bring the body under the limit, but it is too long as sent
+	long := map[string]string{"body": strings.Repeat("a", 110) + " supercalifragilisticexpialidocious"}
+	s.expect(http.StatusBadRequest, http.MethodPost, "/api/chirps", alice.Token, long, nil)
+
+	// Each x grows to four asterisks, taking the body over the limit once masked
+	grown := map[string]string{"body": strings.Repeat("x", 40)}
+	s.expect(http.StatusBadRequest, http.MethodPost, "/api/chirps", alice.Token, grown, nil)
+
+	chirp := s.chirp(alice.Token, "short")
+	for _, body := range []map[string]string{long, grown} {
+		s.expect(http.StatusBadRequest, http.MethodPatch, "/api/chirps/"+chirp.ID.String(), alice.Token, body, nil)
+	}
+}
+
+func TestDeleteRepliedChirpLeavesTombstone(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	bob := s.signup("bob@example.com", "bob")
+
+	parent := s.chirp(alice.Token, "parent")
+	var reply Chirp
+	s.expect(http.StatusCreated, http.MethodPost, "/api/chirps", bob.Token, map[string]interface{}{
+		"body":        "reply",
+		"in_reply_to": parent.ID,
+	}, &reply)
+	if reply.InReplyTo == nil || *reply.InReplyTo != parent.ID || reply.RootID == nil || *reply.RootID != parent.ID {
+		t.Errorf("reply = %+v, want it in reply to %s", reply, parent.ID)
+	}
+
+	s.expect(http.StatusNoContent, http.MethodDelete, "/api/chirps/"+parent.ID.String(), alice.Token, nil, nil)
+
+	var tombstone Chirp
+	s.expect(http.StatusOK, http.MethodGet, "/api/chirps/"+parent.ID.String(), "", nil, &tombstone)
+	if !tombstone.Deleted || tombstone.Body != "" {
+		t.Errorf("deleted parent = %+v, want a tombstone", tombstone)
+	}
+	s.expect(http.StatusOK, http.MethodGet, "/api/chirps/"+reply.ID.String(), "", nil, nil)
+}
+
+func TestListChirps(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	bob := s.signup("bob@example.com", "bob")
+
+	var aliceChirps []Chirp
+	for i := range 3 {
+		aliceChirps = append(aliceChirps, s.chirp(alice.Token, fmt.Sprintf("alice %d", i)))
+		s.chirp(bob.Token, fmt.Sprintf("bob %d", i))
+	}
+
+	var all []Chirp
+	s.expect(http.StatusOK, http.MethodGet, "/api/chirps", "", nil, &all)
+	if len(all) != 6 {
+		t.Fatalf("listed %d chirps, want 6", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].CreatedAt.Before(all[i-1].CreatedAt) {
+			t.Errorf("chirps are not in ascending order: %v before %v", all[i-1].CreatedAt, all[i].CreatedAt)
+		}
+	}
+
+	var byAlice []Chirp
+	s.expect(http.StatusOK, http.MethodGet, "/api/chirps?sort=desc&author_id="+alice.ID.String(), "", nil, &byAlice)
+	if len(byAlice) != 3 {
+		t.Fatalf("listed %d chirps by alice, want 3", len(byAlice))
+	}
+	for i, chirp := range byAlice {
+		if want := aliceChirps[len(aliceChirps)-1-i]; chirp.ID != want.ID {
+			t.Errorf("chirp %d by alice = %q, want %q", i, chirp.Body, want.Body)
+		}
+	}
+
+	s.expect(http.StatusBadRequest, http.MethodGet, "/api/chirps?sort=sideways", "", nil, nil)
+	s.expect(http.StatusBadRequest, http.MethodGet, "/api/chirps?author_id=nope", "", nil, nil)
+}
+
+var nextLinkPattern = regexp.MustCompile(`^<([^>]+)>; rel="next"$`)
+
+func TestListChirpsPagination(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	const total = 7
+	for i := range total {
+		s.chirp(alice.Token, fmt.Sprintf("chirp %d", i))
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		t.Run(order, func(t *testing.T) {
+			var bodies []string
+			pages := 0
+			path := "/api/chirps?limit=3&sort=" + order
+			for path != "" {
+				var page []Chirp
+				resp := s.expect(http.StatusOK, http.MethodGet, path, "", nil, &page)
+				pages++
+				if len(page) > 3 {
+					t.Fatalf("page %d has %d chirps, want at most 3", pages, len(page))
+				}
+				for _, chirp := range page {
+					bodies = append(bodies, chirp.Body)
+				}
+
+				path = ""
+				if link := resp.Header.Get("Link"); link != "" {
+					match := nextLinkPattern.FindStringSubmatch(link)
+					if match == nil {
+						t.Fatalf("malformed Link header %q", link)
+					}
+					path = match[1]
+				}
+			}
+
+			if pages != 3 || len(bodies) != total {
+				t.Fatalf("got %d chirps over %d pages, want %d over 3", len(bodies), pages, total)
+			}
+			for i, body := range bodies {
+				n := i
+				if order == "desc" {
+					n = total - 1 - i
+				}
+				if want := fmt.Sprintf("chirp %d", n); body != want {
+					t.Errorf("chirp %d = %q, want %q", i, body, want)
+				}
+			}
+		})
+	}
+
+	tests := []string{"limit=0", "limit=-1", "limit=ten", "cursor=not-base64!", "cursor=bm9wZQ"}
+	for _, query := range tests {
+		s.expect(http.StatusBadRequest, http.MethodGet, "/api/chirps?"+query, "", nil, nil)
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/ProjectEmu/chirpy/internal/mailer"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// What an emailed token can be exchanged for. A token only works for its own purpose.
+const (
+	tokenPurposePasswordReset = "password_reset"
+	tokenPurposeVerifyEmail   = "verify_email"
+)
+
+// newEmailToken stores a single-use token for purpose, replacing any earlier one, and returns it.
+func (cfg *apiConfig) newEmailToken(ctx context.Context, userID uuid.UUID, email, purpose string, validFor time.Duration) (string, error) {
+	// Emailed tokens are random like refresh tokens and only their hash is stored
+	token, err := authy.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.DB.CreateEmailToken(ctx, database.CreateEmailTokenParams{
+		TokenHash: authy.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(validFor),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sendVerificationEmail mails the user a link that confirms they own the address.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := cfg.newEmailToken(ctx, userID, email, tokenPurposeVerifyEmail, config.VerifyEmailDuration*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	link := cfg.BaseURL + "/api/verify-email?token=" + url.QueryEscape(token)
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your Chirpy email address",
+		Body: fmt.Sprintf("Open this link to confirm your email address:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not sign up for Chirpy, you can ignore this email.\n",
+			link, config.VerifyEmailDuration),
+	})
+}
+
+// sendPasswordResetEmail mails the user a link to choose a new password.
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := cfg.newEmailToken(ctx, userID, email, tokenPurposePasswordReset, config.PasswordResetDuration*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	link := cfg.BaseURL + "/app/reset-password?token=" + url.QueryEscape(token)
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Open this link to choose a new password:\n\n%s\n\n"+
+			"The link expires in %d minutes. If you did not ask to reset your password, you can ignore this email.\n",
+			link, config.PasswordResetDuration),
+	})
+}
+
+// consumeEmailToken spends a token, reporting false when it is unknown, expired or already used,
+// or when the user's email has changed since it was sent. Run in a transaction, the token is only
+// spent if the transaction commits.
+func consumeEmailToken(ctx context.Context, q database.Querier, token, purpose string) (database.ConsumeEmailTokenRow, bool, error) {
+	row, err := q.ConsumeEmailToken(ctx, database.ConsumeEmailTokenParams{
+		TokenHash: authy.HashToken(token),
+		Purpose:   purpose,
+	})
+	if err == sql.ErrNoRows {
+		return row, false, nil
+	} else if err != nil {
+		return row, false, err
+	}
+
+	user, err := q.GetUser(ctx, row.UserID)
+	if err == sql.ErrNoRows {
+		return row, false, nil
+	} else if err != nil {
+		return row, false, err
+	}
+	return row, user.Email == row.Email, nil
+}
+
+// Handler for POST /api/password/forgot
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// The response is the same whether or not the address has an account, so this
+	// endpoint cannot be used to find out who is registered
+	user, err := cfg.DB.AuthUser(r.Context(), req.Email)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not send password reset email")
+		return
+	}
+
+	// Sending in the background keeps the response time from giving the answer away
+	go func() {
+		if err := cfg.sendPasswordResetEmail(context.Background(), user.ID, user.Email); err != nil {
+			log.Printf("Error sending password reset email: %s", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Handler for POST /api/password/reset
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required")
+		return
+	}
+
+	pwHash, err := authy.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error creating password hash: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid password")
+		return
+	}
+
+	// The token is spent along with the reset, so a failed reset can be retried with it.
+	// Whoever knew the old password is logged out along with everyone else, and loses any
+	// personal access token or half-finished two-factor login they made with it
+	tx, err := cfg.DB.BeginTx(r.Context())
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+	defer tx.Rollback()
+
+	token, ok, err := consumeEmailToken(r.Context(), tx, req.Token, tokenPurposePasswordReset)
+	if err != nil {
+		log.Printf("Error retrieving password reset token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+
+	err = tx.SetUserPassword(r.Context(), database.SetUserPasswordParams{
+		ID:             token.UserID,
+		HashedPassword: pwHash,
+	})
+	if err == nil {
+		_, err = tx.RevokeAllUserSessions(r.Context(), token.UserID)
+	}
+	if err == nil {
+		err = tx.DeleteUserPersonalAccessTokens(r.Context(), token.UserID)
+	}
+	if err == nil {
+		err = tx.DeleteUserMFAChallenges(r.Context(), token.UserID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler for GET /api/verify-email?token=, the link sent in verification emails
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok, err := consumeEmailToken(r.Context(), cfg.DB, r.URL.Query().Get("token"), tokenPurposeVerifyEmail)
+	if err != nil {
+		log.Printf("Error retrieving verification token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not verify email")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification link")
+		return
+	}
+
+	_, err = cfg.DB.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    token.UserID,
+		Email: token.Email,
+	})
+	if err != nil {
+		log.Printf("Error verifying email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not verify email")
+		return
+	}
+
+	var response struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	response.Email = token.Email
+	response.EmailVerified = true
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// Handler for POST /api/users/me/verify-email, which sends a new verification link
+func (cfg *apiConfig) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve user")
+		return
+	}
+	if user.EmailVerified {
+		respondWithError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("Error sending verification email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
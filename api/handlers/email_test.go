@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/ProjectEmu/chirpy/internal/store"
+)
+
+// resetLink matches the token in the link of a password reset email.
+var resetLink = regexp.MustCompile(`reset-password\?token=(\S+)`)
+
+// passwordResetToken asks for a password reset email and reads the token out of it.
+func (s *testServer) passwordResetToken(email string) string {
+	s.t.Helper()
+	s.expect(http.StatusAccepted, http.MethodPost, "/api/password/forgot", "", map[string]string{"email": email}, nil)
+
+	// The email is sent in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		files, _ := filepath.Glob(filepath.Join(os.Getenv("MAIL_DIR"), "*.eml"))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				s.t.Fatal(err)
+			}
+			if match := resetLink.FindSubmatch(data); match != nil {
+				token, err := url.QueryUnescape(string(match[1]))
+				if err != nil {
+					s.t.Fatalf("reset link has an invalid token: %v", err)
+				}
+				return token
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.t.Fatal("no password reset email was sent")
+	return ""
+}
+
+func TestResetPasswordRevokesCredentials(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	var pat struct {
+		Token string `json:"token"`
+	}
+	s.expect(http.StatusCreated, http.MethodPost, "/api/tokens", alice.Token, map[string]interface{}{
+		"name":   "profile",
+		"scopes": []string{"profile:write"},
+	}, &pat)
+	recoveryCodes := s.enableTOTP(alice)
+	mfaToken := s.startMFALogin(alice)
+
+	s.expect(http.StatusNoContent, http.MethodPost, "/api/password/reset", "", map[string]string{
+		"token":    s.passwordResetToken(alice.Email),
+		"password": "correct horse",
+	}, nil)
+
+	// Nothing made with the old password outlives the reset
+	s.expect(http.StatusUnauthorized, http.MethodPut, "/api/users", pat.Token, map[string]string{"username": "alice_b"}, nil)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login/mfa", "", map[string]string{
+		"mfa_token":     mfaToken,
+		"recovery_code": recoveryCodes[0],
+	}, nil)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/refresh", alice.RefreshToken, nil, nil)
+}
+
+// failingResetStore fails the password change of a reset while fail is set.
+type failingResetStore struct {
+	store.Store
+	fail atomic.Bool
+}
+
+func (s *failingResetStore) BeginTx(ctx context.Context) (store.Tx, error) {
+	tx, err := s.Store.BeginTx(ctx)
+	if err != nil || !s.fail.Load() {
+		return tx, err
+	}
+	return failingResetTx{tx}, nil
+}
+
+type failingResetTx struct {
+	store.Tx
+}
+
+func (failingResetTx) SetUserPassword(ctx context.Context, arg database.SetUserPasswordParams) error {
+	return errors.New("disk full")
+}
+
+func TestResetPasswordKeepsTokenWhenItFails(t *testing.T) {
+	db := &failingResetStore{Store: store.NewMemory()}
+	s := newTestServerWithStore(t, db)
+	alice := s.signup("alice@example.com", "alice")
+	reset := map[string]string{
+		"token":    s.passwordResetToken(alice.Email),
+		"password": "correct horse",
+	}
+
+	db.fail.Store(true)
+	s.expect(http.StatusInternalServerError, http.MethodPost, "/api/password/reset", "", reset, nil)
+	db.fail.Store(false)
+	s.expect(http.StatusNoContent, http.MethodPost, "/api/password/reset", "", reset, nil)
+	s.login(alice.Email, "correct horse")
+}
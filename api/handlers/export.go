@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// buildExportTimeout bounds how long assembling one archive may take.
+const buildExportTimeout = 5 * time.Minute
+
+// DataExport is the status of an export of a user's data.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+func dataExportFromDB(export database.GetDataExportRow) DataExport {
+	responseExport := DataExport{
+		ID:        export.ID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt,
+	}
+	if export.CompletedAt.Valid {
+		responseExport.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		responseExport.ExpiresAt = &export.ExpiresAt.Time
+	}
+	return responseExport
+}
+
+// SubscriptionEvent is a change to a user's Chirpy Red subscription.
+type SubscriptionEvent struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handleStartDataExport serves POST /api/users/me/export. The archive is built in the
+// background; the response points at where it can be downloaded once ready.
+func (cfg *apiConfig) handleStartDataExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	export, err := cfg.DB.GetPendingDataExport(r.Context(), database.GetPendingDataExportParams{
+		UserID:       userID,
+		StartedAfter: staleExportCutoff(),
+	})
+	if err == sql.ErrNoRows {
+		export, err = cfg.DB.CreateDataExport(r.Context(), userID)
+		if err == nil {
+			go cfg.buildDataExport(export.ID, userID)
+		}
+	}
+	if err != nil {
+		log.Printf("Error starting data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not start export")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/users/me/export/%s", export.ID))
+	respondWithJSON(w, http.StatusAccepted, dataExportFromDB(database.GetDataExportRow{
+		ID:        export.ID,
+		UserID:    export.UserID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt,
+	}))
+}
+
+// staleExportCutoff is when an export still pending must have started for its build to
+// still be running. Older ones were cut off, by a restart most likely, and never finish.
+func staleExportCutoff() time.Time {
+	return time.Now().UTC().Add(-buildExportTimeout)
+}
+
+// handleGetDataExport serves GET /api/users/me/export/{id}: the archive once it is ready,
+// and the export's status until then.
+func (cfg *apiConfig) handleGetDataExport(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	exportID, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "Invalid export ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	// Another user's export looks the same as one that does not exist
+	export, err := cfg.DB.GetDataExport(r.Context(), database.GetDataExportParams{
+		ID:     exportID,
+		UserID: userID,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Export not found")
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve export")
+		return
+	}
+	if export.Status == "pending" && !export.CreatedAt.After(staleExportCutoff()) {
+		// The sweep has yet to mark it failed
+		export.Status = "failed"
+	}
+
+	switch {
+	case export.Status == "pending":
+		respondWithJSON(w, http.StatusAccepted, dataExportFromDB(export))
+	case export.Status == "failed":
+		respondWithJSON(w, http.StatusOK, dataExportFromDB(export))
+	case export.ExpiresAt.Valid && !export.ExpiresAt.Time.After(time.Now().UTC()):
+		respondWithError(w, http.StatusGone, "Export has expired, start a new one")
+	default:
+		archive, err := cfg.DB.GetDataExportArchive(r.Context(), export.ID)
+		if err != nil {
+			log.Printf("Error retrieving data export archive: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not retrieve export")
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, export.CreatedAt.Format("2006-01-02")))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(archive)
+	}
+}
+
+// buildDataExport assembles the archive for an export and stores it, or marks the export
+// failed so the user can try again.
+func (cfg *apiConfig) buildDataExport(exportID, userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), buildExportTimeout)
+	defer cancel()
+
+	archive, err := cfg.exportArchive(ctx, userID)
+	if err == nil {
+		err = cfg.DB.CompleteDataExport(ctx, database.CompleteDataExportParams{
+			ID:        exportID,
+			Archive:   archive,
+			ExpiresAt: time.Now().UTC().Add(cfg.ExportExpiry),
+		})
+	}
+	if err != nil {
+		log.Printf("Error building data export %s: %s", exportID, err)
+		if err := cfg.DB.FailDataExport(context.Background(), exportID); err != nil {
+			log.Printf("Error marking data export %s failed: %s", exportID, err)
+		}
+	}
+}
+
+// exportArchive zips up everything held about a user: their profile, chirps as JSON and CSV,
+// active sessions and Chirpy Red subscription history.
+func (cfg *apiConfig) exportArchive(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	user, err := cfg.DB.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chirps, err := cfg.DB.GetChirpsByAuthor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := cfg.DB.ListActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := cfg.DB.ListSubscriptionEvents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := struct {
+		User
+		Roles []string `json:"roles"`
+	}{
+		User: User{
+			ID:            user.ID,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+			Email:         user.Email,
+			IsChirpyRed:   user.IsChirpyRed,
+			Username:      user.Username,
+			EmailVerified: user.EmailVerified,
+		},
+		Roles: user.Roles,
+	}
+	if profile.Roles == nil {
+		profile.Roles = []string{}
+	}
+
+	responseChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		responseChirps[i] = chirpFromDB(chirp)
+	}
+
+	responseSessions := make([]Session, len(sessions))
+	for i, session := range sessions {
+		responseSessions[i] = sessionFromDB(session)
+	}
+
+	responseEvents := make([]SubscriptionEvent, len(events))
+	for i, event := range events {
+		responseEvents[i] = SubscriptionEvent{Event: event.Event, CreatedAt: event.CreatedAt}
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"profile.json", jsonFile(profile)},
+		{"chirps.json", jsonFile(responseChirps)},
+		{"chirps.csv", chirpsCSV(chirps)},
+		{"sessions.json", jsonFile(responseSessions)},
+		{"subscriptions.json", jsonFile(responseEvents)},
+	}
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if err := file.write(f); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonFile writes v as indented JSON, for people reading the archive as much as programs.
+func jsonFile(v interface{}) func(io.Writer) error {
+	return func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+}
+
+// chirpsCSV writes chirps one per row, for opening in a spreadsheet.
+func chirpsCSV(chirps []database.Chirp) func(io.Writer) error {
+	return func(w io.Writer) error {
+		nullID := func(id uuid.NullUUID) string {
+			if !id.Valid {
+				return ""
+			}
+			return id.UUID.String()
+		}
+
+		out := csv.NewWriter(w)
+		out.Write([]string{"id", "created_at", "updated_at", "body", "in_reply_to", "rechirp_of", "quote_of", "deleted"})
+		for _, chirp := range chirps {
+			out.Write([]string{
+				chirp.ID.String(),
+				chirp.CreatedAt.Format(time.RFC3339),
+				chirp.UpdatedAt.Format(time.RFC3339),
+				chirp.Body,
+				nullID(chirp.ParentID),
+				nullID(chirp.RechirpOf),
+				nullID(chirp.QuoteOf),
+				strconv.FormatBool(chirp.DeletedAt.Valid),
+			})
+		}
+		out.Flush()
+		return out.Error()
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDataExport(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	s.chirp(alice.Token, "exported")
+
+	var started DataExport
+	resp := s.expect(http.StatusAccepted, http.MethodPost, "/api/users/me/export", alice.Token, nil, &started)
+	location := resp.Header.Get("Location")
+	if started.Status != "pending" || location == "" {
+		t.Fatalf("started export = %+v at %q", started, location)
+	}
+
+	// The archive is built in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp = s.do(http.MethodGet, location, alice.Token, nil)
+		if resp.StatusCode != http.StatusAccepted || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("export: got status %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("export is not a ZIP archive: %v", err)
+	}
+	if _, err := archive.Open("chirps.json"); err != nil {
+		t.Errorf("export has no chirps.json: %v", err)
+	}
+
+	bob := s.signup("bob@example.com", "bob")
+	s.expect(http.StatusNotFound, http.MethodGet, location, bob.Token, nil, nil)
+}
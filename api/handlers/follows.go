@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+type Follow struct {
+	PublicUser
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (cfg *apiConfig) handleFollowUser(w http.ResponseWriter, r *http.Request, followeeID uuid.UUID) {
+	followerID, ok := cfg.authenticatedUser(w, r, authy.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	if followerID == followeeID {
+		respondWithError(w, http.StatusBadRequest, "You cannot follow yourself")
+		return
+	}
+
+	// Make sure the account being followed exists
+	if !cfg.userExists(w, r, followeeID) {
+		return
+	}
+
+	// Following twice is a no-op thanks to ON CONFLICT DO NOTHING
+	err := cfg.DB.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error following user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not follow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleUnfollowUser(w http.ResponseWriter, r *http.Request, followeeID uuid.UUID) {
+	followerID, ok := cfg.authenticatedUser(w, r, authy.ScopeProfileWrite)
+	if !ok {
+		return
+	}
+
+	err := cfg.DB.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error unfollowing user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleListFollowers(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	if !cfg.userExists(w, r, userID) {
+		return
+	}
+
+	rows, err := cfg.DB.ListFollowers(r.Context(), database.ListFollowersParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving followers: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve followers")
+		return
+	}
+
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.FollowedAt, ID: last.ID}, page.Limit)
+	}
+
+	followers := make([]Follow, len(rows))
+	for i, row := range rows {
+		followers[i] = Follow{
+			PublicUser: PublicUser{
+				ID:          row.ID,
+				CreatedAt:   row.CreatedAt,
+				Username:    row.Username,
+				IsChirpyRed: row.IsChirpyRed,
+			},
+			FollowedAt: row.FollowedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, followers)
+}
+
+func (cfg *apiConfig) handleListFollowing(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	if !cfg.userExists(w, r, userID) {
+		return
+	}
+
+	rows, err := cfg.DB.ListFollowing(r.Context(), database.ListFollowingParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving followed users: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve followed users")
+		return
+	}
+
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.FollowedAt, ID: last.ID}, page.Limit)
+	}
+
+	following := make([]Follow, len(rows))
+	for i, row := range rows {
+		following[i] = Follow{
+			PublicUser: PublicUser{
+				ID:          row.ID,
+				CreatedAt:   row.CreatedAt,
+				Username:    row.Username,
+				IsChirpyRed: row.IsChirpyRed,
+			},
+			FollowedAt: row.FollowedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, following)
+}
+
+// userExists writes a 404 or 500 response and returns false when the user cannot be found.
+func (cfg *apiConfig) userExists(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	_, err := cfg.DB.GetUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return false
+	} else if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve user")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestListFollows(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	bob := s.signup("bob@example.com", "bob")
+
+	s.expect(http.StatusNoContent, http.MethodPost, "/api/users/"+bob.ID.String()+"/follow", alice.Token, nil, nil)
+
+	tests := []struct {
+		path string
+		want session
+	}{
+		{"/api/users/" + bob.ID.String() + "/followers", alice},
+		{"/api/users/" + alice.ID.String() + "/following", bob},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// Anyone can list follows, so they must not give away emails
+			var follows []map[string]interface{}
+			s.expect(http.StatusOK, http.MethodGet, tt.path, "", nil, &follows)
+			if len(follows) != 1 {
+				t.Fatalf("listed %d users, want 1", len(follows))
+			}
+			follow := follows[0]
+			if follow["id"] != tt.want.ID.String() || follow["username"] != tt.want.Username {
+				t.Errorf("listed %v, want %s", follow, tt.want.Username)
+			}
+			for _, field := range []string{"email", "email_verified", "updated_at"} {
+				if _, ok := follow[field]; ok {
+					t.Errorf("follow has a %s field: %v", field, follow)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ProjectEmu/chirpy/internal/store"
+)
+
+func TestMain(m *testing.M) {
+	// The handlers log every request they reject, which drowns out test failures
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testServer is the whole HTTP API on an in-memory store.
+type testServer struct {
+	t      *testing.T
+	server *httptest.Server
+	db     store.Store
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWithStore(t, store.NewMemory())
+}
+
+// newTestServerWithStore serves the API from db, for tests that need to watch the queries.
+func newTestServerWithStore(t *testing.T, db store.Store) *testServer {
+	t.Helper()
+	t.Setenv("MAIL_DIR", t.TempDir())
+	t.Setenv("LOGIN_ATTEMPT_STORE", "memory")
+
+	mux := http.NewServeMux()
+	SetupRoutes(mux, db, "dev", "test-secret")
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &testServer{t: t, server: server, db: db}
+}
+
+// do sends body, if any, as JSON with token as the bearer, if any.
+func (s *testServer) do(method, path, token string, body interface{}) *http.Response {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("encoding request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, s.server.URL+path, reader)
+	if err != nil {
+		s.t.Fatalf("building request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.server.Client().Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// expect sends a request like do, fails the test unless it gets status, and decodes the
+// response into out when out is not nil.
+func (s *testServer) expect(status int, method, path, token string, body, out interface{}) *http.Response {
+	s.t.Helper()
+	resp := s.do(method, path, token, body)
+	if resp.StatusCode != status {
+		data, _ := io.ReadAll(resp.Body)
+		s.t.Fatalf("%s %s: got status %d, want %d: %s", method, path, resp.StatusCode, status, data)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			s.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// session is a signed up and logged in user.
+type session struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	Password     string `json:"-"`
+}
+
+func (s *testServer) signup(email, username string) session {
+	s.t.Helper()
+	password := "hunter2-" + username
+	s.expect(http.StatusCreated, http.MethodPost, "/api/users", "", map[string]string{
+		"email":    email,
+		"password": password,
+		"username": username,
+	}, nil)
+	return s.login(email, password)
+}
+
+func (s *testServer) login(email, password string) session {
+	s.t.Helper()
+	var login session
+	s.expect(http.StatusOK, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, &login)
+	login.Password = password
+	return login
+}
+
+func (s *testServer) chirp(token, body string) Chirp {
+	s.t.Helper()
+	var chirp Chirp
+	s.expect(http.StatusCreated, http.MethodPost, "/api/chirps", token, map[string]string{"body": body}, &chirp)
+	return chirp
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ProjectEmu/chirpy/config"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	_ "github.com/lib/pq"
+)
+
+// A hashtag starts at the beginning of the body or after a character that cannot be part of a word,
+// so "a#b" and "&#39;" are not tags.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])#([\p{L}\p{N}_]+)`)
+
+type TrendingHashtag struct {
+	Tag        string `json:"tag"`
+	ChirpCount int64  `json:"chirp_count"`
+}
+
+// extractHashtags returns the distinct, normalized tags in a chirp body in the order they first appear.
+func extractHashtags(body string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag, ok := normalizeHashtag(match[1])
+		if !ok || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// normalizeHashtag lowercases a tag with or without its leading '#'.
+// Tags made only of digits and underscores are rejected, so "#1" stays plain text.
+func normalizeHashtag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	hasLetter := false
+	for _, r := range tag {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		} else if !unicode.IsDigit(r) && r != '_' {
+			return "", false
+		}
+	}
+	return tag, hasLetter
+}
+
+// handlerHashtags serves /api/hashtags/{tag}/chirps.
+func (cfg *apiConfig) handlerHashtags(w http.ResponseWriter, r *http.Request) {
+	tag, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/hashtags/"), "/")
+	if action != "chirps" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, ok := normalizeHashtag(tag)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	chirps, err := cfg.DB.ListHashtagChirps(r.Context(), database.ListHashtagChirpsParams{
+		Name:            name,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving hashtag chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve chirps")
+		return
+	}
+
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, page.Limit)
+	}
+
+	responseChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		responseChirps[i] = chirpFromDB(chirp)
+	}
+	if err := cfg.decorateChirps(r.Context(), cfg.viewerID(r), chirpRefs(responseChirps)); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, responseChirps)
+}
+
+// handlerTrendingHashtags ranks tags by the number of chirps using them within ?window= (e.g. 6h).
+func (cfg *apiConfig) handlerTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := config.TrendingWindow * time.Hour
+	if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+		parsed, err := time.ParseDuration(windowParam)
+		if err != nil || parsed <= 0 || parsed > config.MaxTrendingWindow*time.Hour {
+			respondWithError(w, http.StatusBadRequest, "Invalid window, use a duration such as 6h up to "+strconv.Itoa(config.MaxTrendingWindow)+"h")
+			return
+		}
+		window = parsed
+	}
+
+	limit := config.TrendingLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, config.MaxPageSize)
+	}
+
+	rows, err := cfg.DB.ListTrendingHashtags(r.Context(), database.ListTrendingHashtagsParams{
+		Since:    time.Now().UTC().Add(-window),
+		RowLimit: int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error retrieving trending hashtags: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve trending hashtags")
+		return
+	}
+
+	trending := make([]TrendingHashtag, len(rows))
+	for i, row := range rows {
+		trending[i] = TrendingHashtag{Tag: row.Name, ChirpCount: row.ChirpCount}
+	}
+
+	respondWithJSON(w, http.StatusOK, trending)
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/ProjectEmu/chirpy/internal/moderation"
+	"github.com/ProjectEmu/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// importedChirp is one entry of an import: a chirp as it appears in chirps.json of an export
+// archive, or one line of newline-delimited JSON.
+type importedChirp struct {
+	SourceID  string    `json:"source_id"`
+	ID        string    `json:"id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	InReplyTo *string   `json:"in_reply_to"`
+	RechirpOf *string   `json:"rechirp_of"`
+	QuoteOf   *string   `json:"quote_of"`
+	Deleted   bool      `json:"deleted"`
+}
+
+// ImportResult is what became of one entry of an import.
+type ImportResult struct {
+	Line     int        `json:"line"`
+	SourceID string     `json:"source_id,omitempty"`
+	Status   string     `json:"status"` // imported, duplicate, held or failed
+	ChirpID  *uuid.UUID `json:"chirp_id,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// ImportReport sums up an import, with a result for every entry.
+type ImportReport struct {
+	Imported   int            `json:"imported"`
+	Duplicates int            `json:"duplicates"`
+	Held       int            `json:"held"`
+	Failed     int            `json:"failed"`
+	Results    []ImportResult `json:"results"`
+}
+
+// errArchiveTooLarge is returned for an archive whose chirps.json decompresses to more than
+// an import may be.
+var errArchiveTooLarge = fmt.Errorf("chirps.json is over %d MB", config.MaxImportSize)
+
+// importLine is an entry read from the upload, or the reason it could not be read.
+type importLine struct {
+	Line  int
+	Chirp importedChirp
+	Err   error
+}
+
+// handlerImportChirps serves POST /api/chirps/import. It takes an export archive or
+// newline-delimited JSON and imports every entry it can, reporting on each one.
+func (cfg *apiConfig) handlerImportChirps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	upload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, config.MaxImportSize<<20))
+	if err != nil {
+		log.Printf("Error reading import: %s", err)
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Imports are limited to %d MB", config.MaxImportSize))
+		return
+	}
+
+	// Export archives are recognised by their contents, whatever the client says they are
+	var lines []importLine
+	if bytes.HasPrefix(upload, []byte("PK\x03\x04")) {
+		lines, err = readImportArchive(upload)
+	} else {
+		lines, err = readImportNDJSON(upload)
+	}
+	if err == errArchiveTooLarge {
+		respondWithError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report := ImportReport{Results: make([]ImportResult, 0, len(lines))}
+	for _, line := range lines {
+		result := ImportResult{Line: line.Line, SourceID: line.Chirp.sourceID()}
+		if line.Err == nil {
+			result = cfg.importChirp(r.Context(), userID, line.Line, line.Chirp)
+		} else {
+			result.Status, result.Error = "failed", line.Err.Error()
+		}
+
+		switch result.Status {
+		case "imported":
+			report.Imported++
+		case "duplicate":
+			report.Duplicates++
+		case "held":
+			report.Held++
+		default:
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// sourceID is what the entry is deduplicated on: an explicit source_id, or else its id.
+func (c importedChirp) sourceID() string {
+	if c.SourceID != "" {
+		return c.SourceID
+	}
+	return c.ID
+}
+
+// readImportArchive reads the chirps out of an export archive.
+func readImportArchive(upload []byte) ([]importLine, error) {
+	archive, err := zip.NewReader(bytes.NewReader(upload), int64(len(upload)))
+	if err != nil {
+		return nil, errors.New("import is not a valid ZIP archive")
+	}
+
+	f, err := archive.Open("chirps.json")
+	if err != nil {
+		return nil, errors.New("archive has no chirps.json")
+	}
+	defer f.Close()
+
+	// A small archive can inflate to any size, and the size in its header is only a claim, so
+	// the decompressed JSON is cut off just past the limit
+	limit := int64(config.MaxImportSize) << 20
+	if info, err := f.Stat(); err == nil && info.Size() > limit {
+		return nil, errArchiveTooLarge
+	}
+	chirpsJSON := &io.LimitedReader{R: f, N: limit + 1}
+
+	var entries []json.RawMessage
+	if err := json.NewDecoder(chirpsJSON).Decode(&entries); chirpsJSON.N == 0 {
+		return nil, errArchiveTooLarge
+	} else if err != nil {
+		return nil, errors.New("chirps.json is not a JSON array")
+	}
+
+	lines := make([]importLine, len(entries))
+	for i, entry := range entries {
+		lines[i] = importLine{Line: i + 1}
+		if err := json.Unmarshal(entry, &lines[i].Chirp); err != nil {
+			lines[i].Err = fmt.Errorf("invalid chirp: %w", err)
+		}
+	}
+	return lines, nil
+}
+
+// readImportNDJSON reads one chirp per line. Blank lines are skipped but still counted.
+func readImportNDJSON(upload []byte) ([]importLine, error) {
+	var lines []importLine
+	scanner := bufio.NewScanner(bytes.NewReader(upload))
+	// A line may be as long as the whole upload; one that is too long to import fails on its own
+	scanner.Buffer(nil, config.MaxImportSize<<20+1)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		line := importLine{Line: n}
+		if err := json.Unmarshal([]byte(text), &line.Chirp); err != nil {
+			line.Err = fmt.Errorf("invalid JSON: %w", err)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read import: %w", err)
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("import has no chirps")
+	}
+	return lines, nil
+}
+
+// importChirp validates one entry the way a new chirp is validated and stores it with its
+// original timestamps. Replies and quotes may point at chirps from earlier in the import.
+func (cfg *apiConfig) importChirp(ctx context.Context, userID uuid.UUID, line int, entry importedChirp) ImportResult {
+	result := ImportResult{Line: line, SourceID: entry.sourceID()}
+	fail := func(format string, args ...interface{}) ImportResult {
+		result.Status, result.Error = "failed", fmt.Sprintf(format, args...)
+		return result
+	}
+
+	switch {
+	case result.SourceID == "":
+		return fail("Chirp has no id or source_id to deduplicate on")
+	case entry.Deleted:
+		return fail("Deleted chirps are not imported")
+	case entry.RechirpOf != nil:
+		return fail("Rechirps are not imported")
+	case len(entry.Body) > config.MaxChirpLength:
+		return fail("Chirp is too long")
+	case entry.QuoteOf != nil && strings.TrimSpace(entry.Body) == "":
+		return fail("A quote chirp needs a body")
+	case entry.CreatedAt.IsZero():
+		return fail("Chirp has no created_at")
+	case entry.CreatedAt.After(time.Now()):
+		return fail("Chirp was created in the future")
+	}
+	if entry.UpdatedAt.Before(entry.CreatedAt) {
+		entry.UpdatedAt = entry.CreatedAt
+	}
+
+	existing, err := cfg.DB.GetImportedChirpID(ctx, database.GetImportedChirpIDParams{
+		UserID:   userID,
+		SourceID: result.SourceID,
+	})
+	if err == nil {
+		result.Status, result.ChirpID = "duplicate", &existing
+		return result
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error checking for imported chirp: %s", err)
+		return fail("Could not import chirp")
+	}
+	// Importing an export on the server it came from finds the chirps still there
+	if chirpID, err := uuid.Parse(entry.ID); err == nil {
+		own, err := cfg.DB.GetChirp(ctx, chirpID)
+		if err == nil && own.UserID == userID {
+			result.Status, result.ChirpID = "duplicate", &own.ID
+			return result
+		} else if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error checking for existing chirp: %s", err)
+			return fail("Could not import chirp")
+		}
+	}
+	if _, err := cfg.DB.GetHeldImportID(ctx, database.GetHeldImportIDParams{
+		UserID:   userID,
+		SourceID: result.SourceID,
+	}); err == nil {
+		// Imported before and still waiting for review
+		result.Status = "duplicate"
+		return result
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error checking for held imported chirp: %s", err)
+		return fail("Could not import chirp")
+	}
+
+	params := database.ImportChirpParams{
+		Body:      entry.Body,
+		CreatedAt: entry.CreatedAt.UTC(),
+		UpdatedAt: entry.UpdatedAt.UTC(),
+		UserID:    userID,
+	}
+	if entry.QuoteOf != nil {
+		original, err := cfg.importedChirpRef(ctx, userID, *entry.QuoteOf)
+		if err == sql.ErrNoRows {
+			return fail("Chirp being quoted was not found")
+		} else if err != nil {
+			log.Printf("Error retrieving quoted chirp: %s", err)
+			return fail("Could not import chirp")
+		}
+		params.QuoteOf = uuid.NullUUID{UUID: original.ID, Valid: true}
+	}
+	if entry.InReplyTo != nil {
+		parent, err := cfg.importedChirpRef(ctx, userID, *entry.InReplyTo)
+		if err == sql.ErrNoRows {
+			return fail("Chirp being replied to was not found")
+		} else if err != nil {
+			log.Printf("Error retrieving parent chirp: %s", err)
+			return fail("Could not import chirp")
+		}
+		params.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		params.RootID = parent.RootID
+		if !parent.RootID.Valid {
+			params.RootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	// Held chirps wait for review like any other, keeping their source ID and timestamps for
+	// when they are approved
+	verdict := cfg.Moderator.Moderate(entry.Body)
+	if verdict.Action == moderation.Reject {
+		return fail("Chirp violates the content rules: %s", strings.Join(verdict.Rules(moderation.Reject), ", "))
+	}
+	// Masking can lengthen a body, so the limit applies to what would be stored as well
+	if len(verdict.Body) > config.MaxChirpLength {
+		return fail("Chirp is too long")
+	}
+	switch verdict.Action {
+	case moderation.Hold:
+		_, err := cfg.DB.HoldChirp(ctx, database.HoldChirpParams{
+			UserID:          userID,
+			Body:            verdict.Body,
+			ParentID:        params.ParentID,
+			QuoteOf:         params.QuoteOf,
+			Reason:          strings.Join(verdict.Rules(moderation.Hold), ", "),
+			SourceID:        sql.NullString{String: result.SourceID, Valid: true},
+			SourceCreatedAt: sql.NullTime{Time: params.CreatedAt, Valid: true},
+			SourceUpdatedAt: sql.NullTime{Time: params.UpdatedAt, Valid: true},
+		})
+		if _, ok := store.UniqueViolation(err); ok {
+			// Another import of the same chirp got there first
+			result.Status = "duplicate"
+			return result
+		} else if err != nil {
+			log.Printf("Error holding imported chirp for review: %s", err)
+			return fail("Could not import chirp")
+		}
+		result.Status = "held"
+		return result
+	}
+	params.Body = verdict.Body
+
+	chirp, err := cfg.storeImportedChirp(ctx, result.SourceID, params)
+	if _, ok := store.UniqueViolation(err); ok {
+		// Another import of the same chirp got there first
+		result.Status = "duplicate"
+		return result
+	} else if err != nil {
+		log.Printf("Error importing chirp: %s", err)
+		return fail("Could not import chirp")
+	}
+
+	result.Status, result.ChirpID = "imported", &chirp.ID
+	return result
+}
+
+// importedChirpRef finds the chirp a reply or quote in an import points at: one imported
+// earlier under that source ID, or else an existing chirp with that ID.
+func (cfg *apiConfig) importedChirpRef(ctx context.Context, userID uuid.UUID, ref string) (database.Chirp, error) {
+	chirpID, err := cfg.DB.GetImportedChirpID(ctx, database.GetImportedChirpIDParams{
+		UserID:   userID,
+		SourceID: ref,
+	})
+	if err == sql.ErrNoRows {
+		chirpID, err = uuid.Parse(ref)
+		if err != nil {
+			return database.Chirp{}, sql.ErrNoRows
+		}
+	} else if err != nil {
+		return database.Chirp{}, err
+	}
+	return cfg.shareableChirp(ctx, chirpID)
+}
+
+// storeImportedChirp creates the chirp and remembers its source ID, in a single transaction.
+func (cfg *apiConfig) storeImportedChirp(ctx context.Context, sourceID string, params database.ImportChirpParams) (database.Chirp, error) {
+	tx, err := cfg.DB.BeginTx(ctx)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp, err := tx.ImportChirp(ctx, params)
+	if err == nil {
+		err = indexChirp(ctx, tx, chirp)
+	}
+	if err == nil {
+		err = tx.RecordChirpImport(ctx, database.RecordChirpImportParams{
+			UserID:   params.UserID,
+			SourceID: sourceID,
+			ChirpID:  chirp.ID,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProjectEmu/chirpy/config"
+)
+
+// importChirps posts an upload to the import endpoint.
+func (s *testServer) importChirps(token string, upload []byte) *http.Response {
+	s.t.Helper()
+	req, err := http.NewRequest(http.MethodPost, s.server.URL+"/api/chirps/import", bytes.NewReader(upload))
+	if err != nil {
+		s.t.Fatalf("building request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := s.server.Client().Do(req)
+	if err != nil {
+		s.t.Fatalf("importing chirps: %v", err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestImportHeldChirpsAreDeduplicated(t *testing.T) {
+	words := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(words, []byte("sharbert hold\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MODERATION_WORDS_FILE", words)
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	upload := []byte(`{"source_id": "1", "body": "a sharbert", "created_at": "2020-01-02T03:04:05Z"}` + "\n")
+	for _, want := range []string{"held", "duplicate"} {
+		resp := s.importChirps(alice.Token, upload)
+		var report ImportReport
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("import: status %d, %v", resp.StatusCode, err)
+		}
+		if len(report.Results) != 1 || report.Results[0].Status != want {
+			t.Errorf("import result = %+v, want %s", report.Results, want)
+		}
+	}
+}
+
+func TestImportArchiveIsLimitedOnceDecompressed(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	// Spaces compress to almost nothing, so the archive itself is well under the limit
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, err := zw.Create("chirps.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("["))
+	f.Write([]byte(strings.Repeat(" ", config.MaxImportSize<<20)))
+	f.Write([]byte("]"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := s.importChirps(alice.Token, archive.Bytes()); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("importing an archive that inflates past the limit: got status %d, want 413", resp.StatusCode)
+	}
+}
+
+// importReport posts NDJSON and decodes the report.
+func (s *testServer) importReport(token, upload string) ImportReport {
+	s.t.Helper()
+	resp := s.importChirps(token, []byte(upload))
+	var report ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil || resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("import: status %d, %v", resp.StatusCode, err)
+	}
+	return report
+}
+
+func TestImportLongLineFailsOnItsOwn(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	// Longer than a bufio.Scanner reads by default
+	long := strings.Repeat("a", 100<<10)
+	report := s.importReport(alice.Token, `{"source_id": "1", "body": "before", "created_at": "2020-01-02T03:04:05Z"}`+"\n"+
+		`{"source_id": "2", "body": "`+long+`", "created_at": "2020-01-02T03:04:05Z"}`+"\n"+
+		`{"source_id": "3", "body": "after", "created_at": "2020-01-02T03:04:05Z"}`+"\n")
+
+	var statuses []string
+	for _, result := range report.Results {
+		statuses = append(statuses, result.Status)
+	}
+	if strings.Join(statuses, ",") != "imported,failed,imported" || report.Results[1].Error != "Chirp is too long" {
+		t.Errorf("import results = %+v", report.Results)
+	}
+}
+
+func TestImportOwnChirpsAreDuplicates(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	bob := s.signup("bob@example.com", "bob")
+	chirp := s.chirp(alice.Token, "hello")
+
+	upload := `{"id": "` + chirp.ID.String() + `", "body": "hello", "created_at": "2020-01-02T03:04:05Z"}` + "\n"
+	report := s.importReport(alice.Token, upload)
+	if report.Duplicates != 1 || report.Results[0].ChirpID == nil || *report.Results[0].ChirpID != chirp.ID {
+		t.Errorf("reimporting an own chirp = %+v, want a duplicate of %s", report.Results, chirp.ID)
+	}
+
+	// Someone else's chirp is theirs to copy
+	if report := s.importReport(bob.Token, upload); report.Imported != 1 {
+		t.Errorf("importing another user's chirp = %+v, want it imported", report.Results)
+	}
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// handlerJWKS publishes the public keys access tokens can be verified with.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Short enough that a newly added key is picked up well before it starts signing
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.Keys.JWKS())
+}
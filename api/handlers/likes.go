@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+type Liker struct {
+	PublicUser
+	LikedAt time.Time `json:"liked_at"`
+}
+
+type LikedChirp struct {
+	Chirp
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// viewerID returns the user behind an optional bearer token. Anonymous or invalid
+// tokens yield an invalid NullUUID rather than an error, since the caller can still be served.
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.NullUUID {
+	bearer, err := authy.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	userID, err := cfg.authenticate(r.Context(), bearer, authy.ScopeChirpsRead)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
+// attachLikes fills in like_count for every chirp, and liked_by_me when the viewer is known.
+func (cfg *apiConfig) attachLikes(ctx context.Context, viewer uuid.NullUUID, chirps []*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+
+	stats, err := cfg.DB.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{
+		ViewerID: viewer,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID]database.GetChirpLikeStatsRow, len(stats))
+	for _, stat := range stats {
+		byChirp[stat.ChirpID] = stat
+	}
+
+	for _, chirp := range chirps {
+		stat := byChirp[chirp.ID]
+		chirp.LikeCount = stat.LikeCount
+		if viewer.Valid {
+			likedByMe := stat.LikedByViewer
+			chirp.LikedByMe = &likedByMe
+		}
+	}
+	return nil
+}
+
+// chirpRefs returns pointers into a slice so decorateChirps can update it in place.
+func chirpRefs(chirps []Chirp) []*Chirp {
+	refs := make([]*Chirp, len(chirps))
+	for i := range chirps {
+		refs[i] = &chirps[i]
+	}
+	return refs
+}
+
+func (cfg *apiConfig) handlerChirpLike(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := chirpIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err = cfg.DB.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+			UserID:  userID,
+			ChirpID: chirpID,
+		})
+		if err != nil {
+			log.Printf("Error unliking chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not unlike chirp")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Only live chirps can be liked
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err == sql.ErrNoRows || (err == nil && chirp.DeletedAt.Valid) {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp by ID: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	// Liking twice is a no-op thanks to ON CONFLICT DO NOTHING
+	err = cfg.DB.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Error liking chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not like chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleGetChirpLikers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := chirpIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	_, err = cfg.DB.GetChirp(r.Context(), chirpID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp by ID: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	rows, err := cfg.DB.ListChirpLikers(r.Context(), database.ListChirpLikersParams{
+		ChirpID:         chirpID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving chirp likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve likes")
+		return
+	}
+
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.LikedAt, ID: last.ID}, page.Limit)
+	}
+
+	likers := make([]Liker, len(rows))
+	for i, row := range rows {
+		likers[i] = Liker{
+			PublicUser: PublicUser{
+				ID:          row.ID,
+				CreatedAt:   row.CreatedAt,
+				Username:    row.Username,
+				IsChirpyRed: row.IsChirpyRed,
+			},
+			LikedAt: row.LikedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, likers)
+}
+
+func (cfg *apiConfig) handleListLikedChirps(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	if !cfg.userExists(w, r, userID) {
+		return
+	}
+
+	rows, err := cfg.DB.ListLikedChirps(r.Context(), database.ListLikedChirpsParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving liked chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve liked chirps")
+		return
+	}
+
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.LikedAt, ID: last.Chirp.ID}, page.Limit)
+	}
+
+	likedChirps := make([]LikedChirp, len(rows))
+	refs := make([]*Chirp, len(rows))
+	for i, row := range rows {
+		likedChirps[i] = LikedChirp{Chirp: chirpFromDB(row.Chirp), LikedAt: row.LikedAt}
+		refs[i] = &likedChirps[i].Chirp
+	}
+
+	if err := cfg.decorateChirps(r.Context(), cfg.viewerID(r), refs); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve liked chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, likedChirps)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestListChirpLikers(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	bob := s.signup("bob@example.com", "bob")
+
+	chirp := s.chirp(alice.Token, "like me")
+	path := "/api/chirps/" + chirp.ID.String()
+	for _, liker := range []session{alice, bob} {
+		s.expect(http.StatusNoContent, http.MethodPut, path+"/like", liker.Token, nil, nil)
+	}
+
+	// Anyone can list the likers, so they must not give away emails
+	var likers []map[string]interface{}
+	s.expect(http.StatusOK, http.MethodGet, path+"/likes", "", nil, &likers)
+	if len(likers) != 2 || likers[0]["username"] != "bob" || likers[1]["username"] != "alice" {
+		t.Fatalf("likers = %v, want bob then alice", likers)
+	}
+	for _, liker := range likers {
+		for _, field := range []string{"email", "email_verified", "updated_at"} {
+			if _, ok := liker[field]; ok {
+				t.Errorf("liker has a %s field: %v", field, liker)
+			}
+		}
+	}
+}
@@ -4,14 +4,16 @@ import (
 	"database/sql"
 	"encoding/json"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ProjectEmu/chirpy/config"
 	authy "github.com/ProjectEmu/chirpy/internal/auth"
-	"github.com/ProjectEmu/chirpy/internal/database"
 
 	_ "github.com/lib/pq"
 )
@@ -41,11 +43,24 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		expires = req.Expires
 	}
 
+	// Throttle repeated failures from this client and against this account
+	ip, account := clientIP(r), loginAccount(req.Email)
+	wait, err := cfg.LoginGuard.Check(r.Context(), ip, account)
+	if err != nil {
+		log.Printf("Error checking login attempts: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not log in")
+		return
+	}
+	if wait > 0 {
+		respondWithRetryAfter(w, wait, "Too many failed login attempts, try again later")
+		return
+	}
+
 	// Use SQLC's AuthUser method
 	user, err := cfg.DB.AuthUser(r.Context(), req.Email)
 	if err == sql.ErrNoRows {
 		log.Printf("User not found for email: %s", req.Email)
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+		cfg.loginFailed(w, r, ip, account)
 		return
 	} else if err != nil {
 		log.Printf("Error retrieving user: %s", err)
@@ -57,7 +72,7 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 	err = authy.CheckPasswordHash(req.Password, user.HashedPassword)
 	if err != nil {
 		if err == bcrypt.ErrMismatchedHashAndPassword {
-			respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+			cfg.loginFailed(w, r, ip, account)
 		} else {
 			log.Printf("Unexpected error during password hash check: %s", err)
 			respondWithError(w, http.StatusInternalServerError, "Could not verify password")
@@ -65,43 +80,101 @@ func (cfg *apiConfig) handlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only tell someone the account is suspended once they have shown it is theirs
+	if user.SuspendedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "This account has been suspended")
+		return
+	}
+
+	// With two-factor authentication on, the password only earns a challenge for the second step
+	totp, err := cfg.DB.GetUserTOTP(r.Context(), user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error retrieving two-factor settings: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve user")
+		return
+	}
+	if err == nil && totp.ConfirmedAt.Valid {
+		cfg.startMFAChallenge(w, r, user.ID)
+		return
+	}
+
+	cfg.completeLogin(w, r, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+	}, user.Roles, expires)
+}
+
+// loginAccount is the key LoginGuard counts an account's failed logins under.
+func loginAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginFailed counts a wrong email or password and answers it. The answer is the same
+// for both so it does not reveal which addresses have accounts.
+func (cfg *apiConfig) loginFailed(w http.ResponseWriter, r *http.Request, ip, account string) {
+	if err := cfg.LoginGuard.Failure(r.Context(), ip, account); err != nil {
+		log.Printf("Error recording failed login: %s", err)
+	}
+	respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
+}
+
+// respondWithRetryAfter answers with a 429 telling the client how many seconds to wait.
+func respondWithRetryAfter(w http.ResponseWriter, wait time.Duration, msg string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, msg)
+}
+
+// completeLogin issues an access token carrying the user's roles and starts a session with a new refresh token.
+// Logging in also keeps an account that was scheduled for deletion, and clears its failed logins.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user User, roles []string, expires int) {
+	cancelled, err := cfg.DB.CancelAccountDeletion(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Could not cancel account deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not log in")
+		return
+	}
+	if cancelled > 0 {
+		log.Printf("Deletion of account %s was cancelled by logging in", user.ID)
+	}
+
 	// Get access token
-	token, err := authy.MakeJWT(user.ID, cfg.JWTSecret, time.Duration(expires)*time.Second)
+	token, err := cfg.Keys.MakeJWT(user.ID, roles, time.Duration(expires)*time.Second)
 	if err != nil {
 		log.Printf("Could not fetch JWT: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not fetch JWT")
+		return
 	}
 	// Get refresh token
 	refresh_token, err := authy.MakeRefreshToken()
 	if err != nil {
 		log.Printf("Could not fetch refresh token: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not fetch refresh token")
+		return
 	}
-	// Store refresh token
-	expiryDate := time.Now().AddDate(0, 0, config.RefreshTokenDuration)
-	request_tokenParams := database.CreateRefreshTokenParams{
-		Token:     refresh_token,
-		UserID:    user.ID,
-		ExpiresAt: expiryDate,
-	}
-	_, err = cfg.DB.CreateRefreshToken(r.Context(), request_tokenParams)
-	if err != nil {
+	// Start a session and store the first refresh token of its family
+	if err := cfg.startSession(r, user.ID, refresh_token); err != nil {
 		log.Printf("Could not store refresh token: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not store refresh token")
+		return
+	}
+	if err := cfg.LoginGuard.Success(r.Context(), loginAccount(user.Email)); err != nil {
+		log.Printf("Error clearing failed login attempts: %s", err)
 	}
-	// Map database.User to the User struct to control JSON keys
+	// Respond with the user alongside both tokens
 	var responseUser struct {
 		User
 		Token         string `json:"token"`
 		Refresh_Token string `json:"refresh_token"`
 	}
-	responseUser.ID = user.ID
-	responseUser.CreatedAt = user.CreatedAt
-	responseUser.UpdatedAt = user.UpdatedAt
-	responseUser.Email = user.Email
+	responseUser.User = user
 	responseUser.Token = token
 	responseUser.Refresh_Token = refresh_token
-	responseUser.IsChirpyRed = user.IsChirpyRed
 
 	respondWithJSON(w, http.StatusOK, responseUser)
 }
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// securityLog collects the security events logged until the end of the test.
+func securityLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(io.Discard) })
+	return &buf
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	if alice.Token == "" || alice.RefreshToken == "" {
+		t.Fatalf("login returned no tokens: %+v", alice)
+	}
+	if alice.Email != "alice@example.com" || alice.Username != "alice" {
+		t.Errorf("logged in user = %+v", alice.User)
+	}
+
+	// The access token is good for authenticated endpoints
+	s.chirp(alice.Token, "hello")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"wrong password", "alice@example.com", "wrong"},
+		{"unknown email", "nobody@example.com", alice.Password},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp errorResponse
+			s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login", "", map[string]string{
+				"email":    tt.email,
+				"password": tt.password,
+			}, &resp)
+			// Both answer the same, so neither reveals which emails have accounts
+			if resp.Error != "Incorrect email or password" {
+				t.Errorf("error = %q", resp.Error)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	type tokens struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	var first tokens
+	s.expect(http.StatusOK, http.MethodPost, "/api/refresh", alice.RefreshToken, nil, &first)
+	if first.Token == "" || first.RefreshToken == "" || first.RefreshToken == alice.RefreshToken {
+		t.Fatalf("refresh did not rotate the token: %+v", first)
+	}
+	s.chirp(first.Token, "refreshed")
+
+	var second tokens
+	s.expect(http.StatusOK, http.MethodPost, "/api/refresh", first.RefreshToken, nil, &second)
+
+	// Presenting a rotated token again revokes the whole family, the latest token included
+	logged := securityLog(t)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/refresh", alice.RefreshToken, nil, nil)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/refresh", second.RefreshToken, nil, nil)
+	if n := strings.Count(logged.String(), "SECURITY:"); n != 1 {
+		t.Errorf("logged %d security events for one reused token, want 1", n)
+	}
+
+	// Other sessions are left alone
+	other := s.login("alice@example.com", alice.Password)
+	s.expect(http.StatusOK, http.MethodPost, "/api/refresh", other.RefreshToken, nil, nil)
+
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/refresh", "not-a-token", nil, nil)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/refresh", "", nil, nil)
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	s.expect(http.StatusNoContent, http.MethodPost, "/api/revoke", alice.RefreshToken, nil, nil)
+
+	// A token from a session that was logged out is stale, not stolen
+	logged := securityLog(t)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/refresh", alice.RefreshToken, nil, nil)
+	if strings.Contains(logged.String(), "SECURITY:") {
+		t.Errorf("refreshing with a logged out token was logged as reuse: %s", logged)
+	}
+}
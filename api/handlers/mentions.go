@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// A mention starts at the beginning of the body or after a character that cannot be part of a
+// handle, so email addresses such as "a@b.com" are not mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@])@([A-Za-z0-9_]+)`)
+
+type Mention struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// extractMentions returns the distinct, lowercased handles mentioned in a chirp body.
+func extractMentions(body string) []string {
+	handles := []string{}
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(match[1])
+		if !usernamePattern.MatchString(handle) || seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+	}
+	return handles
+}
+
+// attachMentions fills in the users each chirp mentions, as resolved when it was written.
+func (cfg *apiConfig) attachMentions(ctx context.Context, chirps []*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+
+	rows, err := cfg.DB.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID][]Mention, len(chirps))
+	for _, row := range rows {
+		byChirp[row.ChirpID] = append(byChirp[row.ChirpID], Mention{UserID: row.UserID, Username: row.Username})
+	}
+
+	for _, chirp := range chirps {
+		if mentions, ok := byChirp[chirp.ID]; ok {
+			chirp.Mentions = mentions
+		}
+	}
+	return nil
+}
+
+// handleListMentions lists chirps mentioning the authenticated user, newest first.
+func (cfg *apiConfig) handleListMentions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	chirps, err := cfg.DB.ListMentionChirps(r.Context(), database.ListMentionChirpsParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving mentions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve mentions")
+		return
+	}
+
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, page.Limit)
+	}
+
+	responseChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		responseChirps[i] = chirpFromDB(chirp)
+	}
+	if err := cfg.decorateChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, chirpRefs(responseChirps)); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve mentions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, responseChirps)
+}
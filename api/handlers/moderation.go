@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/ProjectEmu/chirpy/internal/moderation"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// HeldChirp is a new chirp or an edit waiting in the moderation queue.
+type HeldChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	Status    string     `json:"status"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ChirpID   *uuid.UUID `json:"chirp_id,omitempty"`
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+	QuoteOf   *uuid.UUID `json:"quote_of,omitempty"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func heldChirpFromDB(held database.ModerationQueue) HeldChirp {
+	responseHeld := HeldChirp{
+		ID:        held.ID,
+		Status:    "held",
+		UserID:    held.UserID,
+		Body:      held.Body,
+		Reason:    held.Reason,
+		CreatedAt: held.CreatedAt,
+	}
+	if held.ChirpID.Valid {
+		responseHeld.ChirpID = &held.ChirpID.UUID
+	}
+	if held.ParentID.Valid {
+		responseHeld.InReplyTo = &held.ParentID.UUID
+	}
+	if held.QuoteOf.Valid {
+		responseHeld.QuoteOf = &held.QuoteOf.UUID
+	}
+	return responseHeld
+}
+
+// moderateChirp runs a chirp body through the moderator and returns the body to store.
+// A rejected chirp gets a 422, one whose masked body is too long a 400, and a held one is
+// queued for review with a 202; in each case the response has been written and ok is false.
+func (cfg *apiConfig) moderateChirp(w http.ResponseWriter, r *http.Request, hold database.HoldChirpParams) (string, bool) {
+	verdict := cfg.Moderator.Moderate(hold.Body)
+
+	if verdict.Action == moderation.Reject {
+		respondWithJSON(w, http.StatusUnprocessableEntity, struct {
+			Error string   `json:"error"`
+			Rules []string `json:"rules"`
+		}{
+			Error: "Chirp violates the content rules",
+			Rules: verdict.Rules(moderation.Reject),
+		})
+		return "", false
+	}
+
+	// Masking can lengthen a body, so the limit applies to what would be stored as well
+	if len(verdict.Body) > config.MaxChirpLength {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+		return "", false
+	}
+
+	if verdict.Action == moderation.Hold {
+		// Masks still apply once the chirp is approved
+		hold.Body = verdict.Body
+		hold.Reason = strings.Join(verdict.Rules(moderation.Hold), ", ")
+		held, err := cfg.DB.HoldChirp(r.Context(), hold)
+		if err != nil {
+			log.Printf("Error holding chirp for review: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not chirp")
+			return "", false
+		}
+		respondWithJSON(w, http.StatusAccepted, heldChirpFromDB(held))
+		return "", false
+	}
+
+	return verdict.Body, true
+}
+
+// handlerModerationQueue lists held chirps, oldest first.
+func (cfg *apiConfig) handlerModerationQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	queue, err := cfg.DB.ListHeldChirps(r.Context(), database.ListHeldChirpsParams{
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving moderation queue: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve moderation queue")
+		return
+	}
+
+	if len(queue) > page.Limit {
+		queue = queue[:page.Limit]
+		last := queue[len(queue)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, page.Limit)
+	}
+
+	responseQueue := make([]HeldChirp, len(queue))
+	for i, held := range queue {
+		responseQueue[i] = heldChirpFromDB(held)
+	}
+
+	respondWithJSON(w, http.StatusOK, responseQueue)
+}
+
+// handlerModerationDecision serves POST /admin/moderation/{id}/approve and /reject.
+func (cfg *apiConfig) handlerModerationDecision(w http.ResponseWriter, r *http.Request) {
+	id, decision, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/moderation/"), "/")
+	if decision != "approve" && decision != "reject" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	heldID, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "Invalid held chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	held, err := cfg.DB.GetHeldChirp(r.Context(), heldID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Held chirp not found")
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving held chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	if decision == "reject" {
+		if err := cfg.DB.DeleteHeldChirp(r.Context(), held.ID); err != nil {
+			log.Printf("Error deleting held chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not reject chirp")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var chirp database.Chirp
+	if held.ChirpID.Valid {
+		chirp, err = cfg.approveHeldEdit(r, held)
+	} else {
+		chirp, err = cfg.approveHeldChirp(r, held)
+	}
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusConflict, "The chirp this depends on has been deleted")
+		return
+	} else if err != nil {
+		log.Printf("Error approving held chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not approve chirp")
+		return
+	}
+
+	if err := cfg.DB.DeleteHeldChirp(r.Context(), held.ID); err != nil {
+		log.Printf("Error deleting held chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not approve chirp")
+		return
+	}
+
+	responseChirp := chirpFromDB(chirp)
+	if err := cfg.decorateChirps(r.Context(), uuid.NullUUID{}, []*Chirp{&responseChirp}); err != nil {
+		log.Printf("Error decorating chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not approve chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, responseChirp)
+}
+
+// approveHeldChirp publishes a held new chirp. Its reply and quote targets are looked up
+// again since they may have been deleted while it waited, which yields sql.ErrNoRows.
+// An imported chirp keeps its original timestamps and is recorded as imported.
+func (cfg *apiConfig) approveHeldChirp(r *http.Request, held database.ModerationQueue) (database.Chirp, error) {
+	params := database.CreateChirpParams{
+		Body:    held.Body,
+		UserID:  held.UserID,
+		QuoteOf: held.QuoteOf,
+	}
+
+	if held.QuoteOf.Valid {
+		if _, err := cfg.shareableChirp(r.Context(), held.QuoteOf.UUID); err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	if held.ParentID.Valid {
+		parent, err := cfg.shareableChirp(r.Context(), held.ParentID.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		params.ParentID = held.ParentID
+		params.RootID = parent.RootID
+		if !parent.RootID.Valid {
+			params.RootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	if held.SourceID.Valid {
+		return cfg.storeImportedChirp(r.Context(), held.SourceID.String, database.ImportChirpParams{
+			Body:      params.Body,
+			CreatedAt: held.SourceCreatedAt.Time,
+			UpdatedAt: held.SourceUpdatedAt.Time,
+			UserID:    params.UserID,
+			ParentID:  params.ParentID,
+			RootID:    params.RootID,
+			QuoteOf:   params.QuoteOf,
+		})
+	}
+	return cfg.createChirp(r.Context(), params)
+}
+
+// approveHeldEdit applies a held edit, unless the chirp has been deleted in the meantime.
+func (cfg *apiConfig) approveHeldEdit(r *http.Request, held database.ModerationQueue) (database.Chirp, error) {
+	chirp, err := cfg.DB.GetChirp(r.Context(), held.ChirpID.UUID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+
+	return cfg.editChirp(r.Context(), chirp.ID, held.Body)
+}
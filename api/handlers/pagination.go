@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	"github.com/google/uuid"
+)
+
+// pageCursor marks a position in a list ordered by (created_at, id), or by
+// (rank, created_at, id) for relevance-ordered search results.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	Rank      *float32
+}
+
+// pageRequest holds the parsed cursor and limit query parameters.
+type pageRequest struct {
+	Cursor *pageCursor
+	Limit  int
+}
+
+// encodeCursor turns a cursor into an opaque, URL-safe string.
+func encodeCursor(c pageCursor) string {
+	raw := fmt.Sprintf("%d|%s", c.CreatedAt.UnixMicro(), c.ID)
+	if c.Rank != nil {
+		raw += "|" + strconv.FormatFloat(float64(*c.Rank), 'g', -1, 32)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor reverses encodeCursor.
+func decodeCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errors.New("cursor is not valid base64")
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 2 && len(parts) != 3 {
+		return pageCursor{}, errors.New("cursor is malformed")
+	}
+	micros, id := parts[0], parts[1]
+
+	usec, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return pageCursor{}, errors.New("cursor timestamp is malformed")
+	}
+
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, errors.New("cursor id is malformed")
+	}
+
+	cursor := pageCursor{CreatedAt: time.UnixMicro(usec).UTC(), ID: parsedID}
+	if len(parts) == 3 {
+		rank, err := strconv.ParseFloat(parts[2], 32)
+		if err != nil {
+			return pageCursor{}, errors.New("cursor rank is malformed")
+		}
+		rank32 := float32(rank)
+		cursor.Rank = &rank32
+	}
+
+	return cursor, nil
+}
+
+// parsePageRequest reads the cursor and limit query parameters, applying the configured defaults.
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	page := pageRequest{Limit: config.DefaultPageSize}
+
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = min(limit, config.MaxPageSize)
+	}
+
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		cursor, err := decodeCursor(cursorParam)
+		if err != nil {
+			return page, err
+		}
+		page.Cursor = &cursor
+	}
+
+	return page, nil
+}
+
+// fetchLimit asks the database for one extra row so we know whether another page exists.
+func (p pageRequest) fetchLimit() int32 {
+	return int32(p.Limit + 1)
+}
+
+func (p pageRequest) cursorCreatedAt() sql.NullTime {
+	if p.Cursor == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: p.Cursor.CreatedAt, Valid: true}
+}
+
+func (p pageRequest) cursorRank() sql.NullFloat64 {
+	if p.Cursor == nil || p.Cursor.Rank == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: float64(*p.Cursor.Rank), Valid: true}
+}
+
+func (p pageRequest) cursorID() uuid.NullUUID {
+	if p.Cursor == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: p.Cursor.ID, Valid: true}
+}
+
+// setNextPageLink advertises the next page through a Link header, keeping every other query parameter intact.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, next pageCursor, limit int) {
+	nextURL := *r.URL
+	query := nextURL.Query()
+	query.Set("cursor", encodeCursor(next))
+	query.Set("limit", strconv.Itoa(limit))
+	nextURL.RawQuery = query.Encode()
+
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
+}
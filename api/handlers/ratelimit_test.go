@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ProjectEmu/chirpy/config"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/ProjectEmu/chirpy/internal/store"
+)
+
+// countingStore counts lookups of personal access tokens.
+type countingStore struct {
+	store.Store
+	tokenLookups atomic.Int32
+}
+
+func (s *countingStore) UsePersonalAccessToken(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	s.tokenLookups.Add(1)
+	return s.Store.UsePersonalAccessToken(ctx, tokenHash)
+}
+
+func TestRateLimitedRequestLooksUpTokenOnce(t *testing.T) {
+	db := &countingStore{Store: store.NewMemory()}
+	s := newTestServerWithStore(t, db)
+	alice := s.signup("alice@example.com", "alice")
+
+	var pat struct {
+		Token string `json:"token"`
+	}
+	s.expect(http.StatusCreated, http.MethodPost, "/api/tokens", alice.Token, map[string]interface{}{
+		"name":   "bot",
+		"scopes": []string{"chirps:write"},
+	}, &pat)
+
+	db.tokenLookups.Store(0)
+	s.chirp(pat.Token, "from a bot")
+	if n := db.tokenLookups.Load(); n != 1 {
+		t.Errorf("personal access token looked up %d times, want once", n)
+	}
+
+	// A token without the scope is still turned away by the handler
+	var readOnly struct {
+		Token string `json:"token"`
+	}
+	s.expect(http.StatusCreated, http.MethodPost, "/api/tokens", alice.Token, map[string]interface{}{
+		"name":   "reader",
+		"scopes": []string{"chirps:read"},
+	}, &readOnly)
+	s.expect(http.StatusForbidden, http.MethodPost, "/api/chirps", readOnly.Token, map[string]string{"body": "nope"}, nil)
+}
+
+func TestChirpEditsAreRateLimited(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	chirp := s.chirp(alice.Token, "first draft")
+
+	// Creating the chirp took one request from the bucket, each edit takes another
+	path := "/api/chirps/" + chirp.ID.String()
+	for i := 1; i < config.ChirpWriteRateLimit; i++ {
+		s.expect(http.StatusOK, http.MethodPatch, path, alice.Token, map[string]string{"body": fmt.Sprintf("draft %d", i)}, nil)
+	}
+	s.expect(http.StatusTooManyRequests, http.MethodPatch, path, alice.Token, map[string]string{"body": "one too many"}, nil)
+}
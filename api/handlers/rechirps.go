@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// shareableChirp looks up a chirp that can be replied to, quoted or rechirped.
+// Tombstones report sql.ErrNoRows, and a rechirp resolves to the chirp it reposts.
+func (cfg *apiConfig) shareableChirp(ctx context.Context, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.DB.GetChirp(ctx, chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if chirp.RechirpOf.Valid {
+		chirp, err = cfg.DB.GetChirp(ctx, chirp.RechirpOf.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+	if chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+// attachOriginals embeds the chirp each rechirp or quote points at, which may be a tombstone.
+// It returns the embedded originals so their counts can be filled in too.
+func (cfg *apiConfig) attachOriginals(ctx context.Context, chirps []*Chirp) ([]*Chirp, error) {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		if chirp.RechirpOf != nil {
+			ids = append(ids, *chirp.RechirpOf)
+		} else if chirp.QuoteOf != nil {
+			ids = append(ids, *chirp.QuoteOf)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := cfg.DB.GetChirpsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]*Chirp, len(rows))
+	originals := make([]*Chirp, 0, len(rows))
+	for _, row := range rows {
+		original := chirpFromDB(row)
+		byID[row.ID] = &original
+		originals = append(originals, &original)
+	}
+
+	for _, chirp := range chirps {
+		if chirp.RechirpOf != nil {
+			chirp.Original = byID[*chirp.RechirpOf]
+		} else if chirp.QuoteOf != nil {
+			chirp.Original = byID[*chirp.QuoteOf]
+		}
+	}
+	return originals, nil
+}
+
+// attachShares fills in rechirp and quote counts for every chirp, and rechirped_by_me when the viewer is known.
+func (cfg *apiConfig) attachShares(ctx context.Context, viewer uuid.NullUUID, chirps []*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+
+	stats, err := cfg.DB.GetChirpShareStats(ctx, database.GetChirpShareStatsParams{
+		ViewerID: viewer,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID]database.GetChirpShareStatsRow, len(stats))
+	for _, stat := range stats {
+		byChirp[stat.ChirpID] = stat
+	}
+
+	for _, chirp := range chirps {
+		stat := byChirp[chirp.ID]
+		chirp.RechirpCount = stat.RechirpCount
+		chirp.QuoteCount = stat.QuoteCount
+		if viewer.Valid {
+			rechirpedByMe := stat.RechirpedByViewer
+			chirp.RechirpedByMe = &rechirpedByMe
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handleCreateRechirp(w http.ResponseWriter, r *http.Request, userID, originalID uuid.UUID) {
+	original, err := cfg.shareableChirp(r.Context(), originalID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp being rechirped was not found")
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp to rechirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rechirp")
+		return
+	}
+
+	rechirp, err := cfg.DB.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusConflict, "You have already rechirped this chirp")
+		return
+	} else if err != nil {
+		log.Printf("Error creating rechirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rechirp")
+		return
+	}
+
+	responseChirp := chirpFromDB(rechirp)
+	if err := cfg.decorateChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, []*Chirp{&responseChirp}); err != nil {
+		log.Printf("Error decorating chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rechirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, responseChirp)
+}
+
+// handleUndoRechirp removes the authenticated user's rechirp of /api/chirps/{id}/rechirp.
+func (cfg *apiConfig) handleUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := chirpIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.DB.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:    userID,
+		RechirpOf: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error deleting rechirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not undo rechirp")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Rechirp not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
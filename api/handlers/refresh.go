@@ -8,10 +8,16 @@ import (
 
 	"github.com/ProjectEmu/chirpy/config"
 	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
 
 	_ "github.com/lib/pq"
 )
 
+// logSecurityEvent records events an operator may need to act on, such as a stolen token being used.
+func logSecurityEvent(format string, args ...interface{}) {
+	log.Printf("SECURITY: "+format, args...)
+}
+
 func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -26,10 +32,20 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Rotation reads, revokes and replaces the token in one transaction,
+	// with the token row locked so a concurrent refresh sees it revoked
+	tx, err := cfg.DB.BeginTx(r.Context())
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to validate refresh token")
+		return
+	}
+	defer tx.Rollback()
+
 	// Validate Refresh Token
-	refreshTokenResult, err := cfg.DB.GetRefreshToken(r.Context(), refreshToken)
+	refreshTokenResult, err := tx.GetRefreshTokenForUpdate(r.Context(), authy.HashToken(refreshToken))
 	if err == sql.ErrNoRows {
-		log.Printf("Refresh token not found: %s", refreshToken)
+		log.Printf("Refresh token not found")
 		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
 		return
 	} else if err != nil {
@@ -38,38 +54,102 @@ func (cfg *apiConfig) handlerRefreshToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Check if the token is expired or revoked
+	// A rotated token coming back means it was copied: whoever holds the rest of the family
+	// may be an attacker, so the whole family is logged out
+	if refreshTokenResult.RotatedAt.Valid {
+		revoked, err := tx.RevokeRefreshTokenFamily(r.Context(), refreshTokenResult.FamilyID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			log.Printf("Error revoking refresh token family: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Unable to validate refresh token")
+			return
+		}
+		logSecurityEvent("rotated refresh token reused for user %s, revoked %d remaining tokens in family %s",
+			refreshTokenResult.UserID, revoked, refreshTokenResult.FamilyID)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token revoked")
+		return
+	}
+	if refreshTokenResult.RevokedAt.Valid {
+		log.Println("Refresh token is revoked.")
+		respondWithError(w, http.StatusUnauthorized, "Refresh token revoked")
+		return
+	}
+
+	// Check if the token is expired
 	if refreshTokenResult.ExpiresAt.Before(time.Now()) {
 		log.Println("Refresh token is expired.")
 		respondWithError(w, http.StatusUnauthorized, "Refresh token expired")
 		return
 	}
 
-	if refreshTokenResult.RevokedAt.Valid {
-		log.Println("Refresh token has been revoked.")
-		respondWithError(w, http.StatusUnauthorized, "Refresh token revoked")
+	// Roles are read afresh so a refreshed access token reflects any change since login
+	user, err := tx.GetUser(r.Context(), refreshTokenResult.UserID)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to validate refresh token")
+		return
+	}
+	if user.SuspendedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "This account has been suspended")
+		return
+	}
+
+	// Replace the used refresh token with a new one in the same family
+	err = tx.RotateRefreshToken(r.Context(), refreshTokenResult.TokenHash)
+	if err != nil {
+		log.Printf("Error revoking refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rotate refresh token")
+		return
+	}
+
+	err = tx.TouchSession(r.Context(), refreshTokenResult.FamilyID)
+	if err != nil {
+		log.Printf("Error updating session: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rotate refresh token")
+		return
+	}
+
+	newRefreshToken, err := authy.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Could not generate refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rotate refresh token")
+		return
+	}
+
+	_, err = tx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: authy.HashToken(newRefreshToken),
+		UserID:    refreshTokenResult.UserID,
+		ExpiresAt: time.Now().AddDate(0, 0, config.RefreshTokenDuration),
+		FamilyID:  refreshTokenResult.FamilyID,
+	})
+	if err != nil {
+		log.Printf("Could not store refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rotate refresh token")
 		return
 	}
 
 	// Generate a new access token
-	accessToken, err := authy.MakeJWT(refreshTokenResult.UserID, cfg.JWTSecret, time.Duration(config.AccessTokenDuration)*time.Second)
+	accessToken, err := cfg.Keys.MakeJWT(refreshTokenResult.UserID, user.Roles, time.Duration(config.AccessTokenDuration)*time.Second)
 	if err != nil {
 		log.Printf("Could not generate access token: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not generate access token")
 		return
 	}
 
-	// Optionally revoke the used refresh token
-	//revokeErr := cfg.DB.RevokeRefreshToken(r.Context(), refreshTokenResult.Token, time.Now())
-	//if revokeErr != nil {
-	//    log.Printf("Error revoking refresh token: %s", revokeErr)
-	//    // Not returning here; the error is logged but does not prevent a successful access token response
-	//}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing refresh token rotation: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not rotate refresh token")
+		return
+	}
 
 	var responseToken struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	responseToken.Token = accessToken
+	responseToken.RefreshToken = newRefreshToken
 
 	respondWithJSON(w, http.StatusOK, responseToken)
 }
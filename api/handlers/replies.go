@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// ChirpThread is a chirp together with its nested replies.
+type ChirpThread struct {
+	Chirp
+	Replies []ChirpThread `json:"replies"`
+}
+
+func (cfg *apiConfig) handleGetChirpReplies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := chirpIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	// Make sure the chirp exists so an unknown ID is a 404 rather than an empty list
+	_, err = cfg.DB.GetChirp(r.Context(), chirpID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp by ID: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	replies, err := cfg.DB.ListChirpReplies(r.Context(), database.ListChirpRepliesParams{
+		ParentID:        uuid.NullUUID{UUID: chirpID, Valid: true},
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving replies: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve replies")
+		return
+	}
+
+	if len(replies) > page.Limit {
+		replies = replies[:page.Limit]
+		last := replies[len(replies)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, page.Limit)
+	}
+
+	responseChirps := make([]Chirp, len(replies))
+	for i, reply := range replies {
+		responseChirps[i] = chirpFromDB(reply)
+	}
+	if err := cfg.decorateChirps(r.Context(), cfg.viewerID(r), chirpRefs(responseChirps)); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve replies")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, responseChirps)
+}
+
+func (cfg *apiConfig) handleGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := chirpIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp by ID: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	// Any chirp in a conversation leads to the same root
+	rootID := chirp.ID
+	if chirp.RootID.Valid {
+		rootID = chirp.RootID.UUID
+	}
+
+	chirps, err := cfg.DB.GetChirpThread(r.Context(), rootID)
+	if err != nil {
+		log.Printf("Error retrieving thread: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve thread")
+		return
+	}
+
+	responseChirps := make([]Chirp, len(chirps))
+	for i, c := range chirps {
+		responseChirps[i] = chirpFromDB(c)
+	}
+	if err := cfg.decorateChirps(r.Context(), cfg.viewerID(r), chirpRefs(responseChirps)); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve thread")
+		return
+	}
+
+	// Group replies by parent; rows arrive oldest first so siblings stay in order
+	var root Chirp
+	children := make(map[uuid.UUID][]Chirp)
+	for _, c := range responseChirps {
+		if c.ID == rootID {
+			root = c
+		} else if c.InReplyTo != nil {
+			children[*c.InReplyTo] = append(children[*c.InReplyTo], c)
+		}
+	}
+
+	var build func(c Chirp) ChirpThread
+	build = func(c Chirp) ChirpThread {
+		node := ChirpThread{Chirp: c, Replies: []ChirpThread{}}
+		for _, child := range children[c.ID] {
+			node.Replies = append(node.Replies, build(child))
+		}
+		return node
+	}
+
+	respondWithJSON(w, http.StatusOK, build(root))
+}
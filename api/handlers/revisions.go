@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+type ChirpRevision struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// editChirp replaces a chirp's body, keeping the previous one as a revision, in a single
+// transaction. Hashtags and mentions that were edited out are dropped from the feeds.
+func (cfg *apiConfig) editChirp(ctx context.Context, chirpID uuid.UUID, body string) (database.Chirp, error) {
+	tx, err := cfg.DB.BeginTx(ctx)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	edited, err := tx.EditChirp(ctx, database.EditChirpParams{
+		ID:   chirpID,
+		Body: body,
+	})
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	err = tx.SetChirpTags(ctx, database.SetChirpTagsParams{
+		ChirpID: edited.ID,
+		Names:   extractHashtags(edited.Body),
+	})
+	if err != nil {
+		return database.Chirp{}, fmt.Errorf("tagging chirp: %w", err)
+	}
+	err = tx.SetChirpMentions(ctx, database.SetChirpMentionsParams{
+		ChirpID:   edited.ID,
+		Usernames: extractMentions(edited.Body),
+	})
+	if err != nil {
+		return database.Chirp{}, fmt.Errorf("storing chirp mentions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.Chirp{}, err
+	}
+	return edited, nil
+}
+
+func (cfg *apiConfig) handleEditChirp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := chirpIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsWrite)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if len(req.Body) > config.MaxChirpLength {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+		return
+	}
+
+	// Retrieve chirp from the database by ID to ensure it exists and belongs to the user
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err == sql.ErrNoRows || (err == nil && chirp.DeletedAt.Valid) {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp by ID: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	// Check if the authenticated user is the author of the chirp
+	if chirp.UserID != userID {
+		log.Printf("User %s attempted to edit chirp %s, which does not belong to them", userID, chirpID)
+		respondWithError(w, http.StatusForbidden, "You are not allowed to edit this chirp")
+		return
+	}
+
+	if chirp.RechirpOf.Valid {
+		respondWithError(w, http.StatusBadRequest, "Rechirps have no body to edit")
+		return
+	}
+
+	if config.ChirpEditWindow > 0 && time.Since(chirp.CreatedAt) > config.ChirpEditWindow*time.Minute {
+		respondWithError(w, http.StatusForbidden, "The edit window for this chirp has closed")
+		return
+	}
+
+	body, ok := cfg.moderateChirp(w, r, database.HoldChirpParams{
+		UserID:  userID,
+		ChirpID: uuid.NullUUID{UUID: chirpID, Valid: true},
+		Body:    req.Body,
+	})
+	if !ok {
+		return
+	}
+
+	edited, err := cfg.editChirp(r.Context(), chirpID, body)
+	if err != nil {
+		log.Printf("Error editing chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not edit chirp")
+		return
+	}
+
+	responseChirp := chirpFromDB(edited)
+	if err := cfg.decorateChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, []*Chirp{&responseChirp}); err != nil {
+		log.Printf("Error decorating chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not edit chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, responseChirp)
+}
+
+func (cfg *apiConfig) handleGetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chirpID, err := chirpIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	// A tombstone's history is deleted along with its body
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err == sql.ErrNoRows || (err == nil && chirp.DeletedAt.Valid) {
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving chirp by ID: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	revisions, err := cfg.DB.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error retrieving chirp revisions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve revisions")
+		return
+	}
+
+	responseRevisions := make([]ChirpRevision, len(revisions))
+	for i, revision := range revisions {
+		responseRevisions[i] = ChirpRevision{
+			ID:        revision.ID,
+			ChirpID:   revision.ChirpID,
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, responseRevisions)
+}
@@ -25,9 +25,9 @@ func (cfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Revoke Refresh Token
-	err = cfg.DB.RevokeRefreshToken(r.Context(), refreshToken)
+	err = cfg.DB.RevokeRefreshToken(r.Context(), authy.HashToken(refreshToken))
 	if err == sql.ErrNoRows {
-		log.Printf("Attempted to revoke non-existent refresh token: %s", refreshToken)
+		log.Printf("Attempted to revoke non-existent refresh token")
 		respondWithError(w, http.StatusUnauthorized, "Invalid authorization token")
 		return
 	} else if err != nil {
@@ -37,7 +37,7 @@ func (cfg *apiConfig) handlerRevokeToken(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Log success
-	log.Printf("Successfully revoked refresh token: %s", refreshToken)
+	log.Printf("Successfully revoked refresh token")
 
 	// Respond with a status indicating success
 	w.WriteHeader(http.StatusNoContent)
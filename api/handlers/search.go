@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// buildTSQuery turns user input into a to_tsquery expression. Every term must match,
+// "quoted phrases" match words next to each other and a trailing * matches a prefix.
+func buildTSQuery(input string) (string, error) {
+	var terms []string
+
+	// Splitting on quotes leaves phrases at the odd indexes
+	for i, segment := range strings.Split(input, `"`) {
+		if i%2 == 1 {
+			if phrase := tsPhrase(segment, false); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(segment) {
+			if term := tsPhrase(word, strings.HasSuffix(word, "*")); term != "" {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("query has no searchable terms")
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+// tsPhrase keeps only letters and digits so user input cannot inject tsquery operators,
+// and chains the remaining words with the followed-by operator.
+func tsPhrase(text string, prefix bool) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	if prefix {
+		words[len(words)-1] += ":*"
+	}
+	if len(words) == 1 {
+		return words[0]
+	}
+	return "(" + strings.Join(words, " <-> ") + ")"
+}
+
+// parseSearchTime accepts either an RFC 3339 timestamp or a plain date.
+func parseSearchTime(value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return sql.NullTime{}, err
+		}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
+
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query, err := buildTSQuery(params.Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Missing or empty search query")
+		return
+	}
+
+	sortOrder := params.Get("sort")
+	if sortOrder == "" {
+		sortOrder = "relevance"
+	} else if sortOrder != "relevance" && sortOrder != "recent" {
+		respondWithError(w, http.StatusBadRequest, "Invalid sort parameter, must be 'relevance' or 'recent'")
+		return
+	}
+
+	var authorID uuid.NullUUID
+	if authorIDParam := params.Get("author_id"); authorIDParam != "" {
+		parsedUUID, err := uuid.Parse(authorIDParam)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author_id")
+			return
+		}
+		authorID = uuid.NullUUID{UUID: parsedUUID, Valid: true}
+	}
+
+	since, err := parseSearchTime(params.Get("since"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid since, use RFC 3339 or YYYY-MM-DD")
+		return
+	}
+	until, err := parseSearchTime(params.Get("until"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid until, use RFC 3339 or YYYY-MM-DD")
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err == nil && sortOrder == "relevance" && page.Cursor != nil && page.Cursor.Rank == nil {
+		err = errors.New("cursor does not belong to a relevance search")
+	}
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	// Both queries return the chirp and its rank; only the ordering differs
+	var chirps []database.Chirp
+	var ranks []float32
+	if sortOrder == "relevance" {
+		rows, err := cfg.DB.SearchChirpsByRank(r.Context(), database.SearchChirpsByRankParams{
+			Query:           query,
+			AuthorID:        authorID,
+			Since:           since,
+			Until:           until,
+			CursorRank:      page.cursorRank(),
+			CursorCreatedAt: page.cursorCreatedAt(),
+			CursorID:        page.cursorID(),
+			PageLimit:       page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error searching chirps: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not search chirps")
+			return
+		}
+		for _, row := range rows {
+			chirps = append(chirps, row.Chirp)
+			ranks = append(ranks, row.Rank)
+		}
+	} else {
+		rows, err := cfg.DB.SearchChirpsByDate(r.Context(), database.SearchChirpsByDateParams{
+			Query:           query,
+			AuthorID:        authorID,
+			Since:           since,
+			Until:           until,
+			CursorCreatedAt: page.cursorCreatedAt(),
+			CursorID:        page.cursorID(),
+			PageLimit:       page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error searching chirps: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not search chirps")
+			return
+		}
+		for _, row := range rows {
+			chirps = append(chirps, row.Chirp)
+			ranks = append(ranks, row.Rank)
+		}
+	}
+
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		next := pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		if sortOrder == "relevance" {
+			next.Rank = &ranks[page.Limit-1]
+		}
+		setNextPageLink(w, r, next, page.Limit)
+	}
+
+	responseChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		responseChirps[i] = chirpFromDB(chirp)
+	}
+	if err := cfg.decorateChirps(r.Context(), cfg.viewerID(r), chirpRefs(responseChirps)); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not search chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, responseChirps)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// Session is a login on one device, kept alive by its refresh token family.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+func sessionFromDB(session database.Session) Session {
+	return Session{
+		ID:         session.ID,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IpAddress,
+	}
+}
+
+// clientIP returns the address the request came from. Proxy headers are not trusted,
+// so behind a reverse proxy this is the proxy's address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession records a new session for the request's client and stores the
+// first refresh token of its family, in a single transaction.
+func (cfg *apiConfig) startSession(r *http.Request, userID uuid.UUID, refreshToken string) error {
+	tx, err := cfg.DB.BeginTx(r.Context())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	session, err := tx.CreateSession(r.Context(), database.CreateSessionParams{
+		UserID:    userID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: authy.HashToken(refreshToken),
+		UserID:    userID,
+		ExpiresAt: time.Now().AddDate(0, 0, config.RefreshTokenDuration),
+		FamilyID:  session.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Main handler
+func (cfg *apiConfig) handlerSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	sessions, err := cfg.DB.ListActiveSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve sessions")
+		return
+	}
+
+	responseSessions := make([]Session, len(sessions))
+	for i, session := range sessions {
+		responseSessions[i] = sessionFromDB(session)
+	}
+
+	respondWithJSON(w, http.StatusOK, responseSessions)
+}
+
+// Handler for DELETE /api/sessions/{id} and POST /api/sessions/revoke-all
+func (cfg *apiConfig) handlerSessionByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+	if id == "revoke-all" {
+		cfg.handleRevokeAllSessions(w, r)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	// Another user's session looks the same as one that does not exist
+	revoked, err := cfg.DB.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not revoke session")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	revoked, err := cfg.DB.RevokeAllUserSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not revoke sessions")
+		return
+	}
+	log.Printf("Revoked %d refresh tokens for user %s", revoked, userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// handlerTimeline returns the authenticated user's home timeline: their own chirps plus
+// chirps from every account they follow, newest first.
+func (cfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	chirps, err := cfg.DB.ListTimelineChirps(r.Context(), database.ListTimelineChirpsParams{
+		UserID:          userID,
+		CursorCreatedAt: page.cursorCreatedAt(),
+		CursorID:        page.cursorID(),
+		PageLimit:       page.fetchLimit(),
+	})
+	if err != nil {
+		log.Printf("Error retrieving timeline: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve timeline")
+		return
+	}
+
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		setNextPageLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, page.Limit)
+	}
+
+	responseChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		responseChirps[i] = chirpFromDB(chirp)
+	}
+	if err := cfg.decorateChirps(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, chirpRefs(responseChirps)); err != nil {
+		log.Printf("Error decorating chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve timeline")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, responseChirps)
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// loginOnly is passed as the required scope by endpoints that manage credentials, which a
+// personal access token must not be able to reach or it could mint its own replacements.
+const loginOnly = ""
+
+// anyScope accepts any valid token, for callers that only need to know who is calling.
+const anyScope = "*"
+
+var errInsufficientScope = errors.New("token lacks the required scope")
+
+// PersonalAccessToken is a long-lived bearer token a user mints for a bot or integration.
+// Token is only set in the response that creates it.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func personalAccessTokenFromDB(token database.PersonalAccessToken) PersonalAccessToken {
+	response := PersonalAccessToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+	}
+	if token.LastUsedAt.Valid {
+		response.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return response
+}
+
+// authenticate resolves a bearer token to its user. Access tokens from a login carry every
+// scope; personal access tokens only the scopes they were minted with.
+func (cfg *apiConfig) authenticate(ctx context.Context, bearer string, scope string) (uuid.UUID, error) {
+	if !authy.IsPersonalAccessToken(bearer) {
+		return cfg.Keys.ValidateJWT(bearer)
+	}
+
+	token, err := cfg.usePersonalAccessToken(ctx, bearer)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if scope == anyScope {
+		return token.UserID, nil
+	}
+	if scope == loginOnly || !slices.Contains(token.Scopes, scope) {
+		return uuid.Nil, errInsufficientScope
+	}
+	return token.UserID, nil
+}
+
+// personalAccessTokenKey is the request context key of a personalAccessTokenLookup.
+type personalAccessTokenKey struct{}
+
+// personalAccessTokenLookup is the outcome of looking up a personal access token bearer.
+type personalAccessTokenLookup struct {
+	bearer string
+	token  database.PersonalAccessToken
+	err    error
+}
+
+// withPersonalAccessToken looks up a personal access token bearer ahead of the handler and
+// keeps the outcome in the request context, where authenticate finds it. Middleware that
+// needs to know the caller uses it so the token is only looked up, and its use recorded, once.
+func (cfg *apiConfig) withPersonalAccessToken(r *http.Request) *http.Request {
+	bearer, err := authy.GetBearerToken(r.Header)
+	if err != nil || !authy.IsPersonalAccessToken(bearer) {
+		return r
+	}
+	lookup := personalAccessTokenLookup{bearer: bearer}
+	lookup.token, lookup.err = cfg.usePersonalAccessToken(r.Context(), bearer)
+	return r.WithContext(context.WithValue(r.Context(), personalAccessTokenKey{}, lookup))
+}
+
+// usePersonalAccessToken finds an unexpired personal access token and records that it was
+// used, unless withPersonalAccessToken already did so for this request.
+func (cfg *apiConfig) usePersonalAccessToken(ctx context.Context, bearer string) (database.PersonalAccessToken, error) {
+	if lookup, ok := ctx.Value(personalAccessTokenKey{}).(personalAccessTokenLookup); ok && lookup.bearer == bearer {
+		return lookup.token, lookup.err
+	}
+
+	token, err := cfg.DB.UsePersonalAccessToken(ctx, authy.HashToken(bearer))
+	if err == sql.ErrNoRows {
+		return database.PersonalAccessToken{}, errors.New("personal access token not found or expired")
+	}
+	return token, err
+}
+
+// authenticatedUser validates the bearer token for the given scope, writing a 401 when it is
+// missing or invalid and a 403 when it does not grant the scope.
+func (cfg *apiConfig) authenticatedUser(w http.ResponseWriter, r *http.Request, scope string) (uuid.UUID, bool) {
+	// Extract Bearer Token
+	bearer, err := authy.GetBearerToken(r.Header)
+	if err != nil {
+		log.Printf("Issue parsing bearer token: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Invalid bearer token")
+		return uuid.Nil, false
+	}
+
+	// Validate the token and get User ID
+	userID, err := cfg.authenticate(r.Context(), bearer, scope)
+	if errors.Is(err, errInsufficientScope) {
+		if scope == loginOnly {
+			respondWithError(w, http.StatusForbidden, "Personal access tokens cannot be used here")
+		} else {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("Token is missing the %s scope", scope))
+		}
+		return uuid.Nil, false
+	} else if err != nil {
+		log.Printf("Issue authenticating bearer: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired access token")
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+// Handler for GET and POST /api/tokens
+func (cfg *apiConfig) handlerTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg.handleListTokens(w, r)
+	case http.MethodPost:
+		cfg.handleCreateToken(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (cfg *apiConfig) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Token name is required")
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(authy.Scopes, scope) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope %q", scope))
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = config.PersonalTokenDuration
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > config.MaxPersonalTokenDuration {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be between 1 and %d", config.MaxPersonalTokenDuration))
+		return
+	}
+
+	token, err := authy.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("Could not generate personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not create token")
+		return
+	}
+
+	created, err := cfg.DB.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: authy.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+	})
+	if err != nil {
+		log.Printf("Error storing personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not create token")
+		return
+	}
+
+	// Only the hash is stored, so this response is the one chance to see the token
+	response := personalAccessTokenFromDB(created)
+	response.Token = token
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	tokens, err := cfg.DB.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving personal access tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve tokens")
+		return
+	}
+
+	responseTokens := make([]PersonalAccessToken, len(tokens))
+	for i, token := range tokens {
+		responseTokens[i] = personalAccessTokenFromDB(token)
+	}
+
+	respondWithJSON(w, http.StatusOK, responseTokens)
+}
+
+// Handler for DELETE /api/tokens/{id}
+func (cfg *apiConfig) handlerTokenByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tokenID, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, "/api/tokens/"))
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.DB.DeletePersonalAccessToken(r.Context(), database.DeletePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error deleting personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not delete token")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
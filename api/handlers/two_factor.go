@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// totpIssuer is the name authenticator apps show next to the account.
+const totpIssuer = "Chirpy"
+
+// secondFactor is a TOTP code or, for users without their authenticator, a recovery code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifySecondFactor checks a TOTP code or spends a recovery code. Each TOTP code and each
+// recovery code is accepted only once.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, userID uuid.UUID, factor secondFactor) (bool, error) {
+	if factor.RecoveryCode != "" {
+		used, err := cfg.DB.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: authy.HashRecoveryCode(factor.RecoveryCode),
+		})
+		if err != nil {
+			return false, err
+		}
+		if used > 0 {
+			log.Printf("Recovery code used for user %s", userID)
+		}
+		return used > 0, nil
+	}
+
+	totp, err := cfg.DB.GetUserTOTP(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !totp.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	step, ok := authy.ValidateTOTP(totp.Secret, factor.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	used, err := cfg.DB.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:   userID,
+		LastStep: step,
+	})
+	if err != nil {
+		return false, err
+	}
+	return used > 0, nil
+}
+
+// startMFAChallenge answers a correct password from a user with two-factor authentication
+// with a short-lived token to exchange, together with a code, at /api/login/mfa.
+func (cfg *apiConfig) startMFAChallenge(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	// Challenge tokens are random like refresh tokens and only their hash is stored
+	token, err := authy.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Could not generate MFA challenge token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not start two-factor login")
+		return
+	}
+
+	// Each challenge allows a few codes, so the number of them is capped too
+	created, err := cfg.DB.CreateMFAChallenge(r.Context(), database.CreateMFAChallengeParams{
+		UserID:        userID,
+		TokenHash:     authy.HashToken(token),
+		ExpiresAt:     time.Now().Add(config.MFAChallengeDuration * time.Second),
+		MaxChallenges: config.MaxMFAChallenges,
+	})
+	if err != nil {
+		log.Printf("Error storing MFA challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not start two-factor login")
+		return
+	}
+	if created == 0 {
+		respondWithRetryAfter(w, config.MFAChallengeDuration*time.Second, "Too many two-factor logins in progress, try again later")
+		return
+	}
+
+	var response struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	response.MFARequired = true
+	response.MFAToken = token
+	response.ExpiresIn = config.MFAChallengeDuration
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// Handler for POST /api/login/mfa, the second step of a two-factor login
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Expires  int    `json:"expires"`
+		secondFactor
+	}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	expires := config.AccessTokenDuration
+	if req.Expires > 0 && req.Expires < config.AccessTokenDuration {
+		expires = req.Expires
+	}
+
+	// Every code tried counts against the challenge, so it cannot be used to guess codes
+	challengeHash := authy.HashToken(req.MFAToken)
+	userID, err := cfg.DB.AttemptMFAChallenge(r.Context(), database.AttemptMFAChallengeParams{
+		TokenHash:   challengeHash,
+		MaxAttempts: config.MaxMFAAttempts,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving MFA challenge: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not verify two-factor code")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve user")
+		return
+	}
+
+	// Wrong codes count as failed logins too, across all of the account's challenges
+	ip, account := clientIP(r), loginAccount(user.Email)
+	wait, err := cfg.LoginGuard.Check(r.Context(), ip, account)
+	if err != nil {
+		log.Printf("Error checking login attempts: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not verify two-factor code")
+		return
+	}
+	if wait > 0 {
+		respondWithRetryAfter(w, wait, "Too many failed login attempts, try again later")
+		return
+	}
+
+	ok, err := cfg.verifySecondFactor(r.Context(), userID, req.secondFactor)
+	if err != nil {
+		log.Printf("Error verifying second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not verify two-factor code")
+		return
+	}
+	if !ok {
+		if err := cfg.LoginGuard.Failure(r.Context(), ip, account); err != nil {
+			log.Printf("Error recording failed login: %s", err)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Invalid two-factor code")
+		return
+	}
+
+	if err := cfg.DB.DeleteMFAChallenge(r.Context(), challengeHash); err != nil {
+		log.Printf("Error deleting MFA challenge: %s", err)
+	}
+
+	if user.SuspendedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "This account has been suspended")
+		return
+	}
+
+	cfg.completeLogin(w, r, User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+	}, user.Roles, expires)
+}
+
+// Handler for POST and DELETE /api/users/me/totp
+func (cfg *apiConfig) handleTOTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		cfg.handleStartTOTPEnrolment(w, r)
+	case http.MethodDelete:
+		cfg.handleDisableTOTP(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleStartTOTPEnrolment generates a secret for the user to add to their authenticator.
+// Two-factor authentication is not enforced until a code from it is confirmed.
+func (cfg *apiConfig) handleStartTOTPEnrolment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve user")
+		return
+	}
+
+	secret, uri, err := authy.GenerateTOTPSecret(totpIssuer, user.Email)
+	if err != nil {
+		log.Printf("Could not generate TOTP secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not start enrolment")
+		return
+	}
+
+	_, err = cfg.DB.StartTOTPEnrolment(r.Context(), database.StartTOTPEnrolmentParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	} else if err != nil {
+		log.Printf("Error storing TOTP secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not start enrolment")
+		return
+	}
+
+	var response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	response.Secret = secret
+	response.OTPAuthURI = uri
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// Handler for POST /api/users/me/totp/confirm, which turns two-factor authentication on
+// once the user proves their authenticator works, and hands out the recovery codes
+func (cfg *apiConfig) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	totp, err := cfg.DB.GetUserTOTP(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusConflict, "Two-factor enrolment has not been started")
+		return
+	} else if err != nil {
+		log.Printf("Error retrieving TOTP secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := authy.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid two-factor code")
+		return
+	}
+
+	codes, err := authy.MakeRecoveryCodes(config.RecoveryCodeCount)
+	if err != nil {
+		log.Printf("Could not generate recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = authy.HashRecoveryCode(code)
+	}
+
+	tx, err := cfg.DB.BeginTx(r.Context())
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.ConfirmTOTPEnrolment(r.Context(), database.ConfirmTOTPEnrolmentParams{
+		UserID:   userID,
+		LastStep: step,
+	})
+	if err == nil {
+		err = tx.SetRecoveryCodes(r.Context(), database.SetRecoveryCodesParams{
+			UserID:     userID,
+			CodeHashes: hashes,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+		return
+	}
+
+	// Only the hashes are stored, so this response is the one chance to see the codes
+	var response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	response.RecoveryCodes = codes
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handleDisableTOTP turns two-factor authentication off. It takes a current code or a
+// recovery code, so a stolen access token alone cannot remove the second factor.
+func (cfg *apiConfig) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUser(w, r, loginOnly)
+	if !ok {
+		return
+	}
+
+	var req secondFactor
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Printf("Error decoding request: %s", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	ok, err = cfg.verifySecondFactor(r.Context(), userID, req)
+	if err != nil {
+		log.Printf("Error verifying second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not disable two-factor authentication")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "Invalid two-factor code")
+		return
+	}
+
+	err = cfg.DB.DisableTOTP(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error disabling two-factor authentication: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not disable two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
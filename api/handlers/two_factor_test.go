@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/config"
+	"github.com/pquerna/otp/totp"
+)
+
+// enableTOTP turns on two-factor authentication for the user and returns their recovery codes.
+func (s *testServer) enableTOTP(user session) []string {
+	s.t.Helper()
+	var enrolment struct {
+		Secret string `json:"secret"`
+	}
+	s.expect(http.StatusOK, http.MethodPost, "/api/users/me/totp", user.Token, nil, &enrolment)
+
+	code, err := totp.GenerateCode(enrolment.Secret, time.Now())
+	if err != nil {
+		s.t.Fatalf("generating TOTP code: %v", err)
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	s.expect(http.StatusOK, http.MethodPost, "/api/users/me/totp/confirm", user.Token, map[string]string{"code": code}, &confirmed)
+	return confirmed.RecoveryCodes
+}
+
+// startMFALogin logs in with the password and returns the challenge token for the second step.
+func (s *testServer) startMFALogin(user session) string {
+	s.t.Helper()
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	s.expect(http.StatusOK, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    user.Email,
+		"password": user.Password,
+	}, &challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		s.t.Fatalf("login did not ask for a second factor: %+v", challenge)
+	}
+	return challenge.MFAToken
+}
+
+func TestLoginMFA(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	recoveryCodes := s.enableTOTP(alice)
+
+	token := s.startMFALogin(alice)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login/mfa", "", map[string]string{
+		"mfa_token": token,
+		"code":      "not-a-code",
+	}, nil)
+
+	var login session
+	s.expect(http.StatusOK, http.MethodPost, "/api/login/mfa", "", map[string]string{
+		"mfa_token":     token,
+		"recovery_code": recoveryCodes[0],
+	}, &login)
+	if login.ID != alice.ID || login.Token == "" || login.RefreshToken == "" {
+		t.Errorf("two-factor login = %+v", login)
+	}
+
+	// The challenge and the recovery code are both spent
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login/mfa", "", map[string]string{
+		"mfa_token":     token,
+		"recovery_code": recoveryCodes[1],
+	}, nil)
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login/mfa", "", map[string]string{
+		"mfa_token":     s.startMFALogin(alice),
+		"recovery_code": recoveryCodes[0],
+	}, nil)
+}
+
+func TestLoginMFAFailuresAreThrottled(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	recoveryCodes := s.enableTOTP(alice)
+
+	// The password alone does not clear earlier failures, so these still count after it
+	for range config.LoginFreeAttempts {
+		s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login", "", map[string]string{
+			"email":    alice.Email,
+			"password": "wrong",
+		}, nil)
+	}
+	token := s.startMFALogin(alice)
+
+	// One more failure, from a bad code, is one too many
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login/mfa", "", map[string]string{
+		"mfa_token": token,
+		"code":      "not-a-code",
+	}, nil)
+	resp := s.expect(http.StatusTooManyRequests, http.MethodPost, "/api/login/mfa", "", map[string]string{
+		"mfa_token":     token,
+		"recovery_code": recoveryCodes[0],
+	}, nil)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("throttled two-factor login has no Retry-After header")
+	}
+}
+
+func TestLoginMFAChallengesAreCapped(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	s.enableTOTP(alice)
+
+	for range config.MaxMFAChallenges {
+		s.startMFALogin(alice)
+	}
+	s.expect(http.StatusTooManyRequests, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    alice.Email,
+		"password": alice.Password,
+	}, nil)
+}
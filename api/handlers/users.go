@@ -1,26 +1,71 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
 	authy "github.com/ProjectEmu/chirpy/internal/auth"
 	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/ProjectEmu/chirpy/internal/store"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// Usernames are matched case-insensitively but displayed as the user typed them.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
 type User struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Username      string    `json:"username"`
+	EmailVerified bool      `json:"email_verified"`
+}
+
+// PublicUser is what anyone may see of a user, leaving out the email and account state.
+type PublicUser struct {
 	ID          uuid.UUID `json:"id"`
 	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
+	Username    string    `json:"username"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
 }
 
+// usernameParam validates an optional username from a request body.
+// An empty username is passed to the database as NULL.
+func usernameParam(username string) (sql.NullString, error) {
+	if username == "" {
+		return sql.NullString{}, nil
+	}
+	if !usernamePattern.MatchString(username) {
+		return sql.NullString{}, errors.New("username must be 3-30 letters, digits or underscores")
+	}
+	return sql.NullString{String: username, Valid: true}, nil
+}
+
+// respondWithUserConflict turns a duplicate email or username into a 409.
+// It reports false when err was not caused by either.
+func respondWithUserConflict(w http.ResponseWriter, err error) bool {
+	constraint, ok := store.UniqueViolation(err)
+	if !ok {
+		return false
+	}
+	if constraint == "idx_users_username" {
+		respondWithError(w, http.StatusConflict, "Username is already taken")
+	} else {
+		respondWithError(w, http.StatusConflict, "Email is already registered")
+	}
+	return true
+}
+
 // Main handler
 func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -33,6 +78,76 @@ func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Handler for the /api/users/{id}/... sub-resources
+func (cfg *apiConfig) handlerUserByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+	if id == "me" {
+		cfg.handlerMe(w, r, action)
+		return
+	}
+
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "follow":
+		switch r.Method {
+		case http.MethodPost:
+			cfg.handleFollowUser(w, r, userID)
+		case http.MethodDelete:
+			cfg.handleUnfollowUser(w, r, userID)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	case "followers":
+		cfg.handleListFollowers(w, r, userID)
+	case "following":
+		cfg.handleListFollowing(w, r, userID)
+	case "likes":
+		cfg.handleListLikedChirps(w, r, userID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Handler for the /api/users/me/... resources of the authenticated user
+func (cfg *apiConfig) handlerMe(w http.ResponseWriter, r *http.Request, action string) {
+	if exportID, ok := strings.CutPrefix(action, "export/"); ok {
+		cfg.handleGetDataExport(w, r, exportID)
+		return
+	}
+
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodDelete:
+			cfg.handleDeleteAccount(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	case "export":
+		switch r.Method {
+		case http.MethodPost:
+			cfg.handleStartDataExport(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	case "mentions":
+		cfg.handleListMentions(w, r)
+	case "totp":
+		cfg.handleTOTP(w, r)
+	case "totp/confirm":
+		cfg.handleConfirmTOTP(w, r)
+	case "verify-email":
+		cfg.handleResendVerification(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -42,6 +157,7 @@ func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Username string `json:"username"`
 	}
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&req)
@@ -51,6 +167,12 @@ func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	username, err := usernameParam(req.Username)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	//Prepare parameters
 	pwHash, err := authy.HashPassword(req.Password)
 	if err != nil {
@@ -61,22 +183,32 @@ func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 	userParams := database.CreateUserParams{
 		Email:          req.Email,
 		HashedPassword: pwHash,
+		Username:       username,
 	}
 
 	// Use SQLC's CreateUser method
 	user, err := cfg.DB.CreateUser(r.Context(), userParams)
-	if err != nil {
+	if respondWithUserConflict(w, err) {
+		return
+	} else if err != nil {
 		log.Printf("Error creating user: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not create user")
 		return
 	}
 
+	// A failed email is not worth failing the signup over; the user can ask for another
+	if err := cfg.sendVerificationEmail(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
 	// Map database.User to the User struct to control JSON keys
 	responseUser := User{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
 	}
 
 	respondWithJSON(w, http.StatusCreated, responseUser)
@@ -88,64 +220,112 @@ func (cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract Bearer Token
-	bearer, err := authy.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Issue parsing bearer token: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Invalid bearer token")
+	userID, ok := cfg.authenticatedUser(w, r, authy.ScopeProfileWrite)
+	if !ok {
 		return
 	}
 
-	// Validate JWT and get User ID
-	userID, err := authy.ValidateJWT(bearer, cfg.JWTSecret)
-	if err != nil {
-		log.Printf("Issue authenticating bearer: %s", err)
-		respondWithError(w, http.StatusUnauthorized, "Invalid or expired access token")
-		return
-	}
-
-	// Decode request body to get new email and password
+	// Decode request body. Anything left out keeps its current value.
 	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+		Username        string `json:"username"`
 	}
 	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&req)
+	err := decoder.Decode(&req)
 	if err != nil {
 		log.Printf("Error decoding request: %s", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	// Hash the new password
-	pwHash, err := authy.HashPassword(req.Password)
+	username, err := usernameParam(req.Username)
 	if err != nil {
-		log.Printf("Error creating password hash: %s", err)
-		respondWithError(w, http.StatusBadRequest, "Invalid password")
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currentUser, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not update user")
 		return
 	}
+	user, err := cfg.DB.AuthUser(r.Context(), currentUser.Email)
+	if err != nil {
+		log.Printf("Error retrieving user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Could not update user")
+		return
+	}
+
+	email := currentUser.Email
+	if req.Email != "" {
+		email = req.Email
+	}
+	pwHash := user.HashedPassword
+
+	// Whoever controls the email or password controls the account, so changing either takes
+	// a login rather than a personal access token, and the current password
+	if email != currentUser.Email || req.Password != "" {
+		if bearer, _ := authy.GetBearerToken(r.Header); authy.IsPersonalAccessToken(bearer) {
+			respondWithError(w, http.StatusForbidden, "Personal access tokens cannot change the email or password")
+			return
+		}
+
+		err = authy.CheckPasswordHash(req.CurrentPassword, user.HashedPassword)
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			respondWithError(w, http.StatusUnauthorized, "Incorrect current password")
+			return
+		} else if err != nil {
+			log.Printf("Unexpected error during password hash check: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Could not verify password")
+			return
+		}
+
+		if req.Password != "" {
+			pwHash, err = authy.HashPassword(req.Password)
+			if err != nil {
+				log.Printf("Error creating password hash: %s", err)
+				respondWithError(w, http.StatusBadRequest, "Invalid password")
+				return
+			}
+		}
+	}
 
 	// Prepare parameters for update
 	updateParams := database.UpdateUserParams{
 		ID:             userID,
-		Email:          req.Email,
+		Email:          email,
 		HashedPassword: pwHash,
+		Username:       username,
 	}
 
 	// Update user using SQLC's UpdateUser method
 	updatedUser, err := cfg.DB.UpdateUser(r.Context(), updateParams)
-	if err != nil {
+	if respondWithUserConflict(w, err) {
+		return
+	} else if err != nil {
 		log.Printf("Error updating user: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not update user")
 		return
 	}
 
+	// A new address has to be verified again
+	if updatedUser.Email != currentUser.Email {
+		if err := cfg.sendVerificationEmail(r.Context(), updatedUser.ID, updatedUser.Email); err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
+	}
+
 	// Map updated user to response format
 	responseUser := User{
-		ID:        updatedUser.ID,
-		CreatedAt: updatedUser.CreatedAt,
-		UpdatedAt: updatedUser.UpdatedAt,
-		Email:     updatedUser.Email,
+		ID:            updatedUser.ID,
+		CreatedAt:     updatedUser.CreatedAt,
+		UpdatedAt:     updatedUser.UpdatedAt,
+		Email:         updatedUser.Email,
+		Username:      updatedUser.Username,
+		EmailVerified: updatedUser.EmailVerified,
 	}
 
 	respondWithJSON(w, http.StatusOK, responseUser)
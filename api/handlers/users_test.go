@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCreateUser(t *testing.T) {
+	s := newTestServer(t)
+
+	var user User
+	s.expect(http.StatusCreated, http.MethodPost, "/api/users", "", map[string]string{
+		"email":    "alice@example.com",
+		"password": "hunter2",
+		"username": "Alice",
+	}, &user)
+	if user.Email != "alice@example.com" || user.Username != "Alice" || user.EmailVerified || user.IsChirpyRed {
+		t.Errorf("created user = %+v", user)
+	}
+
+	// Without a username one is made up from the ID
+	var generated User
+	s.expect(http.StatusCreated, http.MethodPost, "/api/users", "", map[string]string{
+		"email":    "bob@example.com",
+		"password": "hunter2",
+	}, &generated)
+	if !usernamePattern.MatchString(generated.Username) {
+		t.Errorf("generated username %q is not a valid username", generated.Username)
+	}
+}
+
+func TestCreateUserConflicts(t *testing.T) {
+	s := newTestServer(t)
+	s.signup("alice@example.com", "alice")
+
+	tests := []struct {
+		name   string
+		body   map[string]string
+		status int
+	}{
+		{"duplicate email", map[string]string{"email": "alice@example.com", "password": "pw", "username": "alice2"}, http.StatusConflict},
+		{"username differs only in case", map[string]string{"email": "other@example.com", "password": "pw", "username": "ALICE"}, http.StatusConflict},
+		{"invalid username", map[string]string{"email": "other@example.com", "password": "pw", "username": "no spaces"}, http.StatusBadRequest},
+		{"short username", map[string]string{"email": "other@example.com", "password": "pw", "username": "al"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.expect(tt.status, http.MethodPost, "/api/users", "", tt.body, nil)
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+	s.signup("bob@example.com", "bob")
+
+	var updated User
+	s.expect(http.StatusOK, http.MethodPut, "/api/users", alice.Token, map[string]string{
+		"email":            "alice@example.org",
+		"password":         "new-password",
+		"current_password": alice.Password,
+		"username":         "alice_b",
+	}, &updated)
+	if updated.ID != alice.ID || updated.Email != "alice@example.org" || updated.Username != "alice_b" {
+		t.Errorf("updated user = %+v", updated)
+	}
+
+	// The new credentials work and the old ones do not
+	s.login("alice@example.org", "new-password")
+	s.expect(http.StatusUnauthorized, http.MethodPost, "/api/login", "", map[string]string{
+		"email":    "alice@example.com",
+		"password": alice.Password,
+	}, nil)
+
+	// The username alone can change without the password
+	s.expect(http.StatusOK, http.MethodPut, "/api/users", alice.Token, map[string]string{"username": "alice_c"}, &updated)
+	if updated.Email != "alice@example.org" || updated.Username != "alice_c" {
+		t.Errorf("user after a username change = %+v", updated)
+	}
+	s.login("alice@example.org", "new-password")
+
+	s.expect(http.StatusConflict, http.MethodPut, "/api/users", alice.Token, map[string]string{
+		"email":            "bob@example.com",
+		"current_password": "new-password",
+	}, nil)
+	s.expect(http.StatusUnauthorized, http.MethodPut, "/api/users", "", map[string]string{
+		"email":            "alice@example.net",
+		"current_password": "new-password",
+	}, nil)
+}
+
+func TestUpdateUserCredentials(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.signup("alice@example.com", "alice")
+
+	var pat struct {
+		Token string `json:"token"`
+	}
+	s.expect(http.StatusCreated, http.MethodPost, "/api/tokens", alice.Token, map[string]interface{}{
+		"name":   "profile",
+		"scopes": []string{"profile:write"},
+	}, &pat)
+
+	tests := []struct {
+		name   string
+		token  string
+		body   map[string]string
+		status int
+	}{
+		{"password without the current one", alice.Token, map[string]string{"password": "new"}, http.StatusUnauthorized},
+		{"email with a wrong current password", alice.Token, map[string]string{"email": "alice@example.org", "current_password": "wrong"}, http.StatusUnauthorized},
+		{"password with a personal access token", pat.Token, map[string]string{"password": "new", "current_password": alice.Password}, http.StatusForbidden},
+		{"email with a personal access token", pat.Token, map[string]string{"email": "alice@example.org", "current_password": alice.Password}, http.StatusForbidden},
+		{"username with a personal access token", pat.Token, map[string]string{"username": "alice_b"}, http.StatusOK},
+		{"same email with a personal access token", pat.Token, map[string]string{"email": "alice@example.com"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.expect(tt.status, http.MethodPut, "/api/users", tt.token, tt.body, nil)
+		})
+	}
+
+	// None of the refused changes went through
+	s.login("alice@example.com", alice.Password)
+}
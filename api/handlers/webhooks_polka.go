@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	authy "github.com/ProjectEmu/chirpy/internal/auth"
+	"github.com/ProjectEmu/chirpy/internal/database"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
@@ -59,8 +60,25 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Upgrade the user to Chirpy Red using SQLC
-	err = cfg.DB.UpgradeUserToChirpyRed(r.Context(), userID)
+	// Upgrade the user to Chirpy Red using SQLC, and keep a record of it for their history
+	tx, err := cfg.DB.BeginTx(r.Context())
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.UpgradeUserToChirpyRed(r.Context(), userID)
+	if err == nil {
+		err = tx.RecordSubscriptionEvent(r.Context(), database.RecordSubscriptionEventParams{
+			Event:  req.Event,
+			UserID: userID,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// User not found, return 404
@@ -1,8 +1,38 @@
 package config
 
 const (
-	RefreshTokenLength   = 32   // Length for refresh token bytes
-	RefreshTokenDuration = 60   // Duration in days
-	AccessTokenDuration  = 3600 // Duration in seconds
-	MaxChirpLength       = 140  // Max length for chirp content
+	RefreshTokenLength       = 32   // Length for refresh token bytes
+	RefreshTokenDuration     = 60   // Duration in days
+	AccessTokenDuration      = 3600 // Duration in seconds
+	MaxChirpLength           = 140  // Max length for chirp content
+	DefaultPageSize          = 50   // Items per page when no limit is requested
+	MaxPageSize              = 200  // Upper bound for a requested page limit
+	ChirpEditWindow          = 0    // Minutes a chirp stays editable after creation, 0 for no limit
+	TrendingWindow           = 24   // Hours of chirps counted by trending hashtags when no window is requested
+	MaxTrendingWindow        = 168  // Upper bound in hours for a requested trending window
+	TrendingLimit            = 10   // Trending hashtags returned when no limit is requested
+	PersonalTokenDuration    = 90   // Days a personal access token lasts when no expiry is requested
+	MaxPersonalTokenDuration = 365  // Upper bound in days for a requested personal access token expiry
+	MFAChallengeDuration     = 300  // Seconds a password-only login has to complete the second factor
+	MaxMFAAttempts           = 5    // Codes tried against one MFA challenge before it is spent
+	MaxMFAChallenges         = 5    // Two-factor logins one account can have in progress at once
+	RecoveryCodeCount        = 10   // Recovery codes issued when two-factor authentication is enabled
+	PasswordResetDuration    = 60   // Minutes a password reset link stays valid
+	VerifyEmailDuration      = 48   // Hours an email verification link stays valid
+	LoginFreeAttempts        = 3    // Failed logins to an account before each further attempt is delayed
+	LoginIPFreeAttempts      = 10   // Failed logins from one IP before each further attempt is delayed
+	MaxLoginBackoff          = 300  // Upper bound in seconds for the doubling delay between failed logins
+	LoginLockoutFailures     = 10   // Failed logins that lock an account, LOGIN_LOCKOUT_FAILURES overrides
+	LoginLockoutDuration     = 15   // Minutes an account stays locked, LOGIN_LOCKOUT_MINUTES overrides
+	LoginFailureWindow       = 60   // Minutes without a failed login after which the count starts over
+	ChirpWriteRateLimit      = 30   // Chirp writes per minute, including likes, rechirps and edits
+	RedChirpWriteRateLimit   = 120  // Chirp writes per minute for Chirpy Red users
+	SearchRateLimit          = 60   // Searches per minute
+	RedSearchRateLimit       = 300  // Searches per minute for Chirpy Red users
+	SignupRateLimit          = 10   // Accounts created per hour from one IP
+	EmailRateLimit           = 5    // Password reset emails requested per hour from one IP
+	DeletionGracePeriod      = 0    // Days a deleted account can be restored by logging in, ACCOUNT_DELETION_GRACE_DAYS overrides
+	DataExportDuration       = 7    // Days an export archive can be downloaded, DATA_EXPORT_EXPIRY_DAYS overrides
+	SweepInterval            = 60   // Minutes between removals of lapsed accounts and expired export archives
+	MaxImportSize            = 10   // Megabytes accepted by a single chirp import, and of chirps.json once decompressed
 )
@@ -2,13 +2,13 @@ package authy
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -34,50 +34,20 @@ func GetBearerToken(headers http.Header) (string, error) {
 
 // MakeJWT creates and returns a JWT for the given user ID, using the provided secret and expiration duration.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	// Define the claims for the token
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
-	}
-
-	// Create a new token with the specified claims and signing method
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Sign the token with the provided secret key
-	signedToken, err := token.SignedString([]byte(tokenSecret))
+	ks, err := NewKeySet(NewHMACKey(tokenSecret))
 	if err != nil {
 		return "", err
 	}
-
-	return signedToken, nil
+	return ks.MakeJWT(userID, nil, expiresIn)
 }
 
+// ValidateJWT checks a JWT signed with the provided secret and returns the user ID it was issued to.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	// Define the claims structure
-	claims := &jwt.RegisteredClaims{}
-
-	// Parse the token with the claims and the provided secret key
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	// Check if the token is valid
-	if !token.Valid {
-		return uuid.Nil, jwt.ErrSignatureInvalid
-	}
-
-	// Parse the user ID from the claims
-	userID, err := uuid.Parse(claims.Subject)
+	ks, err := NewKeySet(NewHMACKey(tokenSecret))
 	if err != nil {
 		return uuid.Nil, err
 	}
-
-	return userID, nil
+	return ks.ValidateJWT(tokenString)
 }
 
 // HashPassword takes a plaintext password as input and returns a bcrypt hashed version of it.
@@ -113,6 +83,49 @@ func MakeRefreshToken() (string, error) {
 	return refreshToken, nil
 }
 
+// Scopes a personal access token can be granted. Access tokens from a login carry all of them.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+// Scopes lists every scope a personal access token can be granted.
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// Roles a user can hold. Roles are granted in the database and copied into access tokens at login,
+// but admin routes read them from the database on every request.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// personalTokenPrefix marks personal access tokens so they can be told apart from JWTs,
+// and so they are easy to spot if they leak into logs or a repository.
+const personalTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken generates a random 256-bit personal access token.
+func MakePersonalAccessToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", errors.New("failed to generate random bytes for personal access token")
+	}
+	return personalTokenPrefix + hex.EncodeToString(randomBytes), nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalTokenPrefix)
+}
+
+// HashToken returns the hex-encoded SHA-256 of a token, which is what gets stored in its place.
+// Tokens are random enough that a fast unsalted hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	header := headers.Get("Authorization")
 	if header == "" {
@@ -0,0 +1,238 @@
+package authy
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Key signs or verifies access tokens. Keys loaded from a public key can only verify.
+type Key struct {
+	ID      string // Sent as the JWT kid header
+	Method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// NewHMACKey wraps a shared secret. HMAC keys are never published in the JWKS.
+func NewHMACKey(secret string) *Key {
+	sum := sha256.Sum256([]byte(secret))
+	return &Key{
+		ID:      "hs256-" + base64.RawURLEncoding.EncodeToString(sum[:8]),
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+}
+
+// LoadKeyPEM reads an RSA or Ed25519 key from a PEM file. A private key can sign and verify;
+// a public key can only verify. The key ID is the key's RFC 7638 thumbprint, so the same key
+// always gets the same kid without any extra configuration.
+func LoadKeyPEM(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &Key{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T, use RSA or Ed25519", path, parsed)
+	}
+
+	if rsaKey, ok := key.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("%s: RSA keys must be at least 2048 bits", path)
+	}
+
+	thumbprint := sha256.Sum256([]byte(key.JWK().thumbprintInput()))
+	key.ID = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	return key, nil
+}
+
+// JWK is the public half of a key as published in a JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK describes the key's public half. It is only meaningful for RSA and Ed25519 keys.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// thumbprintInput is the canonical JSON that RFC 7638 hashes: required members only, in lexical order.
+func (j JWK) thumbprintInput() string {
+	if j.Kty == "RSA" {
+		return fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, j.E, j.N)
+	}
+	return fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, j.Crv, j.Kty, j.X)
+}
+
+// KeySet signs access tokens with one key and accepts tokens signed by any of its keys,
+// so a retired key can keep verifying tokens it issued until they expire.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet builds a key set that signs with signing and also verifies with the others.
+func NewKeySet(signing *Key, others ...*Key) (*KeySet, error) {
+	if signing == nil || signing.private == nil {
+		return nil, errors.New("signing key must include its private half")
+	}
+
+	ks := &KeySet{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, key := range others {
+		if _, exists := ks.keys[key.ID]; exists {
+			continue
+		}
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+// Claims are the claims of an access token: the standard ones plus the roles the user held when it was issued.
+// The roles are for clients to go by; the server checks the database, where they may have changed since.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// UserID returns the user the token was issued to.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// MakeJWT issues an access token for the user, signed with the current signing key.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, roles []string, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Roles: roles,
+	}
+
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.private)
+}
+
+// ParseJWT checks an access token against the key named by its kid and returns its claims.
+// Tokens without a kid predate key rotation and are checked against the signing key.
+func (ks *KeySet) ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		key := ks.signing
+		if kid, ok := token.Header["kid"].(string); ok {
+			key, ok = ks.keys[kid]
+			if !ok {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+		}
+		// The algorithm must be the key's own, or an RSA public key could be used as an HMAC secret
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	return claims, nil
+}
+
+// ValidateJWT checks an access token and returns the user ID it was issued to.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.ParseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+// JWKS lists the public keys other services need to verify access tokens offline.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if key.Method == jwt.SigningMethodHS256 {
+			continue
+		}
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
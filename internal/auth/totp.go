@@ -0,0 +1,70 @@
+package authy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpPeriod is the standard 30 second TOTP step every authenticator app supports.
+const totpPeriod = 30
+
+// GenerateTOTPSecret creates a new TOTP secret for an account and the otpauth:// URI
+// authenticator apps enrol it from, usually by scanning it as a QR code.
+func GenerateTOTPSecret(issuer, account string) (secret string, uri string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// ValidateTOTP checks a code against the secret, allowing one step of clock drift either way.
+// It returns the time step the code belongs to, so callers can refuse a code that was already used.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+	for _, skew := range []int64{0, -1, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, opts)
+		if err != nil {
+			return 0, false
+		}
+		if expected == code {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// MakeRecoveryCodes generates one-time codes for signing in without the authenticator,
+// formatted as two groups of five hex digits.
+func MakeRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		randomBytes := make([]byte, 5)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, errors.New("failed to generate random bytes for recovery code")
+		}
+		code := hex.EncodeToString(randomBytes)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode hashes a recovery code as typed by the user, ignoring case, spaces and dashes.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(code)
+}
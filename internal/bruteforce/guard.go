@@ -0,0 +1,123 @@
+// Package bruteforce slows down and locks out repeated failed logins.
+package bruteforce
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Record is the failure history of one key, such as a client IP or an account.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps failure records. Failures older than the window passed to Fail are forgotten
+// when the next failure arrives.
+type Store interface {
+	// Get returns the record for key, or a zero Record if there is none.
+	Get(ctx context.Context, key string) (Record, error)
+	// Fail counts a failure for key at now and returns the updated record.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error)
+	// Reset forgets key's failures.
+	Reset(ctx context.Context, key string) error
+	// Prune drops records whose last failure is before the given time.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// Policy decides how long a key must wait after its failures.
+type Policy struct {
+	FreeAttempts    int           // Failures allowed before any delay
+	BaseDelay       time.Duration // Delay after the first failure beyond the free ones, doubling after each
+	MaxDelay        time.Duration // Upper bound for the doubling delay
+	LockoutAfter    int           // Failures that lock the key out entirely, 0 to never lock out
+	LockoutDuration time.Duration // How long a lockout lasts
+	Window          time.Duration // Failures are forgotten after this long without another one
+}
+
+// blockedUntil returns when the key may try again, which is in the past when it may try now.
+func (p Policy) blockedUntil(record Record, now time.Time) time.Time {
+	if record.Failures == 0 || now.Sub(record.LastFailure) > p.Window {
+		return time.Time{}
+	}
+	if p.LockoutAfter > 0 && record.Failures >= p.LockoutAfter {
+		return record.LastFailure.Add(p.LockoutDuration)
+	}
+	excess := record.Failures - p.FreeAttempts
+	if excess <= 0 {
+		return time.Time{}
+	}
+	delay := p.BaseDelay
+	for i := 1; i < excess && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return record.LastFailure.Add(min(delay, p.MaxDelay))
+}
+
+// Guard applies one policy to client IPs and another to accounts. IPs are usually given more
+// room, since many users can share one behind NAT, and are never locked out.
+type Guard struct {
+	store     Store
+	ip        Policy
+	account   Policy
+	now       func() time.Time
+	lastPrune atomic.Int64
+}
+
+func NewGuard(store Store, ip, account Policy) *Guard {
+	return &Guard{store: store, ip: ip, account: account, now: time.Now}
+}
+
+func ipKey(ip string) string           { return "ip:" + ip }
+func accountKey(account string) string { return "account:" + account }
+
+// Check reports how long the client must wait before trying to log in to the account,
+// or zero if it may try now.
+func (g *Guard) Check(ctx context.Context, ip, account string) (time.Duration, error) {
+	now := g.now()
+	var until time.Time
+	for _, check := range []struct {
+		key    string
+		policy Policy
+	}{{ipKey(ip), g.ip}, {accountKey(account), g.account}} {
+		record, err := g.store.Get(ctx, check.key)
+		if err != nil {
+			return 0, err
+		}
+		if blocked := check.policy.blockedUntil(record, now); blocked.After(until) {
+			until = blocked
+		}
+	}
+	if !until.After(now) {
+		return 0, nil
+	}
+	return until.Sub(now), nil
+}
+
+// Failure counts a failed login from ip against account.
+func (g *Guard) Failure(ctx context.Context, ip, account string) error {
+	now := g.now()
+	if _, err := g.store.Fail(ctx, ipKey(ip), now, g.ip.Window); err != nil {
+		return err
+	}
+	if _, err := g.store.Fail(ctx, accountKey(account), now, g.account.Window); err != nil {
+		return err
+	}
+	return g.prune(ctx, now)
+}
+
+// Success clears the account's failures. The IP keeps its count, or an attacker holding one
+// valid account could log in to it between guesses at others to reset their own counter.
+func (g *Guard) Success(ctx context.Context, account string) error {
+	return g.store.Reset(ctx, accountKey(account))
+}
+
+// prune drops forgotten records at most once a minute.
+func (g *Guard) prune(ctx context.Context, now time.Time) error {
+	last := g.lastPrune.Load()
+	if now.Unix()-last < 60 || !g.lastPrune.CompareAndSwap(last, now.Unix()) {
+		return nil
+	}
+	return g.store.Prune(ctx, now.Add(-max(g.ip.Window, g.account.Window)))
+}
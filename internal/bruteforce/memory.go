@@ -0,0 +1,55 @@
+package bruteforce
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps failures in process memory. It suits a single instance; failures are
+// not shared with other instances and are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[key]
+	if now.Sub(record.LastFailure) > window {
+		record.Failures = 0
+	}
+	record.Failures++
+	record.LastFailure = now
+	s.records[key] = record
+	return record, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, record := range s.records {
+		if record.LastFailure.Before(before) {
+			delete(s.records, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package bruteforce
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+)
+
+// PostgresStore keeps failures in the login_attempts table, so every instance behind a
+// load balancer sees the same counts.
+type PostgresStore struct {
+	db database.Querier
+}
+
+func NewPostgresStore(db database.Querier) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Record, error) {
+	row, err := s.db.GetLoginAttempts(ctx, key)
+	if err == sql.ErrNoRows {
+		return Record{}, nil
+	} else if err != nil {
+		return Record{}, err
+	}
+	return Record{Failures: int(row.Failures), LastFailure: row.LastFailure}, nil
+}
+
+func (s *PostgresStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error) {
+	row, err := s.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		LastFailure: now,
+		WindowStart: now.Add(-window),
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Failures: int(row.Failures), LastFailure: row.LastFailure}, nil
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.db.ResetLoginAttempts(ctx, key)
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	return s.db.DeleteStaleLoginAttempts(ctx, before)
+}
@@ -7,30 +7,102 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const anonymizeReferencedChirps = `-- name: AnonymizeReferencedChirps :one
+WITH moved AS (
+    UPDATE chirps
+    SET user_id = $1, body = '', deleted_at = COALESCE(deleted_at, NOW()), updated_at = NOW()
+    WHERE user_id = $2
+    AND EXISTS (
+        SELECT 1 FROM chirps c
+        WHERE c.user_id <> $2
+        AND (c.parent_id = chirps.id OR c.root_id = chirps.id OR c.rechirp_of = chirps.id OR c.quote_of = chirps.id)
+    )
+    RETURNING id
+),
+revisions AS (
+    DELETE FROM chirp_revisions
+    WHERE chirp_id IN (SELECT id FROM moved)
+),
+tags AS (
+    DELETE FROM chirp_tags
+    WHERE chirp_id IN (SELECT id FROM moved)
+),
+mentions AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id IN (SELECT id FROM moved)
+)
+SELECT COUNT(*) FROM moved
+`
+
+type AnonymizeReferencedChirpsParams struct {
+	PlaceholderID uuid.UUID
+	UserID        uuid.UUID
+}
+
+// A deleted account's chirps that other users still reply to, rechirp or quote become tombstones
+// of the placeholder account. Moving a chirp can expose more of the account's chirps it refers
+// to, so this is repeated until it moves none. Each of the account's chirps is looked up in the
+// indexes on the reference columns rather than scanning every other user's chirps.
+func (q *Queries) AnonymizeReferencedChirps(ctx context.Context, arg AnonymizeReferencedChirpsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, anonymizeReferencedChirps, arg.PlaceholderID, arg.UserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countChirpReferences = `-- name: CountChirpReferences :one
+SELECT COUNT(*) FROM chirps
+WHERE parent_id = $1::uuid
+OR rechirp_of = $1::uuid
+OR quote_of = $1::uuid
+`
+
+// Replies, rechirps and quotes all need the chirp to stay around as a tombstone.
+func (q *Queries) CountChirpReferences(ctx context.Context, chirpID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpReferences, chirpID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, body, created_at, updated_at, user_id)
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, parent_id, root_id, quote_of)
 VALUES (
 gen_random_uuid(),
 $1,
 NOW(),
 NOW(),
-$2
+$2,
+$3,
+$4,
+$5
 )
-RETURNING id, body, created_at, updated_at, user_id
+RETURNING id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body     string
+	UserID   uuid.UUID
+	ParentID uuid.NullUUID
+	RootID   uuid.NullUUID
+	QuoteOf  uuid.NullUUID
 }
 
 // SQL Query to Create a Chirp in the Database
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ParentID,
+		arg.RootID,
+		arg.QuoteOf,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -38,6 +110,11 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
@@ -52,8 +129,18 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteUserChirps = `-- name: DeleteUserChirps :exec
+DELETE FROM chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserChirps(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUserChirps, userID)
+	return err
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, body, created_at, updated_at, user_id FROM chirps 
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of FROM chirps 
 WHERE id = $1
 LIMIT 1
 `
@@ -67,12 +154,85 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of FROM chirps
+WHERE id = $1
+LIMIT 1
+FOR UPDATE
+`
+
+// Locks the chirp so nothing can reply to, rechirp or quote it until the transaction ends.
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ParentID,
+		&i.RootID,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
 
+const getChirpThread = `-- name: GetChirpThread :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE id = $1 OR root_id = $1
+ORDER BY created_at ASC, id ASC
+`
+
+// The root chirp of a conversation together with every chirp in it.
+func (q *Queries) GetChirpThread(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpThread, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirps = `-- name: GetChirps :many
-SELECT id, body, created_at, updated_at, user_id FROM chirps
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of FROM chirps
 ORDER BY created_at ASC
 `
 
@@ -91,6 +251,11 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
 		); err != nil {
 			return nil, err
 		}
@@ -106,7 +271,7 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-SELECT id, body, created_at, updated_at, user_id
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of
 FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC
@@ -127,6 +292,11 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
 		); err != nil {
 			return nil, err
 		}
@@ -141,21 +311,70 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 	return items, nil
 }
 
-const getChirpsWithFilterAndSort = `-- name: GetChirpsWithFilterAndSort :many
-SELECT id, body, created_at, updated_at, user_id
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpReplies = `-- name: ListChirpReplies :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of
 FROM chirps
-WHERE ($1 = '00000000-0000-0000-0000-000000000000' OR user_id = $1::uuid)
-ORDER BY 
-created_at $2
+WHERE parent_id = $1
+AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
 `
 
-type GetChirpsWithFilterAndSortParams struct {
-	Column1 interface{}
-	Column2 interface{}
+type ListChirpRepliesParams struct {
+	ParentID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
 }
 
-func (q *Queries) GetChirpsWithFilterAndSort(ctx context.Context, arg GetChirpsWithFilterAndSortParams) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsWithFilterAndSort, arg.Column1, arg.Column2)
+// Direct replies to a chirp, oldest first.
+func (q *Queries) ListChirpReplies(ctx context.Context, arg ListChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -169,6 +388,11 @@ func (q *Queries) GetChirpsWithFilterAndSort(ctx context.Context, arg GetChirpsW
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
 		); err != nil {
 			return nil, err
 		}
@@ -182,3 +406,145 @@ func (q *Queries) GetChirpsWithFilterAndSort(ctx context.Context, arg GetChirpsW
 	}
 	return items, nil
 }
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+// Keyset pagination over (created_at, id) so pages stay stable while new chirps arrive.
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, root_id, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.RootID,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+WITH revisions AS (
+    DELETE FROM chirp_revisions
+    WHERE chirp_id = $1
+),
+tags AS (
+    DELETE FROM chirp_tags
+    WHERE chirp_id = $1
+),
+mentions AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id = $1
+)
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+// Tombstones keep a deleted chirp's place in a thread so its replies are not orphaned.
+// Earlier revisions, hashtags and mentions go with the body.
+func (q *Queries) TombstoneChirp(ctx context.Context, chirpID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, chirpID)
+	return err
+}
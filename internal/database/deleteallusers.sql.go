@@ -11,8 +11,10 @@ import (
 
 const deleteAllUsers = `-- name: DeleteAllUsers :exec
 DELETE FROM users
+WHERE id <> '00000000-0000-0000-0000-000000000000'
 `
 
+// The placeholder that owns deleted accounts' tombstones is kept.
 func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, deleteAllUsers)
 	return err
@@ -17,15 +17,154 @@ type Chirp struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	RootID    uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+}
+
+type ChirpImport struct {
+	UserID    uuid.UUID
+	SourceID  string
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpRevision struct {
+	ID        uuid.UUID
+	ChirpID   uuid.UUID
+	Body      string
+	CreatedAt time.Time
+}
+
+type ChirpTag struct {
+	ChirpID   uuid.UUID
+	TagID     uuid.UUID
+	CreatedAt time.Time
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Status      string
+	Archive     []byte
+	CreatedAt   time.Time
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+}
+
+type EmailToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginAttempt struct {
+	Key         string
+	Failures    int32
+	LastFailure time.Time
+}
+
+type MfaChallenge struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	Attempts  int32
+}
+
+type ModerationQueue struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	ChirpID         uuid.NullUUID
+	Body            string
+	ParentID        uuid.NullUUID
+	QuoteOf         uuid.NullUUID
+	Reason          string
+	CreatedAt       time.Time
+	SourceID        sql.NullString
+	SourceCreatedAt sql.NullTime
+	SourceUpdatedAt sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt sql.NullTime
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
-	Token     string
+	TokenHash string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+	RotatedAt sql.NullTime
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+type SubscriptionEvent struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Event     string
+	CreatedAt time.Time
+}
+
+type Tag struct {
+	ID        uuid.UUID
+	Name      string
+	CreatedAt time.Time
 }
 
 type User struct {
@@ -35,4 +174,17 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsChirpyRed    bool
+	Username       string
+	EmailVerified  bool
+	Roles          []string
+	SuspendedAt    sql.NullTime
+	DeleteAfter    sql.NullTime
+}
+
+type UserTotp struct {
+	UserID      uuid.UUID
+	Secret      string
+	LastStep    int64
+	CreatedAt   time.Time
+	ConfirmedAt sql.NullTime
 }
@@ -7,13 +7,15 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const authUser = `-- name: AuthUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users 
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, email_verified, roles, suspended_at, delete_after FROM users 
 WHERE email = $1
 LIMIT 1
 `
@@ -28,58 +30,105 @@ func (q *Queries) AuthUser(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.EmailVerified,
+		pq.Array(&i.Roles),
+		&i.SuspendedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
+const cancelAccountDeletion = `-- name: CancelAccountDeletion :execrows
+UPDATE users
+SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NOT NULL
+`
+
+// Logging in during the grace period keeps the account.
+func (q *Queries) CancelAccountDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelAccountDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (
-gen_random_uuid(),
+WITH new_user AS (
+    SELECT gen_random_uuid() AS id
+)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+SELECT
+id,
 NOW(),
 NOW(),
 $1,
-$2
-)
-RETURNING id, created_at, updated_at, email
+$2,
+COALESCE($3::text, 'user_' || left(replace(id::text, '-', ''), 12))
+FROM new_user
+RETURNING id, created_at, updated_at, email, username, email_verified
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Username       sql.NullString
 }
 
 type CreateUserRow struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Email     string
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Email         string
+	Username      string
+	EmailVerified bool
 }
 
+// Users who sign up without a username get a placeholder derived from their ID.
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Username)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
+		&i.Username,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, is_chirpy_red FROM users 
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified, roles, suspended_at FROM users 
 WHERE id = $1
 LIMIT 1
 `
 
 type GetUserRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Email       string
-	IsChirpyRed bool
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Email         string
+	IsChirpyRed   bool
+	Username      string
+	EmailVerified bool
+	Roles         []string
+	SuspendedAt   sql.NullTime
 }
 
 func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (GetUserRow, error) {
@@ -91,21 +140,27 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (GetUserRow, error)
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.EmailVerified,
+		pq.Array(&i.Roles),
+		&i.SuspendedAt,
 	)
 	return i, err
 }
 
 const getUsers = `-- name: GetUsers :many
-SELECT id, created_at, updated_at, email, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified FROM users
 ORDER BY id
 `
 
 type GetUsersRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Email       string
-	IsChirpyRed bool
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Email         string
+	IsChirpyRed   bool
+	Username      string
+	EmailVerified bool
 }
 
 func (q *Queries) GetUsers(ctx context.Context) ([]GetUsersRow, error) {
@@ -123,6 +178,8 @@ func (q *Queries) GetUsers(ctx context.Context) ([]GetUsersRow, error) {
 			&i.UpdatedAt,
 			&i.Email,
 			&i.IsChirpyRed,
+			&i.Username,
+			&i.EmailVerified,
 		); err != nil {
 			return nil, err
 		}
@@ -137,34 +194,223 @@ func (q *Queries) GetUsers(ctx context.Context) ([]GetUsersRow, error) {
 	return items, nil
 }
 
-const updateUser = `-- name: UpdateUser :one
+const listAccountsDueForDeletion = `-- name: ListAccountsDueForDeletion :many
+SELECT id FROM users
+WHERE delete_after <= $1::timestamp
+ORDER BY delete_after
+`
+
+func (q *Queries) ListAccountsDueForDeletion(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountsDueForDeletion, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified, roles, suspended_at
+FROM users
+WHERE id <> '00000000-0000-0000-0000-000000000000'
+AND (
+    $1::timestamp IS NULL
+    OR (created_at, id) > ($1::timestamp, $2::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $3
+`
+
+type ListUsersParams struct {
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageLimit       int32
+}
+
+type ListUsersRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Email         string
+	IsChirpyRed   bool
+	Username      string
+	EmailVerified bool
+	Roles         []string
+	SuspendedAt   sql.NullTime
+}
+
+// Every user but the placeholder that owns deleted accounts' chirps, oldest account first, for
+// administrators.
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers, arg.CursorCreatedAt, arg.CursorID, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersRow
+	for rows.Next() {
+		var i ListUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.IsChirpyRed,
+			&i.Username,
+			&i.EmailVerified,
+			pq.Array(&i.Roles),
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified = true, updated_at = NOW()
+WHERE id = $1 AND email = $2
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// Only verifies the address the token was sent to, in case the email changed since.
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleAccountDeletion = `-- name: ScheduleAccountDeletion :exec
+UPDATE users
+SET delete_after = $1::timestamp, updated_at = NOW()
+WHERE id = $2
+`
+
+type ScheduleAccountDeletionParams struct {
+	DeleteAfter time.Time
+	ID          uuid.UUID
+}
+
+func (q *Queries) ScheduleAccountDeletion(ctx context.Context, arg ScheduleAccountDeletionParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleAccountDeletion, arg.DeleteAfter, arg.ID)
+	return err
+}
+
+const setUserPassword = `-- name: SetUserPassword :exec
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
+SET hashed_password = $2, updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email
 `
 
-type UpdateUserParams struct {
+type SetUserPasswordParams struct {
 	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const suspendUser = `-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, NOW()), updated_at = NOW()
+WHERE id = $1 AND id <> '00000000-0000-0000-0000-000000000000'
+`
+
+// The placeholder account of deleted users is never suspended.
+func (q *Queries) SuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, suspendUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :execrows
+UPDATE users
+SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1 AND id <> '00000000-0000-0000-0000-000000000000'
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unsuspendUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET email = $1,
+    hashed_password = $2,
+    username = COALESCE($3::text, username),
+    email_verified = email_verified AND email = $1,
+    updated_at = NOW()
+WHERE id = $4
+RETURNING id, created_at, updated_at, email, username, email_verified
+`
+
+type UpdateUserParams struct {
 	Email          string
 	HashedPassword string
+	Username       sql.NullString
+	ID             uuid.UUID
 }
 
 type UpdateUserRow struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Email     string
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Email         string
+	Username      string
+	EmailVerified bool
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Username,
+		arg.ID,
+	)
 	var i UpdateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
+		&i.Username,
+		&i.EmailVerified,
 	)
 	return i, err
 }
@@ -0,0 +1,162 @@
+// Package mailer sends the transactional email Chirpy needs, such as password resets.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects a mailer. SMTP is used when SMTPAddr is set, then a directory of files when
+// Dir is set, and otherwise mail is logged and dropped.
+type Config struct {
+	From         string
+	SMTPAddr     string // host:port
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+}
+
+// New builds the mailer described by cfg.
+func New(cfg Config) (Mailer, error) {
+	switch {
+	case cfg.SMTPAddr != "":
+		if cfg.From == "" {
+			return nil, fmt.Errorf("a from address is required to send mail over SMTP")
+		}
+		return NewSMTPMailer(cfg.SMTPAddr, cfg.From, cfg.SMTPUsername, cfg.SMTPPassword), nil
+	case cfg.Dir != "":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	default:
+		log.Printf("No SMTP server or mail directory configured, email will not be delivered")
+		return DiscardMailer{}, nil
+	}
+}
+
+// format renders a message in RFC 5322 form.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// validHeader rejects header values that could smuggle in extra headers.
+func validHeader(value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("mail header contains a line break: %q", value)
+	}
+	return nil
+}
+
+// SMTPMailer sends mail through an SMTP server, authenticating with PLAIN auth when a username is set.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := validHeader(msg.To); err != nil {
+		return err
+	}
+	if err := validHeader(msg.Subject); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg))
+}
+
+// FileMailer writes each message to its own .eml file, for development and tests.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := validHeader(msg.To); err != nil {
+		return err
+	}
+	if err := validHeader(msg.Subject); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(m.dir, time.Now().UTC().Format("20060102T150405")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(format(m.from, msg))
+	return err
+}
+
+// DiscardMailer logs who each message was for and drops it. The body is not logged, since
+// it carries tokens such as password reset links.
+type DiscardMailer struct{}
+
+func (DiscardMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Not delivering %q to %s, no mailer is configured", msg.Subject, msg.To)
+	return nil
+}
+
+// MemoryMailer keeps messages in memory so tests can read them back. Nothing is ever
+// dropped, so it is not for use in a running server.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns every message sent so far, oldest first.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,19 @@
+package mailer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewWithoutDeliveryDiscards(t *testing.T) {
+	m, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, ok := m.(DiscardMailer); !ok {
+		t.Fatalf("New without SMTP or a directory = %T, want DiscardMailer", m)
+	}
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Reset your password"}); err != nil {
+		t.Errorf("Send: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package moderation decides what happens to chirp bodies that break the content rules.
+package moderation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is what happens to a body that matches a rule. When several rules match, the strongest action wins.
+type Action int
+
+const (
+	Allow Action = iota
+	Mask
+	Hold
+	Reject
+)
+
+// maskText replaces masked words, the same four asterisks chirps have always used.
+const maskText = "****"
+
+var actionNames = map[Action]string{
+	Allow:  "allow",
+	Mask:   "mask",
+	Hold:   "hold",
+	Reject: "reject",
+}
+
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction reads an action name as used in word lists and rule files.
+func ParseAction(name string) (Action, error) {
+	for action, actionName := range actionNames {
+		if strings.EqualFold(name, actionName) {
+			return action, nil
+		}
+	}
+	return Allow, fmt.Errorf("unknown moderation action %q", name)
+}
+
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Action) UnmarshalText(text []byte) error {
+	action, err := ParseAction(string(text))
+	if err != nil {
+		return err
+	}
+	*a = action
+	return nil
+}
+
+// Match records a rule that fired on a body.
+type Match struct {
+	Rule   string
+	Action Action
+}
+
+// Result is the outcome of moderating a body.
+type Result struct {
+	Body    string  // The body with every masked match replaced
+	Action  Action  // The strongest action among the matches
+	Matches []Match // Every rule that fired, in filter order
+}
+
+// Rules lists the distinct rules that fired with the given action.
+func (r Result) Rules(action Action) []string {
+	var rules []string
+	seen := make(map[string]bool)
+	for _, match := range r.Matches {
+		if match.Action == action && !seen[match.Rule] {
+			seen[match.Rule] = true
+			rules = append(rules, match.Rule)
+		}
+	}
+	return rules
+}
+
+// Filter checks a body against its rules, masking the matches whose rule says so.
+type Filter interface {
+	Apply(body string) (string, []Match)
+}
+
+// Moderator decides what happens to a chirp body.
+type Moderator interface {
+	Moderate(body string) Result
+}
+
+// Pipeline chains filters, each one seeing the body as masked by the ones before it.
+type Pipeline struct {
+	filters []Filter
+}
+
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+func (p *Pipeline) Moderate(body string) Result {
+	result := Result{Body: body, Action: Allow}
+	for _, filter := range p.filters {
+		var matches []Match
+		result.Body, matches = filter.Apply(result.Body)
+		for _, match := range matches {
+			result.Action = max(result.Action, match.Action)
+		}
+		result.Matches = append(result.Matches, matches...)
+	}
+	return result
+}
+
+// DefaultWords are masked when no word list file is configured.
+var DefaultWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+// Config names the files a pipeline is built from.
+type Config struct {
+	WordListPath string // Word list, see LoadWordList. Empty uses DefaultWords
+	RulesPath    string // JSON regex rules, see LoadRegexRules. Empty means no regex rules
+}
+
+// New builds the pipeline described by cfg: the word list first, then the regex rules.
+func New(cfg Config) (*Pipeline, error) {
+	words := NewWordFilter(nil)
+	for _, word := range DefaultWords {
+		words.Add(word, Mask)
+	}
+	if cfg.WordListPath != "" {
+		var err error
+		words, err = LoadWordList(cfg.WordListPath, Mask)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filters := []Filter{words}
+	if cfg.RulesPath != "" {
+		rules, err := LoadRegexRules(cfg.RulesPath)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, rules)
+	}
+
+	return NewPipeline(filters...), nil
+}
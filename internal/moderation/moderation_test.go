@@ -0,0 +1,96 @@
+package moderation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Action
+		wantErr bool
+	}{
+		{"allow", Allow, false},
+		{"Mask", Mask, false},
+		{"HOLD", Hold, false},
+		{"reject", Reject, false},
+		{"ban", Allow, true},
+		{"", Allow, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAction(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseAction(%q) = %v, %v, want %v and error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if got := Action(7).String(); got != "Action(7)" {
+		t.Errorf("unknown action prints as %q", got)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	words := NewWordFilter(map[string]Action{"fornax": Mask, "sharbert": Hold})
+	rules, err := NewRegexFilter([]RegexRule{
+		{Name: "stars", Pattern: `\*{4}`, Action: Hold},
+		{Name: "spam", Pattern: `(?i)buy now`, Action: Reject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPipeline(words, rules)
+
+	tests := []struct {
+		name   string
+		body   string
+		want   Result
+		held   []string
+		masked []string
+	}{
+		{
+			name: "allowed",
+			body: "hello",
+			want: Result{Body: "hello", Action: Allow},
+		},
+		{
+			name:   "masked words reach the regex rules masked",
+			body:   "fornax fornax",
+			want:   Result{Body: "**** ****", Action: Hold, Matches: []Match{{"word:fornax", Mask}, {"word:fornax", Mask}, {"regex:stars", Hold}}},
+			held:   []string{"regex:stars"},
+			masked: []string{"word:fornax"},
+		},
+		{
+			name: "strongest action wins",
+			body: "sharbert, buy now",
+			want: Result{Body: "sharbert, buy now", Action: Reject, Matches: []Match{{"word:sharbert", Hold}, {"regex:spam", Reject}}},
+			held: []string{"word:sharbert"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.Moderate(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Moderate(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+			if rules := got.Rules(Hold); !reflect.DeepEqual(rules, tt.held) {
+				t.Errorf("held by %v, want %v", rules, tt.held)
+			}
+			if rules := got.Rules(Mask); !reflect.DeepEqual(rules, tt.masked) {
+				t.Errorf("masked by %v, want %v", rules, tt.masked)
+			}
+		})
+	}
+}
+
+func TestNewUsesDefaultWords(t *testing.T) {
+	p, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, word := range DefaultWords {
+		if got := p.Moderate("a " + word); got.Body != "a ****" || got.Action != Mask {
+			t.Errorf("Moderate(%q) = %+v, want it masked", word, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// RegexRule matches bodies against a regular expression, such as a pattern for spam links.
+type RegexRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Action  Action `json:"action"`
+}
+
+type compiledRule struct {
+	RegexRule
+	re *regexp.Regexp
+}
+
+// RegexFilter applies regex rules in order.
+type RegexFilter struct {
+	rules []compiledRule
+}
+
+func NewRegexFilter(rules []RegexRule) (*RegexFilter, error) {
+	f := &RegexFilter{rules: make([]compiledRule, len(rules))}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("regex rule %d has no name", i)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("regex rule %q: %w", rule.Name, err)
+		}
+		f.rules[i] = compiledRule{RegexRule: rule, re: re}
+	}
+	return f, nil
+}
+
+// LoadRegexRules reads a JSON array of rules:
+//
+//	[{"name": "links", "pattern": "(?i)https?://", "action": "hold"}]
+func LoadRegexRules(path string) (*RegexFilter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading regex rules: %w", err)
+	}
+
+	var rules []RegexRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing regex rules: %w", err)
+	}
+
+	return NewRegexFilter(rules)
+}
+
+func (f *RegexFilter) Apply(body string) (string, []Match) {
+	var matches []Match
+	for _, rule := range f.rules {
+		if !rule.re.MatchString(body) {
+			continue
+		}
+		matches = append(matches, Match{Rule: "regex:" + rule.Name, Action: rule.Action})
+		if rule.Action == Mask {
+			body = rule.re.ReplaceAllLiteralString(body, maskText)
+		}
+	}
+	return body, matches
+}
@@ -0,0 +1,89 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewRegexFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []RegexRule
+		wantErr string
+	}{
+		{"valid", []RegexRule{{Name: "links", Pattern: `(?i)https?://`, Action: Hold}}, ""},
+		{"no name", []RegexRule{{Pattern: "x", Action: Mask}}, "regex rule 0 has no name"},
+		{"bad pattern", []RegexRule{{Name: "broken", Pattern: "(", Action: Mask}}, `regex rule "broken"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegexFilter(tt.rules)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("NewRegexFilter: %v", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("NewRegexFilter error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegexFilter(t *testing.T) {
+	f, err := NewRegexFilter([]RegexRule{
+		{Name: "phone", Pattern: `\d{3}-\d{4}`, Action: Mask},
+		{Name: "links", Pattern: `(?i)https?://`, Action: Hold},
+		// Sees the body after the phone numbers are masked
+		{Name: "digits", Pattern: `\d`, Action: Reject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		matches []Match
+	}{
+		{"no match", "hello", "hello", nil},
+		{"masked", "call 555-1234 or 555-9876", "call **** or ****", []Match{{"regex:phone", Mask}}},
+		{"held", "see HTTPS://example.com", "see HTTPS://example.com", []Match{{"regex:links", Hold}}},
+		{"later rules see masks", "555-1234 then 7", "**** then 7", []Match{{"regex:phone", Mask}, {"regex:digits", Reject}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, matches := f.Apply(tt.body)
+			if got != tt.want || !reflect.DeepEqual(matches, tt.matches) {
+				t.Errorf("Apply(%q) = %q, %+v, want %q, %+v", tt.body, got, matches, tt.want, tt.matches)
+			}
+		})
+	}
+}
+
+func TestLoadRegexRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{"valid", `[{"name": "links", "pattern": "(?i)https?://", "action": "hold"}]`, ""},
+		{"unknown action", `[{"name": "links", "pattern": "x", "action": "ban"}]`, "parsing regex rules"},
+		{"not json", `links: x`, "parsing regex rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(path, []byte(tt.rules), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadRegexRules(path)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("LoadRegexRules: %v", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("LoadRegexRules error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
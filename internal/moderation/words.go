@@ -0,0 +1,136 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Token is a word in a body, with its byte offsets so it can be masked in place.
+type Token struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Tokenize splits a body into words, treating punctuation and spaces as separators,
+// so "fornax!" and "(fornax)" both yield "fornax". Invisible formatting characters
+// stay inside the word so they cannot be used to break it up.
+func Tokenize(body string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range body {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			tokens = append(tokens, Token{Text: body[start:i], Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{Text: body[start:], Start: start, End: len(body)})
+	}
+	return tokens
+}
+
+var folder = cases.Fold()
+
+// Normalize reduces a word to the form used for matching: compatibility characters such as
+// fullwidth letters are unified, accents and invisible characters are dropped, and case is folded.
+func Normalize(word string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), runes.Remove(runes.In(unicode.Cf)), norm.NFC)
+	normalized, _, err := transform.String(t, word)
+	if err != nil {
+		normalized = word
+	}
+	return folder.String(normalized)
+}
+
+// WordFilter matches whole words against a list, ignoring case, accents and lookalike characters.
+type WordFilter struct {
+	words map[string]Action
+}
+
+func NewWordFilter(words map[string]Action) *WordFilter {
+	f := &WordFilter{words: make(map[string]Action, len(words))}
+	for word, action := range words {
+		f.Add(word, action)
+	}
+	return f
+}
+
+// Add puts a word on the list, replacing its action if it is already there.
+func (f *WordFilter) Add(word string, action Action) {
+	f.words[Normalize(word)] = action
+}
+
+// LoadWordList reads a word list with one word per line, optionally followed by an action:
+//
+//	# comments and blank lines are ignored
+//	fornax
+//	sharbert hold
+//
+// Words without an action get defaultAction.
+func LoadWordList(path string, defaultAction Action) (*WordFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening word list: %w", err)
+	}
+	defer file.Close()
+
+	f := NewWordFilter(nil)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		action := defaultAction
+		switch len(fields) {
+		case 1:
+		case 2:
+			action, err = ParseAction(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: expected a word and an optional action", path, lineNumber)
+		}
+		f.Add(fields[0], action)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading word list: %w", err)
+	}
+
+	return f, nil
+}
+
+func (f *WordFilter) Apply(body string) (string, []Match) {
+	var matches []Match
+	var masked strings.Builder
+	last := 0
+	for _, token := range Tokenize(body) {
+		word := Normalize(token.Text)
+		action, ok := f.words[word]
+		if !ok {
+			continue
+		}
+		matches = append(matches, Match{Rule: "word:" + word, Action: action})
+		if action == Mask {
+			masked.WriteString(body[last:token.Start])
+			masked.WriteString(maskText)
+			last = token.End
+		}
+	}
+	masked.WriteString(body[last:])
+	return masked.String(), matches
+}
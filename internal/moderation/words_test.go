@@ -0,0 +1,122 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Token
+	}{
+		{"empty", "", nil},
+		{"punctuation", "fornax!", []Token{{"fornax", 0, 6}}},
+		{"brackets and spaces", "(fornax) go", []Token{{"fornax", 1, 7}, {"go", 9, 11}}},
+		{"digits", "route 66", []Token{{"route", 0, 5}, {"66", 6, 8}}},
+		{"zero width space", "for\u200bnax", []Token{{"for\u200bnax", 0, 9}}},
+		{"combining accent", "fo\u0301rnax", []Token{{"fo\u0301rnax", 0, 8}}},
+		{"multibyte offsets", "é fornax", []Token{{"é", 0, 2}, {"fornax", 3, 9}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"fornax", "fornax"},
+		{"FORNAX", "fornax"},
+		{"Fórnax", "fornax"},
+		{"fo\u0301rnax", "fornax"},
+		{"ｆｏｒｎａｘ", "fornax"},
+		{"for\u200bnax", "fornax"},
+		{"Straße", "strasse"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.word); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestWordFilter(t *testing.T) {
+	f := NewWordFilter(map[string]Action{"fornax": Mask, "sharbert": Hold, "Kerfuffle": Reject})
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		matches []Match
+	}{
+		{"no match", "hello world", "hello world", nil},
+		{"masked", "FORNAX!", "****!", []Match{{"word:fornax", Mask}}},
+		{"whole words only", "fornaxes", "fornaxes", nil},
+		{"held", "a sharbert", "a sharbert", []Match{{"word:sharbert", Hold}}},
+		{"list is normalized", "kerfuffle", "kerfuffle", []Match{{"word:kerfuffle", Reject}}},
+		{"lookalikes", "ｆｏｒｎａｘ and fórnax", "**** and ****", []Match{{"word:fornax", Mask}, {"word:fornax", Mask}}},
+		{"hidden in a word", "for\u200bnax", "****", []Match{{"word:fornax", Mask}}},
+		{"mixed", "sharbert fornax", "sharbert ****", []Match{{"word:sharbert", Hold}, {"word:fornax", Mask}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, matches := f.Apply(tt.body)
+			if got != tt.want || !reflect.DeepEqual(matches, tt.matches) {
+				t.Errorf("Apply(%q) = %q, %+v, want %q, %+v", tt.body, got, matches, tt.want, tt.matches)
+			}
+		})
+	}
+}
+
+func TestLoadWordList(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    map[string]Action
+		wantErr string
+	}{
+		{
+			name: "actions",
+			list: "# comment\n\nfornax\nSharbert hold\nkerfuffle REJECT\n",
+			want: map[string]Action{"fornax": Mask, "sharbert": Hold, "kerfuffle": Reject},
+		},
+		{name: "unknown action", list: "fornax\nsharbert ban\n", wantErr: ":2: unknown moderation action"},
+		{name: "too many fields", list: "fornax mask now\n", wantErr: ":1: expected a word"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "words.txt")
+			if err := os.WriteFile(path, []byte(tt.list), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := LoadWordList(path, Mask)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadWordList error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadWordList: %v", err)
+			}
+			if !reflect.DeepEqual(f.words, tt.want) {
+				t.Errorf("loaded %v, want %v", f.words, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadWordList(filepath.Join(t.TempDir(), "missing.txt"), Mask); err == nil {
+		t.Error("loading a missing word list succeeded")
+	}
+}
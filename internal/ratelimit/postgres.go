@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so limits hold across
+// every instance. Each request costs a write, so it suits low-volume routes best.
+type PostgresStore struct {
+	db database.Querier
+}
+
+func NewPostgresStore(db database.Querier) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	row, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:        key,
+		Capacity:   float64(limit.Requests),
+		RefillRate: limit.rate(),
+		Now:        now,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(limit, row.Tokens, row.Allowed, now), nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	return s.db.DeleteIdleRateLimitBuckets(ctx, before)
+}
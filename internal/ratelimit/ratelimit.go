@@ -0,0 +1,86 @@
+// Package ratelimit limits how often a client may call an endpoint, using token buckets.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows a burst of Requests, refilled evenly over Per.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// rate is the refill rate in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result describes a bucket after a request was counted against it.
+type Result struct {
+	Allowed    bool
+	Limit      int           // Size of the bucket
+	Remaining  int           // Whole tokens left
+	Reset      time.Time     // When the bucket will be full again
+	RetryAfter time.Duration // How long until a request would be allowed, when it was not
+}
+
+func newResult(limit Limit, tokens float64, allowed bool, now time.Time) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     now.Add(time.Duration((float64(limit.Requests) - tokens) / limit.rate() * float64(time.Second))),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / limit.rate() * float64(time.Second))
+	}
+	return result
+}
+
+// Store keeps buckets.
+type Store interface {
+	// Take refills key's bucket up to now and takes a token from it if one is left.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	// Prune drops buckets not touched since before.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// Limiter counts requests against a store and clears out idle buckets as it goes.
+type Limiter struct {
+	store     Store
+	now       func() time.Time
+	mu        sync.Mutex
+	maxPer    time.Duration
+	lastPrune time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow counts a request for key against limit.
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := l.now()
+
+	// A bucket left alone for its longest refill period is full, which is the same as not having one
+	l.mu.Lock()
+	l.maxPer = max(l.maxPer, limit.Per)
+	prune := now.Sub(l.lastPrune) >= time.Minute
+	if prune {
+		l.lastPrune = now
+	}
+	before := now.Add(-l.maxPer)
+	l.mu.Unlock()
+
+	if prune {
+		if err := l.store.Prune(ctx, before); err != nil {
+			return Result{}, err
+		}
+	}
+
+	return l.store.Take(ctx, key, limit, now)
+}
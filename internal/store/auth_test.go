@@ -0,0 +1,471 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		token, err := s.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+			UserID:    alice.ID,
+			Name:      "ci",
+			TokenHash: "live",
+			Scopes:    []string{"chirps:read", "chirps:write"},
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("CreatePersonalAccessToken: %v", err)
+		}
+		if !slices.Equal(token.Scopes, []string{"chirps:read", "chirps:write"}) || token.LastUsedAt.Valid {
+			t.Errorf("created token = %+v", token)
+		}
+		_, err = s.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+			UserID:    alice.ID,
+			Name:      "old",
+			TokenHash: "expired",
+			Scopes:    []string{},
+			ExpiresAt: time.Now().Add(-time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("CreatePersonalAccessToken: %v", err)
+		}
+
+		used, err := s.UsePersonalAccessToken(ctx, "live")
+		if err != nil || used.ID != token.ID || !used.LastUsedAt.Valid {
+			t.Errorf("UsePersonalAccessToken = %+v, %v", used, err)
+		}
+		if _, err := s.UsePersonalAccessToken(ctx, "expired"); err != sql.ErrNoRows {
+			t.Errorf("using an expired token: got %v, want sql.ErrNoRows", err)
+		}
+
+		// Tokens of suspended users stop working
+		if _, err := s.SuspendUser(ctx, alice.ID); err != nil {
+			t.Fatalf("SuspendUser: %v", err)
+		}
+		if _, err := s.UsePersonalAccessToken(ctx, "live"); err != sql.ErrNoRows {
+			t.Errorf("using a suspended user's token: got %v, want sql.ErrNoRows", err)
+		}
+
+		tokens, err := s.ListPersonalAccessTokens(ctx, alice.ID)
+		if err != nil || len(tokens) != 2 {
+			t.Errorf("ListPersonalAccessTokens = %+v, %v, want 2 tokens", tokens, err)
+		}
+		if n, err := s.DeletePersonalAccessToken(ctx, database.DeletePersonalAccessTokenParams{ID: token.ID, UserID: bob.ID}); err != nil || n != 0 {
+			t.Errorf("deleting another user's token = %d, %v, want 0", n, err)
+		}
+		if n, err := s.DeletePersonalAccessToken(ctx, database.DeletePersonalAccessTokenParams{ID: token.ID, UserID: alice.ID}); err != nil || n != 1 {
+			t.Errorf("DeletePersonalAccessToken = %d, %v, want 1", n, err)
+		}
+
+		_, err = s.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+			UserID:    bob.ID,
+			Name:      "bob",
+			TokenHash: "bob",
+			Scopes:    []string{},
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("CreatePersonalAccessToken: %v", err)
+		}
+		if err := s.DeleteUserPersonalAccessTokens(ctx, alice.ID); err != nil {
+			t.Fatalf("DeleteUserPersonalAccessTokens: %v", err)
+		}
+		if tokens, err := s.ListPersonalAccessTokens(ctx, alice.ID); err != nil || len(tokens) != 0 {
+			t.Errorf("tokens left after DeleteUserPersonalAccessTokens = %+v, %v", tokens, err)
+		}
+		if tokens, err := s.ListPersonalAccessTokens(ctx, bob.ID); err != nil || len(tokens) != 1 {
+			t.Errorf("another user's tokens after DeleteUserPersonalAccessTokens = %+v, %v, want 1", tokens, err)
+		}
+	})
+}
+
+func TestMFAChallenges(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+
+		challenges := map[string]time.Time{
+			"live":    time.Now().Add(time.Minute),
+			"expired": time.Now().Add(-time.Minute),
+		}
+		for hash, expires := range challenges {
+			created, err := s.CreateMFAChallenge(ctx, database.CreateMFAChallengeParams{
+				UserID:        alice.ID,
+				TokenHash:     hash,
+				ExpiresAt:     expires,
+				MaxChallenges: 2,
+			})
+			if err != nil || created != 1 {
+				t.Fatalf("CreateMFAChallenge = %d, %v, want 1", created, err)
+			}
+		}
+
+		// Expired challenges do not count towards the limit, but live ones do
+		for _, tt := range []struct {
+			hash string
+			want int64
+		}{{"second", 1}, {"third", 0}} {
+			created, err := s.CreateMFAChallenge(ctx, database.CreateMFAChallengeParams{
+				UserID:        alice.ID,
+				TokenHash:     tt.hash,
+				ExpiresAt:     time.Now().Add(time.Minute),
+				MaxChallenges: 2,
+			})
+			if err != nil || created != tt.want {
+				t.Errorf("CreateMFAChallenge(%s) = %d, %v, want %d", tt.hash, created, err, tt.want)
+			}
+		}
+
+		attempt := database.AttemptMFAChallengeParams{TokenHash: "live", MaxAttempts: 2}
+		for range 2 {
+			if user, err := s.AttemptMFAChallenge(ctx, attempt); err != nil || user != alice.ID {
+				t.Errorf("AttemptMFAChallenge = %s, %v, want %s", user, err, alice.ID)
+			}
+		}
+		if _, err := s.AttemptMFAChallenge(ctx, attempt); err != sql.ErrNoRows {
+			t.Errorf("attempt past the limit: got %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.AttemptMFAChallenge(ctx, database.AttemptMFAChallengeParams{TokenHash: "expired", MaxAttempts: 2}); err != sql.ErrNoRows {
+			t.Errorf("attempting an expired challenge: got %v, want sql.ErrNoRows", err)
+		}
+
+		if err := s.DeleteMFAChallenge(ctx, "live"); err != nil {
+			t.Fatalf("DeleteMFAChallenge: %v", err)
+		}
+		if _, err := s.AttemptMFAChallenge(ctx, database.AttemptMFAChallengeParams{TokenHash: "live", MaxAttempts: 10}); err != sql.ErrNoRows {
+			t.Errorf("attempting a deleted challenge: got %v, want sql.ErrNoRows", err)
+		}
+
+		if err := s.DeleteUserMFAChallenges(ctx, alice.ID); err != nil {
+			t.Fatalf("DeleteUserMFAChallenges: %v", err)
+		}
+		if _, err := s.AttemptMFAChallenge(ctx, database.AttemptMFAChallengeParams{TokenHash: "second", MaxAttempts: 10}); err != sql.ErrNoRows {
+			t.Errorf("attempting a challenge of a user whose challenges were deleted: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestTOTP(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+
+		for _, secret := range []string{"first", "second"} {
+			totp, err := s.StartTOTPEnrolment(ctx, database.StartTOTPEnrolmentParams{UserID: alice.ID, Secret: secret})
+			if err != nil || totp.Secret != secret || totp.ConfirmedAt.Valid {
+				t.Fatalf("StartTOTPEnrolment = %+v, %v", totp, err)
+			}
+		}
+		if err := s.ConfirmTOTPEnrolment(ctx, database.ConfirmTOTPEnrolmentParams{UserID: alice.ID, LastStep: 10}); err != nil {
+			t.Fatalf("ConfirmTOTPEnrolment: %v", err)
+		}
+		if _, err := s.StartTOTPEnrolment(ctx, database.StartTOTPEnrolmentParams{UserID: alice.ID, Secret: "third"}); err != sql.ErrNoRows {
+			t.Errorf("enrolling again once confirmed: got %v, want sql.ErrNoRows", err)
+		}
+		totp, err := s.GetUserTOTP(ctx, alice.ID)
+		if err != nil || totp.Secret != "second" || !totp.ConfirmedAt.Valid || totp.LastStep != 10 {
+			t.Errorf("GetUserTOTP = %+v, %v", totp, err)
+		}
+
+		// Each time step works once, and never one older than the last
+		for _, tt := range []struct {
+			step int64
+			want int64
+		}{{10, 0}, {9, 0}, {11, 1}, {11, 0}} {
+			if n, err := s.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: alice.ID, LastStep: tt.step}); err != nil || n != tt.want {
+				t.Errorf("UseTOTPStep(%d) = %d, %v, want %d", tt.step, n, err, tt.want)
+			}
+		}
+
+		for _, codes := range [][]string{{"a", "b"}, {"c", "d"}} {
+			if err := s.SetRecoveryCodes(ctx, database.SetRecoveryCodesParams{UserID: alice.ID, CodeHashes: codes}); err != nil {
+				t.Fatalf("SetRecoveryCodes: %v", err)
+			}
+		}
+		for _, tt := range []struct {
+			code string
+			want int64
+		}{{"a", 0}, {"c", 1}, {"c", 0}, {"d", 1}} {
+			if n, err := s.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{UserID: alice.ID, CodeHash: tt.code}); err != nil || n != tt.want {
+				t.Errorf("UseRecoveryCode(%s) = %d, %v, want %d", tt.code, n, err, tt.want)
+			}
+		}
+
+		if err := s.DisableTOTP(ctx, alice.ID); err != nil {
+			t.Fatalf("DisableTOTP: %v", err)
+		}
+		if _, err := s.GetUserTOTP(ctx, alice.ID); err != sql.ErrNoRows {
+			t.Errorf("GetUserTOTP after disabling: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestEmailTokens(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+
+		expires := time.Now().Add(time.Hour)
+		tokens := []database.CreateEmailTokenParams{
+			{TokenHash: "old", UserID: alice.ID, Purpose: "verify_email", Email: alice.Email, ExpiresAt: expires},
+			{TokenHash: "new", UserID: alice.ID, Purpose: "verify_email", Email: alice.Email, ExpiresAt: expires},
+			{TokenHash: "reset", UserID: alice.ID, Purpose: "password_reset", Email: alice.Email, ExpiresAt: time.Now().Add(-time.Hour)},
+		}
+		for _, token := range tokens {
+			if err := s.CreateEmailToken(ctx, token); err != nil {
+				t.Fatalf("CreateEmailToken: %v", err)
+			}
+		}
+
+		tests := []struct {
+			hash    string
+			purpose string
+			ok      bool
+		}{
+			{"old", "verify_email", false},
+			{"new", "password_reset", false},
+			{"reset", "password_reset", false},
+			{"new", "verify_email", true},
+			{"new", "verify_email", false},
+		}
+		for _, tt := range tests {
+			row, err := s.ConsumeEmailToken(ctx, database.ConsumeEmailTokenParams{TokenHash: tt.hash, Purpose: tt.purpose})
+			if tt.ok && (err != nil || row.UserID != alice.ID || row.Email != alice.Email) {
+				t.Errorf("ConsumeEmailToken(%s, %s) = %+v, %v", tt.hash, tt.purpose, row, err)
+			}
+			if !tt.ok && err != sql.ErrNoRows {
+				t.Errorf("ConsumeEmailToken(%s, %s): got %v, want sql.ErrNoRows", tt.hash, tt.purpose, err)
+			}
+		}
+
+		// Only the address the token went to is verified
+		if n, err := s.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{ID: alice.ID, Email: "old@example.com"}); err != nil || n != 0 {
+			t.Errorf("verifying an old address = %d, %v, want 0", n, err)
+		}
+		if n, err := s.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{ID: alice.ID, Email: alice.Email}); err != nil || n != 1 {
+			t.Errorf("MarkEmailVerified = %d, %v, want 1", n, err)
+		}
+	})
+}
+
+func TestLoginAttempts(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		start := time.Now().UTC().Truncate(time.Second)
+
+		tests := []struct {
+			at   time.Duration
+			want int32
+		}{{0, 1}, {time.Second, 2}, {2 * time.Second, 3}, {time.Hour, 1}}
+		for _, tt := range tests {
+			attempt, err := s.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+				Key:         "ip:192.0.2.1",
+				LastFailure: start.Add(tt.at),
+				WindowStart: start.Add(tt.at - time.Minute),
+			})
+			if err != nil || attempt.Failures != tt.want || !attempt.LastFailure.Equal(start.Add(tt.at)) {
+				t.Errorf("RecordLoginFailure at %v = %+v, %v, want %d failures", tt.at, attempt, err, tt.want)
+			}
+		}
+
+		if err := s.DeleteStaleLoginAttempts(ctx, start); err != nil {
+			t.Fatalf("DeleteStaleLoginAttempts: %v", err)
+		}
+		if _, err := s.GetLoginAttempts(ctx, "ip:192.0.2.1"); err != nil {
+			t.Errorf("a recent failure was deleted as stale: %v", err)
+		}
+		if err := s.ResetLoginAttempts(ctx, "ip:192.0.2.1"); err != nil {
+			t.Fatalf("ResetLoginAttempts: %v", err)
+		}
+		if _, err := s.GetLoginAttempts(ctx, "ip:192.0.2.1"); err != sql.ErrNoRows {
+			t.Errorf("GetLoginAttempts after a reset: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestTakeRateLimitToken(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		start := time.Now().UTC().Truncate(time.Second)
+
+		// A bucket of 2 that refills one token a second
+		tests := []struct {
+			at      time.Duration
+			tokens  float64
+			allowed bool
+		}{
+			{0, 1, true},
+			{0, 0, true},
+			{0, 0, false},
+			{500 * time.Millisecond, 0.5, false},
+			{time.Second, 0, true},
+			{time.Minute, 1, true},
+		}
+		for _, tt := range tests {
+			row, err := s.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+				Key:        "user:alice",
+				Capacity:   2,
+				Now:        start.Add(tt.at),
+				RefillRate: 1,
+			})
+			if err != nil || row.Allowed != tt.allowed || row.Tokens != tt.tokens {
+				t.Errorf("TakeRateLimitToken at %v = %+v, %v, want %v tokens left, allowed %v", tt.at, row, err, tt.tokens, tt.allowed)
+			}
+		}
+
+		if err := s.DeleteIdleRateLimitBuckets(ctx, start.Add(time.Hour)); err != nil {
+			t.Fatalf("DeleteIdleRateLimitBuckets: %v", err)
+		}
+		row, err := s.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{Key: "user:alice", Capacity: 2, Now: start, RefillRate: 1})
+		if err != nil || row.Tokens != 1 || !row.Allowed {
+			t.Errorf("a deleted bucket did not start over full: %+v, %v", row, err)
+		}
+	})
+}
+
+func TestUserLifecycle(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		if _, err := s.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{ID: alice.ID, Email: alice.Email}); err != nil {
+			t.Fatalf("MarkEmailVerified: %v", err)
+		}
+		// Keeping the email keeps it verified, and leaving out the username keeps that too
+		updated, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: alice.ID, Email: alice.Email, HashedPassword: "new"})
+		if err != nil || !updated.EmailVerified || updated.Username != "alice" {
+			t.Errorf("UpdateUser = %+v, %v", updated, err)
+		}
+		updated, err = s.UpdateUser(ctx, database.UpdateUserParams{
+			ID:             alice.ID,
+			Email:          "alice@example.org",
+			HashedPassword: "new",
+			Username:       sql.NullString{String: "alice_b", Valid: true},
+		})
+		if err != nil || updated.EmailVerified || updated.Email != "alice@example.org" || updated.Username != "alice_b" {
+			t.Errorf("UpdateUser with a new email = %+v, %v", updated, err)
+		}
+		_, err = s.UpdateUser(ctx, database.UpdateUserParams{ID: alice.ID, Email: bob.Email, HashedPassword: "new"})
+		if constraint, ok := UniqueViolation(err); !ok || constraint != "users_email_key" {
+			t.Errorf("UpdateUser to a taken email: got %v, want a violation of users_email_key", err)
+		}
+
+		if n, err := s.SuspendUser(ctx, bob.ID); err != nil || n != 1 {
+			t.Errorf("SuspendUser = %d, %v, want 1", n, err)
+		}
+		// The placeholder owner of deleted accounts' chirps is left out and cannot be suspended
+		if n, err := s.SuspendUser(ctx, uuid.Nil); err != nil || n != 0 {
+			t.Errorf("SuspendUser of the placeholder = %d, %v, want 0", n, err)
+		}
+		users, err := s.ListUsers(ctx, database.ListUsersParams{PageLimit: 1})
+		if err != nil || len(users) != 1 || users[0].ID != alice.ID {
+			t.Fatalf("first page of users = %+v, %v, want alice", users, err)
+		}
+		users, err = s.ListUsers(ctx, database.ListUsersParams{
+			CursorCreatedAt: sql.NullTime{Time: users[0].CreatedAt, Valid: true},
+			CursorID:        nullID(users[0].ID),
+			PageLimit:       10,
+		})
+		if err != nil || len(users) != 1 || users[0].ID != bob.ID || !users[0].SuspendedAt.Valid {
+			t.Errorf("users after alice = %+v, %v, want a suspended bob", users, err)
+		}
+		if n, err := s.UnsuspendUser(ctx, bob.ID); err != nil || n != 1 {
+			t.Errorf("UnsuspendUser = %d, %v, want 1", n, err)
+		}
+
+		now := time.Now().UTC()
+		for id, after := range map[uuid.UUID]time.Time{alice.ID: now.Add(-time.Minute), bob.ID: now.Add(time.Hour)} {
+			if err := s.ScheduleAccountDeletion(ctx, database.ScheduleAccountDeletionParams{ID: id, DeleteAfter: after}); err != nil {
+				t.Fatalf("ScheduleAccountDeletion: %v", err)
+			}
+		}
+		due, err := s.ListAccountsDueForDeletion(ctx, now)
+		if err != nil || !slices.Equal(due, []uuid.UUID{alice.ID}) {
+			t.Errorf("accounts due for deletion = %v, %v, want alice", due, err)
+		}
+		if n, err := s.CancelAccountDeletion(ctx, alice.ID); err != nil || n != 1 {
+			t.Errorf("CancelAccountDeletion = %d, %v, want 1", n, err)
+		}
+		if n, err := s.CancelAccountDeletion(ctx, alice.ID); err != nil || n != 0 {
+			t.Errorf("cancelling twice = %d, %v, want 0", n, err)
+		}
+		if due, err := s.ListAccountsDueForDeletion(ctx, now); err != nil || len(due) != 0 {
+			t.Errorf("accounts due after cancelling = %v, %v, want none", due, err)
+		}
+	})
+}
+
+func TestDataExports(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		export, err := s.CreateDataExport(ctx, alice.ID)
+		if err != nil || export.Status != "pending" {
+			t.Fatalf("CreateDataExport = %+v, %v", export, err)
+		}
+		recent := database.GetPendingDataExportParams{UserID: alice.ID, StartedAfter: export.CreatedAt.Add(-time.Minute)}
+		if pending, err := s.GetPendingDataExport(ctx, recent); err != nil || pending.ID != export.ID {
+			t.Errorf("GetPendingDataExport = %+v, %v, want %s", pending, err, export.ID)
+		}
+		stale := database.GetPendingDataExportParams{UserID: alice.ID, StartedAfter: export.CreatedAt}
+		if _, err := s.GetPendingDataExport(ctx, stale); err != sql.ErrNoRows {
+			t.Errorf("GetPendingDataExport of an export started too long ago: got %v, want sql.ErrNoRows", err)
+		}
+
+		expires := time.Now().Add(time.Hour).UTC()
+		err = s.CompleteDataExport(ctx, database.CompleteDataExportParams{ID: export.ID, Archive: []byte("zip"), ExpiresAt: expires})
+		if err != nil {
+			t.Fatalf("CompleteDataExport: %v", err)
+		}
+		if _, err := s.GetPendingDataExport(ctx, recent); err != sql.ErrNoRows {
+			t.Errorf("GetPendingDataExport once complete: got %v, want sql.ErrNoRows", err)
+		}
+		done, err := s.GetDataExport(ctx, database.GetDataExportParams{ID: export.ID, UserID: alice.ID})
+		if err != nil || done.Status != "ready" || !done.CompletedAt.Valid {
+			t.Errorf("GetDataExport = %+v, %v", done, err)
+		}
+		if archive, err := s.GetDataExportArchive(ctx, export.ID); err != nil || string(archive) != "zip" {
+			t.Errorf("GetDataExportArchive = %q, %v, want zip", archive, err)
+		}
+		if _, err := s.GetDataExport(ctx, database.GetDataExportParams{ID: export.ID, UserID: bob.ID}); err != sql.ErrNoRows {
+			t.Errorf("GetDataExport of another user's export: got %v, want sql.ErrNoRows", err)
+		}
+
+		// Only exports still pending when their build should have ended are failed
+		cutOff, err := s.CreateDataExport(ctx, bob.ID)
+		if err != nil {
+			t.Fatalf("CreateDataExport: %v", err)
+		}
+		if err := s.FailStaleDataExports(ctx, cutOff.CreatedAt); err != nil {
+			t.Fatalf("FailStaleDataExports: %v", err)
+		}
+		failed, err := s.GetDataExport(ctx, database.GetDataExportParams{ID: cutOff.ID, UserID: bob.ID})
+		if err != nil || failed.Status != "failed" || !failed.CompletedAt.Valid {
+			t.Errorf("GetDataExport of a stale export = %+v, %v, want it failed", failed, err)
+		}
+		if done, err := s.GetDataExport(ctx, database.GetDataExportParams{ID: export.ID, UserID: alice.ID}); err != nil || done.Status != "ready" {
+			t.Errorf("GetDataExport of a ready export after failing stale ones = %+v, %v", done, err)
+		}
+
+		if err := s.DeleteExpiredDataExports(ctx, expires.Add(time.Minute)); err != nil {
+			t.Fatalf("DeleteExpiredDataExports: %v", err)
+		}
+		if _, err := s.GetDataExport(ctx, database.GetDataExportParams{ID: export.ID, UserID: alice.ID}); err != sql.ErrNoRows {
+			t.Errorf("GetDataExport of an expired export: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
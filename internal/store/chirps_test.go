@@ -0,0 +1,517 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func nullID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: true}
+}
+
+func chirpIDs(chirps []database.Chirp) []uuid.UUID {
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+	return ids
+}
+
+func TestHashtags(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+
+		first := createChirp(t, s, database.CreateChirpParams{Body: "#go #sql", UserID: alice.ID})
+		second := createChirp(t, s, database.CreateChirpParams{Body: "#go", UserID: alice.ID})
+		third := createChirp(t, s, database.CreateChirpParams{Body: "#go #test", UserID: alice.ID})
+		for chirp, tags := range map[uuid.UUID][]string{
+			first.ID:  {"go", "sql"},
+			second.ID: {"go"},
+			third.ID:  {"go", "test"},
+		} {
+			if err := s.SetChirpTags(ctx, database.SetChirpTagsParams{ChirpID: chirp, Names: tags}); err != nil {
+				t.Fatalf("SetChirpTags: %v", err)
+			}
+		}
+
+		// Setting the tags again replaces them
+		if err := s.SetChirpTags(ctx, database.SetChirpTagsParams{ChirpID: third.ID, Names: []string{"test"}}); err != nil {
+			t.Fatalf("SetChirpTags: %v", err)
+		}
+
+		goChirps, err := s.ListHashtagChirps(ctx, database.ListHashtagChirpsParams{Name: "go", PageLimit: 10})
+		if err != nil {
+			t.Fatalf("ListHashtagChirps: %v", err)
+		}
+		if got, want := chirpIDs(goChirps), []uuid.UUID{second.ID, first.ID}; !slices.Equal(got, want) {
+			t.Errorf("#go chirps = %v, want the second then the first", chirpBodies(goChirps))
+		}
+
+		page, err := s.ListHashtagChirps(ctx, database.ListHashtagChirpsParams{
+			Name:            "go",
+			CursorCreatedAt: sql.NullTime{Time: second.CreatedAt, Valid: true},
+			CursorID:        nullID(second.ID),
+			PageLimit:       10,
+		})
+		if err != nil || len(page) != 1 || page[0].ID != first.ID {
+			t.Errorf("#go chirps after the second = %v, %v, want the first", chirpBodies(page), err)
+		}
+
+		trending, err := s.ListTrendingHashtags(ctx, database.ListTrendingHashtagsParams{
+			Since:    time.Now().Add(-time.Hour),
+			RowLimit: 10,
+		})
+		if err != nil {
+			t.Fatalf("ListTrendingHashtags: %v", err)
+		}
+		want := []database.ListTrendingHashtagsRow{{Name: "go", ChirpCount: 2}, {Name: "sql", ChirpCount: 1}, {Name: "test", ChirpCount: 1}}
+		if !slices.Equal(trending, want) {
+			t.Errorf("trending = %v, want %v", trending, want)
+		}
+
+		// Tombstones take their tags with them
+		if err := s.TombstoneChirp(ctx, first.ID); err != nil {
+			t.Fatalf("TombstoneChirp: %v", err)
+		}
+		goChirps, err = s.ListHashtagChirps(ctx, database.ListHashtagChirpsParams{Name: "go", PageLimit: 10})
+		if err != nil || len(goChirps) != 1 || goChirps[0].ID != second.ID {
+			t.Errorf("#go chirps after a tombstone = %v, %v, want the second", chirpBodies(goChirps), err)
+		}
+	})
+}
+
+func TestMentions(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "Alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		chirp := createChirp(t, s, database.CreateChirpParams{Body: "@alice @bob @nobody", UserID: bob.ID})
+		err := s.SetChirpMentions(ctx, database.SetChirpMentionsParams{
+			ChirpID:   chirp.ID,
+			Usernames: []string{"alice", "bob", "nobody"},
+		})
+		if err != nil {
+			t.Fatalf("SetChirpMentions: %v", err)
+		}
+
+		mentions, err := s.GetChirpMentions(ctx, []uuid.UUID{chirp.ID})
+		if err != nil {
+			t.Fatalf("GetChirpMentions: %v", err)
+		}
+		want := []database.GetChirpMentionsRow{
+			{ChirpID: chirp.ID, UserID: alice.ID, Username: "Alice"},
+			{ChirpID: chirp.ID, UserID: bob.ID, Username: "bob"},
+		}
+		if !slices.Equal(mentions, want) {
+			t.Errorf("mentions = %v, want %v", mentions, want)
+		}
+
+		if err := s.SetChirpMentions(ctx, database.SetChirpMentionsParams{ChirpID: chirp.ID, Usernames: []string{"bob"}}); err != nil {
+			t.Fatalf("SetChirpMentions: %v", err)
+		}
+		for user, want := range map[uuid.UUID]int{alice.ID: 0, bob.ID: 1} {
+			chirps, err := s.ListMentionChirps(ctx, database.ListMentionChirpsParams{UserID: user, PageLimit: 10})
+			if err != nil || len(chirps) != want {
+				t.Errorf("ListMentionChirps = %v, %v, want %d chirps", chirpBodies(chirps), err, want)
+			}
+		}
+	})
+}
+
+func TestIndexChirpInTx(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+
+		// The handlers create, edit and index a chirp within a transaction
+		tx, err := s.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("BeginTx: %v", err)
+		}
+		defer tx.Rollback()
+		chirp, err := tx.CreateChirp(ctx, database.CreateChirpParams{Body: "#go @alice", UserID: alice.ID})
+		if err != nil {
+			t.Fatalf("CreateChirp: %v", err)
+		}
+		if _, err := tx.EditChirp(ctx, database.EditChirpParams{ID: chirp.ID, Body: "#go #sql @alice"}); err != nil {
+			t.Fatalf("EditChirp: %v", err)
+		}
+		if err := tx.SetChirpTags(ctx, database.SetChirpTagsParams{ChirpID: chirp.ID, Names: []string{"go", "sql"}}); err != nil {
+			t.Fatalf("SetChirpTags: %v", err)
+		}
+		if err := tx.SetChirpMentions(ctx, database.SetChirpMentionsParams{ChirpID: chirp.ID, Usernames: []string{"alice"}}); err != nil {
+			t.Fatalf("SetChirpMentions: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+
+		for _, tag := range []string{"go", "sql"} {
+			chirps, err := s.ListHashtagChirps(ctx, database.ListHashtagChirpsParams{Name: tag, PageLimit: 10})
+			if err != nil || len(chirps) != 1 || chirps[0].Body != "#go #sql @alice" {
+				t.Errorf("#%s chirps = %v, %v, want the edited chirp", tag, chirpBodies(chirps), err)
+			}
+		}
+		mentions, err := s.ListMentionChirps(ctx, database.ListMentionChirpsParams{UserID: alice.ID, PageLimit: 10})
+		if err != nil || len(mentions) != 1 {
+			t.Errorf("ListMentionChirps = %v, %v, want the chirp", chirpBodies(mentions), err)
+		}
+	})
+}
+
+func TestGetChirpForUpdate(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		chirp := createChirp(t, s, database.CreateChirpParams{Body: "locked", UserID: alice.ID})
+
+		tx, err := s.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("BeginTx: %v", err)
+		}
+		defer tx.Rollback()
+		if locked, err := tx.GetChirpForUpdate(ctx, chirp.ID); err != nil || locked.ID != chirp.ID {
+			t.Errorf("GetChirpForUpdate = %+v, %v, want %s", locked, err, chirp.ID)
+		}
+		if _, err := tx.GetChirpForUpdate(ctx, uuid.New()); err != sql.ErrNoRows {
+			t.Errorf("GetChirpForUpdate of a missing chirp: got %v, want sql.ErrNoRows", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+	})
+}
+
+func TestEditAndTombstoneChirp(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		chirp := createChirp(t, s, database.CreateChirpParams{Body: "first", UserID: alice.ID})
+
+		for _, body := range []string{"second", "third"} {
+			edited, err := s.EditChirp(ctx, database.EditChirpParams{ID: chirp.ID, Body: body})
+			if err != nil {
+				t.Fatalf("EditChirp: %v", err)
+			}
+			if edited.Body != body || edited.CreatedAt != chirp.CreatedAt || edited.UpdatedAt.Before(chirp.UpdatedAt) {
+				t.Errorf("edited chirp = %+v", edited)
+			}
+		}
+		if _, err := s.EditChirp(ctx, database.EditChirpParams{ID: uuid.New(), Body: "nope"}); err != sql.ErrNoRows {
+			t.Errorf("EditChirp of a missing chirp: got %v, want sql.ErrNoRows", err)
+		}
+
+		revisions, err := s.ListChirpRevisions(ctx, chirp.ID)
+		if err != nil {
+			t.Fatalf("ListChirpRevisions: %v", err)
+		}
+		if len(revisions) != 2 || revisions[0].Body != "second" || revisions[1].Body != "first" {
+			t.Errorf("revisions = %+v, want second then first", revisions)
+		}
+
+		if err := s.TombstoneChirp(ctx, chirp.ID); err != nil {
+			t.Fatalf("TombstoneChirp: %v", err)
+		}
+		tombstone, err := s.GetChirp(ctx, chirp.ID)
+		if err != nil || tombstone.Body != "" || !tombstone.DeletedAt.Valid {
+			t.Errorf("tombstone = %+v, %v", tombstone, err)
+		}
+		if revisions, err := s.ListChirpRevisions(ctx, chirp.ID); err != nil || len(revisions) != 0 {
+			t.Errorf("revisions of a tombstone = %+v, %v, want none", revisions, err)
+		}
+	})
+}
+
+func TestRechirps(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+		carol := createUser(t, s, "carol@example.com", "carol")
+		chirp := createChirp(t, s, database.CreateChirpParams{Body: "share me", UserID: alice.ID})
+
+		for _, user := range []uuid.UUID{bob.ID, carol.ID} {
+			rechirp, err := s.CreateRechirp(ctx, database.CreateRechirpParams{UserID: user, RechirpOf: nullID(chirp.ID)})
+			if err != nil || rechirp.Body != "" || rechirp.RechirpOf.UUID != chirp.ID {
+				t.Fatalf("CreateRechirp = %+v, %v", rechirp, err)
+			}
+		}
+		if _, err := s.CreateRechirp(ctx, database.CreateRechirpParams{UserID: bob.ID, RechirpOf: nullID(chirp.ID)}); err != sql.ErrNoRows {
+			t.Errorf("rechirping twice: got %v, want sql.ErrNoRows", err)
+		}
+		createChirp(t, s, database.CreateChirpParams{Body: "quoted", UserID: carol.ID, QuoteOf: nullID(chirp.ID)})
+
+		stats, err := s.GetChirpShareStats(ctx, database.GetChirpShareStatsParams{
+			ViewerID: nullID(bob.ID),
+			ChirpIds: []uuid.UUID{chirp.ID, uuid.New()},
+		})
+		if err != nil {
+			t.Fatalf("GetChirpShareStats: %v", err)
+		}
+		want := []database.GetChirpShareStatsRow{{ChirpID: chirp.ID, RechirpCount: 2, QuoteCount: 1, RechirpedByViewer: true}}
+		if !slices.Equal(stats, want) {
+			t.Errorf("share stats = %+v, want %+v", stats, want)
+		}
+		if n, err := s.CountChirpReferences(ctx, chirp.ID); err != nil || n != 3 {
+			t.Errorf("CountChirpReferences = %d, %v, want 3", n, err)
+		}
+
+		if n, err := s.DeleteRechirp(ctx, database.DeleteRechirpParams{UserID: bob.ID, RechirpOf: nullID(chirp.ID)}); err != nil || n != 1 {
+			t.Errorf("DeleteRechirp = %d, %v, want 1", n, err)
+		}
+		stats, err = s.GetChirpShareStats(ctx, database.GetChirpShareStatsParams{
+			ViewerID: nullID(bob.ID),
+			ChirpIds: []uuid.UUID{chirp.ID},
+		})
+		want = []database.GetChirpShareStatsRow{{ChirpID: chirp.ID, RechirpCount: 1, QuoteCount: 1}}
+		if err != nil || !slices.Equal(stats, want) {
+			t.Errorf("share stats after unsharing = %+v, %v, want %+v", stats, err, want)
+		}
+	})
+}
+
+func TestLikes(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+		first := createChirp(t, s, database.CreateChirpParams{Body: "first", UserID: alice.ID})
+		second := createChirp(t, s, database.CreateChirpParams{Body: "second", UserID: alice.ID})
+
+		likes := []database.LikeChirpParams{
+			{UserID: alice.ID, ChirpID: first.ID},
+			{UserID: bob.ID, ChirpID: first.ID},
+			{UserID: bob.ID, ChirpID: second.ID},
+			// Liking twice is not an error and counts once
+			{UserID: bob.ID, ChirpID: second.ID},
+		}
+		for _, like := range likes {
+			if err := s.LikeChirp(ctx, like); err != nil {
+				t.Fatalf("LikeChirp: %v", err)
+			}
+			// Likes are listed by when they happened, so keep them apart
+			time.Sleep(time.Millisecond)
+		}
+
+		stats, err := s.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{
+			ViewerID: nullID(alice.ID),
+			ChirpIds: []uuid.UUID{first.ID, second.ID},
+		})
+		if err != nil {
+			t.Fatalf("GetChirpLikeStats: %v", err)
+		}
+		slices.SortFunc(stats, func(a, b database.GetChirpLikeStatsRow) int { return int(a.LikeCount - b.LikeCount) })
+		want := []database.GetChirpLikeStatsRow{
+			{ChirpID: second.ID, LikeCount: 1},
+			{ChirpID: first.ID, LikeCount: 2, LikedByViewer: true},
+		}
+		if !slices.Equal(stats, want) {
+			t.Errorf("like stats = %+v, want %+v", stats, want)
+		}
+
+		likers, err := s.ListChirpLikers(ctx, database.ListChirpLikersParams{ChirpID: first.ID, PageLimit: 10})
+		if err != nil || len(likers) != 2 || likers[0].ID != bob.ID || likers[1].ID != alice.ID {
+			t.Errorf("likers = %+v, %v, want bob then alice", likers, err)
+		}
+
+		liked, err := s.ListLikedChirps(ctx, database.ListLikedChirpsParams{UserID: bob.ID, PageLimit: 10})
+		if err != nil || len(liked) != 2 || liked[0].Chirp.ID != second.ID || liked[1].Chirp.ID != first.ID {
+			t.Errorf("chirps bob liked = %+v, %v, want second then first", liked, err)
+		}
+
+		if err := s.UnlikeChirp(ctx, database.UnlikeChirpParams{UserID: bob.ID, ChirpID: first.ID}); err != nil {
+			t.Fatalf("UnlikeChirp: %v", err)
+		}
+		liked, err = s.ListLikedChirps(ctx, database.ListLikedChirpsParams{
+			UserID:          bob.ID,
+			CursorCreatedAt: sql.NullTime{Time: liked[0].LikedAt, Valid: true},
+			CursorID:        nullID(liked[0].Chirp.ID),
+			PageLimit:       10,
+		})
+		if err != nil || len(liked) != 0 {
+			t.Errorf("chirps bob liked after unliking = %+v, %v, want none", liked, err)
+		}
+	})
+}
+
+func TestThreadsAndTimeline(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+		carol := createUser(t, s, "carol@example.com", "carol")
+
+		root := createChirp(t, s, database.CreateChirpParams{Body: "root", UserID: alice.ID})
+		reply := createChirp(t, s, database.CreateChirpParams{Body: "reply", UserID: bob.ID, ParentID: nullID(root.ID), RootID: nullID(root.ID)})
+		nested := createChirp(t, s, database.CreateChirpParams{Body: "nested", UserID: alice.ID, ParentID: nullID(reply.ID), RootID: nullID(root.ID)})
+		createChirp(t, s, database.CreateChirpParams{Body: "unrelated", UserID: carol.ID})
+
+		thread, err := s.GetChirpThread(ctx, root.ID)
+		if err != nil {
+			t.Fatalf("GetChirpThread: %v", err)
+		}
+		if got, want := chirpIDs(thread), []uuid.UUID{root.ID, reply.ID, nested.ID}; !slices.Equal(got, want) {
+			t.Errorf("thread = %v, want root, reply, nested", chirpBodies(thread))
+		}
+
+		replies, err := s.ListChirpReplies(ctx, database.ListChirpRepliesParams{ParentID: nullID(root.ID), PageLimit: 10})
+		if err != nil || len(replies) != 1 || replies[0].ID != reply.ID {
+			t.Errorf("replies to the root = %v, %v, want only the direct reply", chirpBodies(replies), err)
+		}
+
+		byIDs, err := s.GetChirpsByIDs(ctx, []uuid.UUID{nested.ID, root.ID, uuid.New()})
+		if err != nil || len(byIDs) != 2 {
+			t.Errorf("GetChirpsByIDs = %v, %v, want 2 chirps", chirpBodies(byIDs), err)
+		}
+
+		if err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: alice.ID, FolloweeID: bob.ID}); err != nil {
+			t.Fatalf("FollowUser: %v", err)
+		}
+		timeline, err := s.ListTimelineChirps(ctx, database.ListTimelineChirpsParams{UserID: alice.ID, PageLimit: 10})
+		if err != nil {
+			t.Fatalf("ListTimelineChirps: %v", err)
+		}
+		if got, want := chirpIDs(timeline), []uuid.UUID{nested.ID, reply.ID, root.ID}; !slices.Equal(got, want) {
+			t.Errorf("timeline = %v, want alice's and bob's chirps, newest first", chirpBodies(timeline))
+		}
+
+		followers, err := s.ListFollowers(ctx, database.ListFollowersParams{UserID: bob.ID, PageLimit: 10})
+		if err != nil || len(followers) != 1 || followers[0].ID != alice.ID {
+			t.Errorf("bob's followers = %+v, %v, want alice", followers, err)
+		}
+		if err := s.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: alice.ID, FolloweeID: bob.ID}); err != nil {
+			t.Fatalf("UnfollowUser: %v", err)
+		}
+		timeline, err = s.ListTimelineChirps(ctx, database.ListTimelineChirpsParams{UserID: alice.ID, PageLimit: 10})
+		if err != nil || len(timeline) != 2 {
+			t.Errorf("timeline after unfollowing = %v, %v, want alice's 2 chirps", chirpBodies(timeline), err)
+		}
+	})
+}
+
+func TestImportChirp(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+
+		created := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+		chirp, err := s.ImportChirp(ctx, database.ImportChirpParams{
+			Body:      "from elsewhere",
+			CreatedAt: created,
+			UpdatedAt: created.Add(time.Minute),
+			UserID:    alice.ID,
+		})
+		if err != nil {
+			t.Fatalf("ImportChirp: %v", err)
+		}
+		if !chirp.CreatedAt.Equal(created) || !chirp.UpdatedAt.Equal(created.Add(time.Minute)) {
+			t.Errorf("imported chirp times = %v, %v, want %v", chirp.CreatedAt, chirp.UpdatedAt, created)
+		}
+
+		record := database.RecordChirpImportParams{UserID: alice.ID, SourceID: "42", ChirpID: chirp.ID}
+		if err := s.RecordChirpImport(ctx, record); err != nil {
+			t.Fatalf("RecordChirpImport: %v", err)
+		}
+		if err := s.RecordChirpImport(ctx, record); err == nil {
+			t.Error("recording the same import twice succeeded")
+		}
+
+		id, err := s.GetImportedChirpID(ctx, database.GetImportedChirpIDParams{UserID: alice.ID, SourceID: "42"})
+		if err != nil || id != chirp.ID {
+			t.Errorf("GetImportedChirpID = %s, %v, want %s", id, err, chirp.ID)
+		}
+		if _, err := s.GetImportedChirpID(ctx, database.GetImportedChirpIDParams{UserID: alice.ID, SourceID: "43"}); err != sql.ErrNoRows {
+			t.Errorf("GetImportedChirpID of a new source ID: got %v, want sql.ErrNoRows", err)
+		}
+
+		// A held import keeps its source ID and timestamps until it is approved
+		hold := database.HoldChirpParams{
+			UserID:          alice.ID,
+			Body:            "held from elsewhere",
+			Reason:          "test",
+			SourceID:        sql.NullString{String: "43", Valid: true},
+			SourceCreatedAt: sql.NullTime{Time: created, Valid: true},
+			SourceUpdatedAt: sql.NullTime{Time: created.Add(time.Minute), Valid: true},
+		}
+		held, err := s.HoldChirp(ctx, hold)
+		if err != nil {
+			t.Fatalf("HoldChirp: %v", err)
+		}
+		if held.SourceID != hold.SourceID || !held.SourceCreatedAt.Time.Equal(created) || !held.SourceUpdatedAt.Time.Equal(created.Add(time.Minute)) {
+			t.Errorf("held import = %+v, want the source ID and times kept", held)
+		}
+		if _, err := s.HoldChirp(ctx, hold); err == nil {
+			t.Error("holding the same import twice succeeded")
+		}
+		heldID, err := s.GetHeldImportID(ctx, database.GetHeldImportIDParams{UserID: alice.ID, SourceID: "43"})
+		if err != nil || heldID != held.ID {
+			t.Errorf("GetHeldImportID = %s, %v, want %s", heldID, err, held.ID)
+		}
+		if _, err := s.GetHeldImportID(ctx, database.GetHeldImportIDParams{UserID: alice.ID, SourceID: "42"}); err != sql.ErrNoRows {
+			t.Errorf("GetHeldImportID of an import that was not held: got %v, want sql.ErrNoRows", err)
+		}
+
+		// Held chirps that are not imports do not collide with each other
+		for range 2 {
+			if _, err := s.HoldChirp(ctx, database.HoldChirpParams{UserID: alice.ID, Body: "held", Reason: "test"}); err != nil {
+				t.Fatalf("HoldChirp: %v", err)
+			}
+		}
+	})
+}
+
+func TestAnonymizeReferencedChirps(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		placeholder := createUser(t, s, "deleted@example.com", "deleted")
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		// bob replies to alice's reply to her own chirp, so both of hers must stay
+		root := createChirp(t, s, database.CreateChirpParams{Body: "root", UserID: alice.ID})
+		own := createChirp(t, s, database.CreateChirpParams{Body: "own reply", UserID: alice.ID, ParentID: nullID(root.ID), RootID: nullID(root.ID)})
+		createChirp(t, s, database.CreateChirpParams{Body: "bob", UserID: bob.ID, ParentID: nullID(own.ID), RootID: nullID(root.ID)})
+		alone := createChirp(t, s, database.CreateChirpParams{Body: "alone", UserID: alice.ID})
+
+		params := database.AnonymizeReferencedChirpsParams{PlaceholderID: placeholder.ID, UserID: alice.ID}
+		var moved int64
+		for {
+			n, err := s.AnonymizeReferencedChirps(ctx, params)
+			if err != nil {
+				t.Fatalf("AnonymizeReferencedChirps: %v", err)
+			}
+			if n == 0 {
+				break
+			}
+			moved += n
+		}
+		if moved != 2 {
+			t.Errorf("moved %d chirps, want 2", moved)
+		}
+
+		for _, id := range []uuid.UUID{root.ID, own.ID} {
+			chirp, err := s.GetChirp(ctx, id)
+			if err != nil || chirp.UserID != placeholder.ID || chirp.Body != "" || !chirp.DeletedAt.Valid {
+				t.Errorf("referenced chirp = %+v, %v, want a tombstone of the placeholder", chirp, err)
+			}
+		}
+		if chirp, err := s.GetChirp(ctx, alone.ID); err != nil || chirp.UserID != alice.ID {
+			t.Errorf("unreferenced chirp = %+v, %v, want it left to alice", chirp, err)
+		}
+
+		if err := s.DeleteUserChirps(ctx, alice.ID); err != nil {
+			t.Fatalf("DeleteUserChirps: %v", err)
+		}
+		if n, err := s.DeleteUser(ctx, alice.ID); err != nil || n != 1 {
+			t.Errorf("DeleteUser = %d, %v, want 1", n, err)
+		}
+	})
+}
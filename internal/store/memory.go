@@ -0,0 +1,341 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Memory keeps everything in process memory, so it needs no database and nothing survives a
+// restart. It is meant for tests: queries behave as their SQL does, unique constraints and
+// foreign keys included, except that search matches words as written where Postgres would
+// stem them. A transaction holds the store to itself until it ends, so queries made outside
+// it in the meantime wait.
+type Memory struct {
+	mu     *sync.Mutex
+	inTx   bool // mu is already held by the transaction this belongs to
+	tables *tables
+}
+
+var _ Store = (*Memory)(nil)
+
+// idPair is the key of a table whose primary key is two IDs, in the order the table has them.
+type idPair struct {
+	first, second uuid.UUID
+}
+
+// importKey is the primary key of chirp_imports.
+type importKey struct {
+	userID   uuid.UUID
+	sourceID string
+}
+
+// tables holds a row per map entry. Rows are values, and slices in them are replaced rather
+// than modified, so a shallow copy of the maps is a snapshot.
+type tables struct {
+	users              map[uuid.UUID]database.User
+	chirps             map[uuid.UUID]database.Chirp
+	chirpRevisions     map[uuid.UUID]database.ChirpRevision
+	chirpLikes         map[idPair]database.ChirpLike    // user, chirp
+	chirpTags          map[idPair]database.ChirpTag     // chirp, tag
+	chirpMentions      map[idPair]database.ChirpMention // chirp, user
+	chirpImports       map[importKey]database.ChirpImport
+	tags               map[uuid.UUID]database.Tag
+	follows            map[idPair]database.Follow // follower, followee
+	moderationQueue    map[uuid.UUID]database.ModerationQueue
+	refreshTokens      map[string]database.RefreshToken
+	sessions           map[uuid.UUID]database.Session
+	personalTokens     map[uuid.UUID]database.PersonalAccessToken
+	userTOTP           map[uuid.UUID]database.UserTotp
+	recoveryCodes      map[uuid.UUID]database.RecoveryCode
+	mfaChallenges      map[string]database.MfaChallenge
+	emailTokens        map[string]database.EmailToken
+	loginAttempts      map[string]database.LoginAttempt
+	rateLimitBuckets   map[string]database.RateLimitBucket
+	dataExports        map[uuid.UUID]database.DataExport
+	subscriptionEvents map[uuid.UUID]database.SubscriptionEvent
+}
+
+func NewMemory() *Memory {
+	t := &tables{
+		users:              make(map[uuid.UUID]database.User),
+		chirps:             make(map[uuid.UUID]database.Chirp),
+		chirpRevisions:     make(map[uuid.UUID]database.ChirpRevision),
+		chirpLikes:         make(map[idPair]database.ChirpLike),
+		chirpTags:          make(map[idPair]database.ChirpTag),
+		chirpMentions:      make(map[idPair]database.ChirpMention),
+		chirpImports:       make(map[importKey]database.ChirpImport),
+		tags:               make(map[uuid.UUID]database.Tag),
+		follows:            make(map[idPair]database.Follow),
+		moderationQueue:    make(map[uuid.UUID]database.ModerationQueue),
+		refreshTokens:      make(map[string]database.RefreshToken),
+		sessions:           make(map[uuid.UUID]database.Session),
+		personalTokens:     make(map[uuid.UUID]database.PersonalAccessToken),
+		userTOTP:           make(map[uuid.UUID]database.UserTotp),
+		recoveryCodes:      make(map[uuid.UUID]database.RecoveryCode),
+		mfaChallenges:      make(map[string]database.MfaChallenge),
+		emailTokens:        make(map[string]database.EmailToken),
+		loginAttempts:      make(map[string]database.LoginAttempt),
+		rateLimitBuckets:   make(map[string]database.RateLimitBucket),
+		dataExports:        make(map[uuid.UUID]database.DataExport),
+		subscriptionEvents: make(map[uuid.UUID]database.SubscriptionEvent),
+	}
+
+	// The placeholder that keeps deleted accounts' tombstones, as the migrations create it
+	created := now()
+	t.users[uuid.Nil] = database.User{
+		ID:             uuid.Nil,
+		CreatedAt:      created,
+		UpdatedAt:      created,
+		Email:          "deleted-user@chirpy.invalid",
+		HashedPassword: "$2a$10$.....................................................",
+		Username:       "user_000000000000",
+		SuspendedAt:    sql.NullTime{Time: created, Valid: true},
+	}
+
+	return &Memory{mu: &sync.Mutex{}, tables: t}
+}
+
+func (t *tables) clone() *tables {
+	return &tables{
+		users:              maps.Clone(t.users),
+		chirps:             maps.Clone(t.chirps),
+		chirpRevisions:     maps.Clone(t.chirpRevisions),
+		chirpLikes:         maps.Clone(t.chirpLikes),
+		chirpTags:          maps.Clone(t.chirpTags),
+		chirpMentions:      maps.Clone(t.chirpMentions),
+		chirpImports:       maps.Clone(t.chirpImports),
+		tags:               maps.Clone(t.tags),
+		follows:            maps.Clone(t.follows),
+		moderationQueue:    maps.Clone(t.moderationQueue),
+		refreshTokens:      maps.Clone(t.refreshTokens),
+		sessions:           maps.Clone(t.sessions),
+		personalTokens:     maps.Clone(t.personalTokens),
+		userTOTP:           maps.Clone(t.userTOTP),
+		recoveryCodes:      maps.Clone(t.recoveryCodes),
+		mfaChallenges:      maps.Clone(t.mfaChallenges),
+		emailTokens:        maps.Clone(t.emailTokens),
+		loginAttempts:      maps.Clone(t.loginAttempts),
+		rateLimitBuckets:   maps.Clone(t.rateLimitBuckets),
+		dataExports:        maps.Clone(t.dataExports),
+		subscriptionEvents: maps.Clone(t.subscriptionEvents),
+	}
+}
+
+// lock takes the store for the length of one query, unless a transaction already has it.
+func (m *Memory) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// BeginTx works on a copy of the tables, which replaces them on Commit.
+func (m *Memory) BeginTx(ctx context.Context) (Tx, error) {
+	m.mu.Lock()
+	return &memoryTx{
+		Memory: &Memory{mu: m.mu, inTx: true, tables: m.tables.clone()},
+		parent: m,
+	}, nil
+}
+
+type memoryTx struct {
+	*Memory
+	parent *Memory
+	done   bool
+}
+
+func (tx *memoryTx) Commit() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	tx.parent.tables = tx.tables
+	tx.mu.Unlock()
+	return nil
+}
+
+func (tx *memoryTx) Rollback() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	tx.mu.Unlock()
+	return nil
+}
+
+// now stands in for NOW(), which reads a TIMESTAMP column back in UTC and to the
+// microsecond, the precision page cursors keep.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// compareKeys orders rows by (created_at, id) the way Postgres compares those row values.
+func compareKeys(t1 time.Time, id1 uuid.UUID, t2 time.Time, id2 uuid.UUID) int {
+	if c := t1.Compare(t2); c != 0 {
+		return c
+	}
+	return bytes.Compare(id1[:], id2[:])
+}
+
+// sortRows orders rows by the (time, id) key, newest first when desc is set.
+func sortRows[T any](rows []T, key func(T) (time.Time, uuid.UUID), desc bool) {
+	slices.SortFunc(rows, func(a, b T) int {
+		ta, ia := key(a)
+		tb, ib := key(b)
+		if desc {
+			return compareKeys(tb, ib, ta, ia)
+		}
+		return compareKeys(ta, ia, tb, ib)
+	})
+}
+
+// keysetPage does what the paginated queries do: it sorts rows by their key, drops those
+// up to and including the cursor and keeps at most limit of the rest.
+func keysetPage[T any](rows []T, key func(T) (time.Time, uuid.UUID), cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, desc bool, limit int32) []T {
+	sortRows(rows, key, desc)
+	if cursorCreatedAt.Valid {
+		rows = slices.DeleteFunc(rows, func(row T) bool {
+			t, id := key(row)
+			c := compareKeys(t, id, cursorCreatedAt.Time, cursorID.UUID)
+			return (desc && c >= 0) || (!desc && c <= 0)
+		})
+	}
+	if len(rows) > int(limit) {
+		rows = rows[:max(limit, 0)]
+	}
+	return rows
+}
+
+func chirpKey(chirp database.Chirp) (time.Time, uuid.UUID) {
+	return chirp.CreatedAt, chirp.ID
+}
+
+// values returns a table's rows that match, in no particular order.
+func values[K comparable, V any](table map[K]V, match func(V) bool) []V {
+	var rows []V
+	for _, row := range table {
+		if match(row) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// update applies change to every row that matches and returns how many there were.
+func update[K comparable, V any](table map[K]V, match func(V) bool, change func(*V)) int64 {
+	var n int64
+	for key, row := range table {
+		if match(row) {
+			change(&row)
+			table[key] = row
+			n++
+		}
+	}
+	return n
+}
+
+// deleteRows removes every row that matches and returns how many there were.
+func deleteRows[K comparable, V any](table map[K]V, match func(V) bool) int64 {
+	var n int64
+	for key, row := range table {
+		if match(row) {
+			delete(table, key)
+			n++
+		}
+	}
+	return n
+}
+
+// checkUser fails as a foreign key to users does when id is not a user.
+func (t *tables) checkUser(id uuid.UUID) error {
+	if _, ok := t.users[id]; !ok {
+		return fmt.Errorf("user %s does not exist", id)
+	}
+	return nil
+}
+
+// checkChirps fails as a foreign key to chirps does when a set reference is not a chirp.
+func (t *tables) checkChirps(refs ...uuid.NullUUID) error {
+	for _, ref := range refs {
+		if _, ok := t.chirps[ref.UUID]; ref.Valid && !ok {
+			return fmt.Errorf("chirp %s does not exist", ref.UUID)
+		}
+	}
+	return nil
+}
+
+// deleteChirps removes chirps and the rows that cascade from them. As the foreign keys between
+// chirps do, it refuses while a chirp that stays refers to one that goes.
+func (t *tables) deleteChirps(ids map[uuid.UUID]bool) error {
+	for _, chirp := range t.chirps {
+		if ids[chirp.ID] {
+			continue
+		}
+		for _, ref := range []uuid.NullUUID{chirp.ParentID, chirp.RootID, chirp.RechirpOf, chirp.QuoteOf} {
+			if ref.Valid && ids[ref.UUID] {
+				return fmt.Errorf("chirp %s is still referenced by chirp %s", ref.UUID, chirp.ID)
+			}
+		}
+	}
+
+	deleteRows(t.chirps, func(c database.Chirp) bool { return ids[c.ID] })
+	deleteRows(t.chirpRevisions, func(r database.ChirpRevision) bool { return ids[r.ChirpID] })
+	deleteRows(t.chirpLikes, func(l database.ChirpLike) bool { return ids[l.ChirpID] })
+	deleteRows(t.chirpTags, func(ct database.ChirpTag) bool { return ids[ct.ChirpID] })
+	deleteRows(t.chirpMentions, func(cm database.ChirpMention) bool { return ids[cm.ChirpID] })
+	deleteRows(t.chirpImports, func(ci database.ChirpImport) bool { return ids[ci.ChirpID] })
+	deleteRows(t.moderationQueue, func(held database.ModerationQueue) bool {
+		return (held.ChirpID.Valid && ids[held.ChirpID.UUID]) ||
+			(held.ParentID.Valid && ids[held.ParentID.UUID]) ||
+			(held.QuoteOf.Valid && ids[held.QuoteOf.UUID])
+	})
+	return nil
+}
+
+// deleteUsers removes users and everything that cascades from them. Their chirps, and refresh
+// tokens outside their sessions, must already be gone.
+func (t *tables) deleteUsers(ids map[uuid.UUID]bool) (int64, error) {
+	for _, chirp := range t.chirps {
+		if ids[chirp.UserID] {
+			return 0, fmt.Errorf("user %s still has chirps", chirp.UserID)
+		}
+	}
+	sessions := make(map[uuid.UUID]bool)
+	for _, session := range t.sessions {
+		if ids[session.UserID] {
+			sessions[session.ID] = true
+		}
+	}
+	for _, token := range t.refreshTokens {
+		if ids[token.UserID] && !sessions[token.FamilyID] {
+			return 0, fmt.Errorf("user %s still has refresh tokens", token.UserID)
+		}
+	}
+
+	deleted := deleteRows(t.users, func(u database.User) bool { return ids[u.ID] })
+	deleteRows(t.sessions, func(s database.Session) bool { return sessions[s.ID] })
+	deleteRows(t.refreshTokens, func(rt database.RefreshToken) bool { return sessions[rt.FamilyID] })
+	deleteRows(t.follows, func(f database.Follow) bool { return ids[f.FollowerID] || ids[f.FolloweeID] })
+	deleteRows(t.chirpLikes, func(l database.ChirpLike) bool { return ids[l.UserID] })
+	deleteRows(t.chirpMentions, func(cm database.ChirpMention) bool { return ids[cm.UserID] })
+	deleteRows(t.chirpImports, func(ci database.ChirpImport) bool { return ids[ci.UserID] })
+	deleteRows(t.moderationQueue, func(held database.ModerationQueue) bool { return ids[held.UserID] })
+	deleteRows(t.personalTokens, func(pat database.PersonalAccessToken) bool { return ids[pat.UserID] })
+	deleteRows(t.userTOTP, func(totp database.UserTotp) bool { return ids[totp.UserID] })
+	deleteRows(t.recoveryCodes, func(rc database.RecoveryCode) bool { return ids[rc.UserID] })
+	deleteRows(t.mfaChallenges, func(mc database.MfaChallenge) bool { return ids[mc.UserID] })
+	deleteRows(t.emailTokens, func(et database.EmailToken) bool { return ids[et.UserID] })
+	deleteRows(t.dataExports, func(de database.DataExport) bool { return ids[de.UserID] })
+	deleteRows(t.subscriptionEvents, func(se database.SubscriptionEvent) bool { return ids[se.UserID] })
+	return deleted, nil
+}
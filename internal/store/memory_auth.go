@@ -0,0 +1,429 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	defer m.lock()()
+	if _, ok := m.tables.refreshTokens[arg.TokenHash]; ok {
+		return database.RefreshToken{}, &UniqueViolationError{Constraint: "refresh_tokens_pkey"}
+	}
+	if err := m.tables.checkUser(arg.UserID); err != nil {
+		return database.RefreshToken{}, err
+	}
+	if _, ok := m.tables.sessions[arg.FamilyID]; !ok {
+		return database.RefreshToken{}, fmt.Errorf("session %s does not exist", arg.FamilyID)
+	}
+	created := now()
+	token := database.RefreshToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: created,
+		UpdatedAt: created,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UTC(),
+		FamilyID:  arg.FamilyID,
+	}
+	m.tables.refreshTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	defer m.lock()()
+	token, ok := m.tables.refreshTokens[tokenHash]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+// GetRefreshTokenForUpdate needs no row lock, since a transaction already has the whole store.
+func (m *Memory) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	return m.GetRefreshToken(ctx, tokenHash)
+}
+
+// revokeRefreshTokens revokes the live tokens that match and returns how many there were.
+func (m *Memory) revokeRefreshTokens(match func(database.RefreshToken) bool) int64 {
+	defer m.lock()()
+	return update(m.tables.refreshTokens, func(rt database.RefreshToken) bool {
+		return !rt.RevokedAt.Valid && match(rt)
+	}, func(rt *database.RefreshToken) {
+		rt.UpdatedAt = now()
+		rt.RevokedAt = sql.NullTime{Time: rt.UpdatedAt, Valid: true}
+	})
+}
+
+// RevokeRefreshToken revokes the token even if it already was, as its UPDATE does.
+func (m *Memory) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	defer m.lock()()
+	update(m.tables.refreshTokens, func(rt database.RefreshToken) bool {
+		return rt.TokenHash == tokenHash
+	}, func(rt *database.RefreshToken) {
+		rt.UpdatedAt = now()
+		rt.RevokedAt = sql.NullTime{Time: rt.UpdatedAt, Valid: true}
+	})
+	return nil
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, tokenHash string) error {
+	defer m.lock()()
+	update(m.tables.refreshTokens, func(rt database.RefreshToken) bool {
+		return rt.TokenHash == tokenHash
+	}, func(rt *database.RefreshToken) {
+		rt.UpdatedAt = now()
+		rt.RevokedAt = sql.NullTime{Time: rt.UpdatedAt, Valid: true}
+		rt.RotatedAt = rt.RevokedAt
+	})
+	return nil
+}
+
+func (m *Memory) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) (int64, error) {
+	return m.revokeRefreshTokens(func(rt database.RefreshToken) bool { return rt.FamilyID == familyID }), nil
+}
+
+func (m *Memory) DeleteAllRefreshTokens(ctx context.Context) error {
+	defer m.lock()()
+	clear(m.tables.refreshTokens)
+	return nil
+}
+
+func (m *Memory) DeleteUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	deleteRows(m.tables.refreshTokens, func(rt database.RefreshToken) bool { return rt.UserID == userID })
+	return nil
+}
+
+func (m *Memory) CreateSession(ctx context.Context, arg database.CreateSessionParams) (database.Session, error) {
+	defer m.lock()()
+	if err := m.tables.checkUser(arg.UserID); err != nil {
+		return database.Session{}, err
+	}
+	created := now()
+	session := database.Session{
+		ID:         uuid.New(),
+		UserID:     arg.UserID,
+		UserAgent:  arg.UserAgent,
+		IpAddress:  arg.IpAddress,
+		CreatedAt:  created,
+		LastUsedAt: created,
+	}
+	m.tables.sessions[session.ID] = session
+	return session, nil
+}
+
+func (m *Memory) TouchSession(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	update(m.tables.sessions, func(s database.Session) bool {
+		return s.ID == id
+	}, func(s *database.Session) {
+		s.LastUsedAt = now()
+	})
+	return nil
+}
+
+func (m *Memory) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]database.Session, error) {
+	defer m.lock()()
+	active := make(map[uuid.UUID]bool)
+	for _, token := range m.tables.refreshTokens {
+		if !token.RevokedAt.Valid && token.ExpiresAt.After(now()) {
+			active[token.FamilyID] = true
+		}
+	}
+	sessions := values(m.tables.sessions, func(s database.Session) bool {
+		return s.UserID == userID && active[s.ID]
+	})
+	sortRows(sessions, func(s database.Session) (time.Time, uuid.UUID) {
+		return s.LastUsedAt, s.ID
+	}, true)
+	return sessions, nil
+}
+
+func (m *Memory) RevokeUserSession(ctx context.Context, arg database.RevokeUserSessionParams) (int64, error) {
+	return m.revokeRefreshTokens(func(rt database.RefreshToken) bool {
+		return rt.FamilyID == arg.FamilyID && rt.UserID == arg.UserID
+	}), nil
+}
+
+func (m *Memory) RevokeAllUserSessions(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return m.revokeRefreshTokens(func(rt database.RefreshToken) bool { return rt.UserID == userID }), nil
+}
+
+func (m *Memory) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	defer m.lock()()
+	for _, pat := range m.tables.personalTokens {
+		if pat.TokenHash == arg.TokenHash {
+			return database.PersonalAccessToken{}, &UniqueViolationError{Constraint: "personal_access_tokens_token_hash_key"}
+		}
+	}
+	if err := m.tables.checkUser(arg.UserID); err != nil {
+		return database.PersonalAccessToken{}, err
+	}
+	pat := database.PersonalAccessToken{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+		CreatedAt: now(),
+		ExpiresAt: arg.ExpiresAt.UTC(),
+	}
+	m.tables.personalTokens[pat.ID] = pat
+	return pat, nil
+}
+
+func (m *Memory) UsePersonalAccessToken(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	defer m.lock()()
+	for id, pat := range m.tables.personalTokens {
+		user := m.tables.users[pat.UserID]
+		if pat.TokenHash != tokenHash || !pat.ExpiresAt.After(now()) || user.SuspendedAt.Valid || user.DeleteAfter.Valid {
+			continue
+		}
+		pat.LastUsedAt = sql.NullTime{Time: now(), Valid: true}
+		m.tables.personalTokens[id] = pat
+		return pat, nil
+	}
+	return database.PersonalAccessToken{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	defer m.lock()()
+	pats := values(m.tables.personalTokens, func(pat database.PersonalAccessToken) bool {
+		return pat.UserID == userID
+	})
+	sortRows(pats, func(pat database.PersonalAccessToken) (time.Time, uuid.UUID) {
+		return pat.CreatedAt, pat.ID
+	}, true)
+	return pats, nil
+}
+
+func (m *Memory) DeletePersonalAccessToken(ctx context.Context, arg database.DeletePersonalAccessTokenParams) (int64, error) {
+	defer m.lock()()
+	return deleteRows(m.tables.personalTokens, func(pat database.PersonalAccessToken) bool {
+		return pat.ID == arg.ID && pat.UserID == arg.UserID
+	}), nil
+}
+
+func (m *Memory) DeleteUserPersonalAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	deleteRows(m.tables.personalTokens, func(pat database.PersonalAccessToken) bool { return pat.UserID == userID })
+	return nil
+}
+
+func (m *Memory) StartTOTPEnrolment(ctx context.Context, arg database.StartTOTPEnrolmentParams) (database.UserTotp, error) {
+	defer m.lock()()
+	totp, ok := m.tables.userTOTP[arg.UserID]
+	if ok && totp.ConfirmedAt.Valid {
+		return database.UserTotp{}, sql.ErrNoRows
+	}
+	totp = database.UserTotp{
+		UserID:    arg.UserID,
+		Secret:    arg.Secret,
+		CreatedAt: now(),
+	}
+	m.tables.userTOTP[arg.UserID] = totp
+	return totp, nil
+}
+
+func (m *Memory) GetUserTOTP(ctx context.Context, userID uuid.UUID) (database.UserTotp, error) {
+	defer m.lock()()
+	totp, ok := m.tables.userTOTP[userID]
+	if !ok {
+		return database.UserTotp{}, sql.ErrNoRows
+	}
+	return totp, nil
+}
+
+func (m *Memory) ConfirmTOTPEnrolment(ctx context.Context, arg database.ConfirmTOTPEnrolmentParams) error {
+	defer m.lock()()
+	update(m.tables.userTOTP, func(totp database.UserTotp) bool {
+		return totp.UserID == arg.UserID
+	}, func(totp *database.UserTotp) {
+		totp.ConfirmedAt = sql.NullTime{Time: now(), Valid: true}
+		totp.LastStep = arg.LastStep
+	})
+	return nil
+}
+
+func (m *Memory) UseTOTPStep(ctx context.Context, arg database.UseTOTPStepParams) (int64, error) {
+	defer m.lock()()
+	return update(m.tables.userTOTP, func(totp database.UserTotp) bool {
+		return totp.UserID == arg.UserID && totp.LastStep < arg.LastStep
+	}, func(totp *database.UserTotp) {
+		totp.LastStep = arg.LastStep
+	}), nil
+}
+
+func (m *Memory) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	deleteRows(m.tables.recoveryCodes, func(rc database.RecoveryCode) bool { return rc.UserID == userID })
+	delete(m.tables.userTOTP, userID)
+	return nil
+}
+
+func (m *Memory) SetRecoveryCodes(ctx context.Context, arg database.SetRecoveryCodesParams) error {
+	defer m.lock()()
+	deleteRows(m.tables.recoveryCodes, func(rc database.RecoveryCode) bool { return rc.UserID == arg.UserID })
+	for _, hash := range arg.CodeHashes {
+		code := database.RecoveryCode{
+			ID:        uuid.New(),
+			UserID:    arg.UserID,
+			CodeHash:  hash,
+			CreatedAt: now(),
+		}
+		m.tables.recoveryCodes[code.ID] = code
+	}
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	defer m.lock()()
+	return update(m.tables.recoveryCodes, func(rc database.RecoveryCode) bool {
+		return rc.UserID == arg.UserID && rc.CodeHash == arg.CodeHash && !rc.UsedAt.Valid
+	}, func(rc *database.RecoveryCode) {
+		rc.UsedAt = sql.NullTime{Time: now(), Valid: true}
+	}), nil
+}
+
+func (m *Memory) CreateMFAChallenge(ctx context.Context, arg database.CreateMFAChallengeParams) (int64, error) {
+	defer m.lock()()
+	deleteRows(m.tables.mfaChallenges, func(mc database.MfaChallenge) bool {
+		return mc.UserID == arg.UserID && !mc.ExpiresAt.After(now())
+	})
+	live := 0
+	for _, mc := range m.tables.mfaChallenges {
+		if mc.UserID == arg.UserID {
+			live++
+		}
+	}
+	if live >= int(arg.MaxChallenges) {
+		return 0, nil
+	}
+	if _, ok := m.tables.mfaChallenges[arg.TokenHash]; ok {
+		return 0, &UniqueViolationError{Constraint: "mfa_challenges_pkey"}
+	}
+	m.tables.mfaChallenges[arg.TokenHash] = database.MfaChallenge{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UTC(),
+	}
+	return 1, nil
+}
+
+func (m *Memory) AttemptMFAChallenge(ctx context.Context, arg database.AttemptMFAChallengeParams) (uuid.UUID, error) {
+	defer m.lock()()
+	challenge, ok := m.tables.mfaChallenges[arg.TokenHash]
+	if !ok || !challenge.ExpiresAt.After(now()) || challenge.Attempts >= arg.MaxAttempts {
+		return uuid.UUID{}, sql.ErrNoRows
+	}
+	challenge.Attempts++
+	m.tables.mfaChallenges[arg.TokenHash] = challenge
+	return challenge.UserID, nil
+}
+
+func (m *Memory) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	defer m.lock()()
+	delete(m.tables.mfaChallenges, tokenHash)
+	return nil
+}
+
+func (m *Memory) DeleteUserMFAChallenges(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	deleteRows(m.tables.mfaChallenges, func(c database.MfaChallenge) bool { return c.UserID == userID })
+	return nil
+}
+
+func (m *Memory) CreateEmailToken(ctx context.Context, arg database.CreateEmailTokenParams) error {
+	defer m.lock()()
+	deleteRows(m.tables.emailTokens, func(et database.EmailToken) bool {
+		return et.UserID == arg.UserID && et.Purpose == arg.Purpose
+	})
+	if _, ok := m.tables.emailTokens[arg.TokenHash]; ok {
+		return &UniqueViolationError{Constraint: "email_tokens_pkey"}
+	}
+	m.tables.emailTokens[arg.TokenHash] = database.EmailToken{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Purpose:   arg.Purpose,
+		Email:     arg.Email,
+		CreatedAt: now(),
+		ExpiresAt: arg.ExpiresAt.UTC(),
+	}
+	return nil
+}
+
+func (m *Memory) ConsumeEmailToken(ctx context.Context, arg database.ConsumeEmailTokenParams) (database.ConsumeEmailTokenRow, error) {
+	defer m.lock()()
+	token, ok := m.tables.emailTokens[arg.TokenHash]
+	if !ok || token.Purpose != arg.Purpose || !token.ExpiresAt.After(now()) {
+		return database.ConsumeEmailTokenRow{}, sql.ErrNoRows
+	}
+	delete(m.tables.emailTokens, arg.TokenHash)
+	return database.ConsumeEmailTokenRow{UserID: token.UserID, Email: token.Email}, nil
+}
+
+func (m *Memory) GetLoginAttempts(ctx context.Context, key string) (database.LoginAttempt, error) {
+	defer m.lock()()
+	attempts, ok := m.tables.loginAttempts[key]
+	if !ok {
+		return database.LoginAttempt{}, sql.ErrNoRows
+	}
+	return attempts, nil
+}
+
+func (m *Memory) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginAttempt, error) {
+	defer m.lock()()
+	attempts, ok := m.tables.loginAttempts[arg.Key]
+	if !ok || attempts.LastFailure.Before(arg.WindowStart) {
+		attempts = database.LoginAttempt{Key: arg.Key}
+	}
+	attempts.Failures++
+	attempts.LastFailure = arg.LastFailure.UTC()
+	m.tables.loginAttempts[arg.Key] = attempts
+	return attempts, nil
+}
+
+func (m *Memory) ResetLoginAttempts(ctx context.Context, key string) error {
+	defer m.lock()()
+	delete(m.tables.loginAttempts, key)
+	return nil
+}
+
+func (m *Memory) DeleteStaleLoginAttempts(ctx context.Context, lastFailure time.Time) error {
+	defer m.lock()()
+	deleteRows(m.tables.loginAttempts, func(la database.LoginAttempt) bool {
+		return la.LastFailure.Before(lastFailure)
+	})
+	return nil
+}
+
+func (m *Memory) TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (database.TakeRateLimitTokenRow, error) {
+	defer m.lock()()
+	bucket, ok := m.tables.rateLimitBuckets[arg.Key]
+	if !ok {
+		bucket = database.RateLimitBucket{Key: arg.Key, Tokens: arg.Capacity - 1, Allowed: true}
+	} else {
+		tokens := min(arg.Capacity, bucket.Tokens+arg.Now.Sub(bucket.UpdatedAt).Seconds()*arg.RefillRate)
+		bucket.Allowed = tokens >= 1
+		if bucket.Allowed {
+			tokens--
+		}
+		bucket.Tokens = tokens
+	}
+	bucket.UpdatedAt = arg.Now.UTC()
+	m.tables.rateLimitBuckets[arg.Key] = bucket
+	return database.TakeRateLimitTokenRow{Tokens: bucket.Tokens, Allowed: bucket.Allowed}, nil
+}
+
+func (m *Memory) DeleteIdleRateLimitBuckets(ctx context.Context, updatedAt time.Time) error {
+	defer m.lock()()
+	deleteRows(m.tables.rateLimitBuckets, func(b database.RateLimitBucket) bool {
+		return b.UpdatedAt.Before(updatedAt)
+	})
+	return nil
+}
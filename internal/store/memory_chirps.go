@@ -0,0 +1,516 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// listed reports whether a chirp shows up in listings: it is not deleted, and neither is the
+// chirp it rechirps.
+func (t *tables) listed(chirp database.Chirp) bool {
+	if chirp.DeletedAt.Valid {
+		return false
+	}
+	if !chirp.RechirpOf.Valid {
+		return true
+	}
+	original, ok := t.chirps[chirp.RechirpOf.UUID]
+	return ok && !original.DeletedAt.Valid
+}
+
+// clearChirpBody drops what goes with a chirp's body: its earlier revisions, hashtags and mentions.
+func (t *tables) clearChirpBody(ids map[uuid.UUID]bool) {
+	deleteRows(t.chirpRevisions, func(r database.ChirpRevision) bool { return ids[r.ChirpID] })
+	deleteRows(t.chirpTags, func(ct database.ChirpTag) bool { return ids[ct.ChirpID] })
+	deleteRows(t.chirpMentions, func(cm database.ChirpMention) bool { return ids[cm.ChirpID] })
+}
+
+// insertChirp stores a new chirp once its author and the chirps it refers to are found, as
+// the foreign keys on chirps require.
+func (m *Memory) insertChirp(chirp database.Chirp) (database.Chirp, error) {
+	defer m.lock()()
+	if err := m.tables.checkUser(chirp.UserID); err != nil {
+		return database.Chirp{}, err
+	}
+	if err := m.tables.checkChirps(chirp.ParentID, chirp.RootID, chirp.RechirpOf, chirp.QuoteOf); err != nil {
+		return database.Chirp{}, err
+	}
+
+	chirp.ID = uuid.New()
+	m.tables.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	created := now()
+	return m.insertChirp(database.Chirp{
+		Body:      arg.Body,
+		CreatedAt: created,
+		UpdatedAt: created,
+		UserID:    arg.UserID,
+		ParentID:  arg.ParentID,
+		RootID:    arg.RootID,
+		QuoteOf:   arg.QuoteOf,
+	})
+}
+
+func (m *Memory) ImportChirp(ctx context.Context, arg database.ImportChirpParams) (database.Chirp, error) {
+	return m.insertChirp(database.Chirp{
+		Body:      arg.Body,
+		CreatedAt: arg.CreatedAt.UTC().Truncate(time.Microsecond),
+		UpdatedAt: arg.UpdatedAt.UTC().Truncate(time.Microsecond),
+		UserID:    arg.UserID,
+		ParentID:  arg.ParentID,
+		RootID:    arg.RootID,
+		QuoteOf:   arg.QuoteOf,
+	})
+}
+
+func (m *Memory) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	defer m.lock()()
+	chirps := values(m.tables.chirps, func(database.Chirp) bool { return true })
+	sortRows(chirps, chirpKey, false)
+	return chirps, nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	defer m.lock()()
+	chirp, ok := m.tables.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (m *Memory) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	return m.GetChirp(ctx, id)
+}
+
+func (m *Memory) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	defer m.lock()()
+	chirps := values(m.tables.chirps, func(c database.Chirp) bool { return c.UserID == userID })
+	sortRows(chirps, chirpKey, false)
+	return chirps, nil
+}
+
+func (m *Memory) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]database.Chirp, error) {
+	defer m.lock()()
+	var chirps []database.Chirp
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		if chirp, ok := m.tables.chirps[id]; ok && !seen[id] {
+			chirps = append(chirps, chirp)
+			seen[id] = true
+		}
+	}
+	return chirps, nil
+}
+
+func (m *Memory) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	return m.tables.deleteChirps(map[uuid.UUID]bool{id: true})
+}
+
+func (m *Memory) DeleteAllChirps(ctx context.Context) error {
+	defer m.lock()()
+	ids := make(map[uuid.UUID]bool)
+	for id := range m.tables.chirps {
+		ids[id] = true
+	}
+	return m.tables.deleteChirps(ids)
+}
+
+func (m *Memory) DeleteUserChirps(ctx context.Context, userID uuid.UUID) error {
+	defer m.lock()()
+	ids := make(map[uuid.UUID]bool)
+	for _, chirp := range m.tables.chirps {
+		if chirp.UserID == userID {
+			ids[chirp.ID] = true
+		}
+	}
+	return m.tables.deleteChirps(ids)
+}
+
+// listChirps pages through the listed chirps that match.
+func (m *Memory) listChirps(match func(database.Chirp) bool, cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, desc bool, limit int32) []database.Chirp {
+	defer m.lock()()
+	chirps := values(m.tables.chirps, func(c database.Chirp) bool {
+		return m.tables.listed(c) && match(c)
+	})
+	return keysetPage(chirps, chirpKey, cursorCreatedAt, cursorID, desc, limit)
+}
+
+func byAuthor(authorID uuid.NullUUID) func(database.Chirp) bool {
+	return func(c database.Chirp) bool {
+		return !authorID.Valid || c.UserID == authorID.UUID
+	}
+}
+
+func (m *Memory) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	return m.listChirps(byAuthor(arg.AuthorID), arg.CursorCreatedAt, arg.CursorID, false, arg.PageLimit), nil
+}
+
+func (m *Memory) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	return m.listChirps(byAuthor(arg.AuthorID), arg.CursorCreatedAt, arg.CursorID, true, arg.PageLimit), nil
+}
+
+func (m *Memory) ListTimelineChirps(ctx context.Context, arg database.ListTimelineChirpsParams) ([]database.Chirp, error) {
+	return m.listChirps(func(c database.Chirp) bool {
+		if c.UserID == arg.UserID {
+			return true
+		}
+		_, following := m.tables.follows[idPair{arg.UserID, c.UserID}]
+		return following
+	}, arg.CursorCreatedAt, arg.CursorID, true, arg.PageLimit), nil
+}
+
+func (m *Memory) TombstoneChirp(ctx context.Context, chirpID uuid.UUID) error {
+	defer m.lock()()
+	m.tables.clearChirpBody(map[uuid.UUID]bool{chirpID: true})
+	update(m.tables.chirps, func(c database.Chirp) bool {
+		return c.ID == chirpID
+	}, func(c *database.Chirp) {
+		c.Body = ""
+		c.DeletedAt = sql.NullTime{Time: now(), Valid: true}
+		c.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (m *Memory) CountChirpReferences(ctx context.Context, chirpID uuid.UUID) (int64, error) {
+	defer m.lock()()
+	refersTo := func(ref uuid.NullUUID) bool { return ref.Valid && ref.UUID == chirpID }
+	return int64(len(values(m.tables.chirps, func(c database.Chirp) bool {
+		return refersTo(c.ParentID) || refersTo(c.RechirpOf) || refersTo(c.QuoteOf)
+	}))), nil
+}
+
+func (m *Memory) ListChirpReplies(ctx context.Context, arg database.ListChirpRepliesParams) ([]database.Chirp, error) {
+	defer m.lock()()
+	chirps := values(m.tables.chirps, func(c database.Chirp) bool {
+		return arg.ParentID.Valid && c.ParentID.Valid && c.ParentID.UUID == arg.ParentID.UUID
+	})
+	return keysetPage(chirps, chirpKey, arg.CursorCreatedAt, arg.CursorID, false, arg.PageLimit), nil
+}
+
+func (m *Memory) GetChirpThread(ctx context.Context, id uuid.UUID) ([]database.Chirp, error) {
+	defer m.lock()()
+	chirps := values(m.tables.chirps, func(c database.Chirp) bool {
+		return c.ID == id || (c.RootID.Valid && c.RootID.UUID == id)
+	})
+	sortRows(chirps, chirpKey, false)
+	return chirps, nil
+}
+
+func (m *Memory) AnonymizeReferencedChirps(ctx context.Context, arg database.AnonymizeReferencedChirpsParams) (int64, error) {
+	defer m.lock()()
+	referenced := make(map[uuid.UUID]bool)
+	for _, chirp := range m.tables.chirps {
+		if chirp.UserID == arg.UserID {
+			continue
+		}
+		for _, ref := range []uuid.NullUUID{chirp.ParentID, chirp.RootID, chirp.RechirpOf, chirp.QuoteOf} {
+			if ref.Valid {
+				referenced[ref.UUID] = true
+			}
+		}
+	}
+
+	moved := make(map[uuid.UUID]bool)
+	update(m.tables.chirps, func(c database.Chirp) bool {
+		return c.UserID == arg.UserID && referenced[c.ID]
+	}, func(c *database.Chirp) {
+		moved[c.ID] = true
+		c.UserID = arg.PlaceholderID
+		c.Body = ""
+		if !c.DeletedAt.Valid {
+			c.DeletedAt = sql.NullTime{Time: now(), Valid: true}
+		}
+		c.UpdatedAt = now()
+	})
+	m.tables.clearChirpBody(moved)
+	return int64(len(moved)), nil
+}
+
+func (m *Memory) EditChirp(ctx context.Context, arg database.EditChirpParams) (database.Chirp, error) {
+	defer m.lock()()
+	chirp, ok := m.tables.chirps[arg.ID]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+
+	revision := database.ChirpRevision{
+		ID:        uuid.New(),
+		ChirpID:   chirp.ID,
+		Body:      chirp.Body,
+		CreatedAt: now(),
+	}
+	m.tables.chirpRevisions[revision.ID] = revision
+
+	chirp.Body = arg.Body
+	chirp.UpdatedAt = now()
+	m.tables.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	defer m.lock()()
+	revisions := values(m.tables.chirpRevisions, func(r database.ChirpRevision) bool {
+		return r.ChirpID == chirpID
+	})
+	sortRows(revisions, func(r database.ChirpRevision) (time.Time, uuid.UUID) {
+		return r.CreatedAt, r.ID
+	}, true)
+	return revisions, nil
+}
+
+func (m *Memory) CreateRechirp(ctx context.Context, arg database.CreateRechirpParams) (database.Chirp, error) {
+	defer m.lock()()
+	if err := m.tables.checkUser(arg.UserID); err != nil {
+		return database.Chirp{}, err
+	}
+	if err := m.tables.checkChirps(arg.RechirpOf); err != nil {
+		return database.Chirp{}, err
+	}
+	for _, chirp := range m.tables.chirps {
+		if chirp.UserID == arg.UserID && arg.RechirpOf.Valid && chirp.RechirpOf == arg.RechirpOf {
+			return database.Chirp{}, sql.ErrNoRows
+		}
+	}
+
+	created := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: created,
+		UpdatedAt: created,
+		UserID:    arg.UserID,
+		RechirpOf: arg.RechirpOf,
+	}
+	m.tables.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) DeleteRechirp(ctx context.Context, arg database.DeleteRechirpParams) (int64, error) {
+	defer m.lock()()
+	ids := make(map[uuid.UUID]bool)
+	for _, chirp := range m.tables.chirps {
+		if chirp.UserID == arg.UserID && arg.RechirpOf.Valid && chirp.RechirpOf == arg.RechirpOf {
+			ids[chirp.ID] = true
+		}
+	}
+	if err := m.tables.deleteChirps(ids); err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
+func (m *Memory) GetChirpShareStats(ctx context.Context, arg database.GetChirpShareStatsParams) ([]database.GetChirpShareStatsRow, error) {
+	defer m.lock()()
+	var rows []database.GetChirpShareStatsRow
+	for _, id := range uniqueIDs(arg.ChirpIds) {
+		if _, ok := m.tables.chirps[id]; !ok {
+			continue
+		}
+		row := database.GetChirpShareStatsRow{ChirpID: id}
+		for _, share := range m.tables.chirps {
+			if share.DeletedAt.Valid {
+				continue
+			}
+			rechirp := share.RechirpOf.Valid && share.RechirpOf.UUID == id
+			if rechirp {
+				row.RechirpCount++
+				row.RechirpedByViewer = row.RechirpedByViewer || (arg.ViewerID.Valid && share.UserID == arg.ViewerID.UUID)
+			}
+			if share.QuoteOf.Valid && share.QuoteOf.UUID == id {
+				row.QuoteCount++
+			}
+		}
+		if row.RechirpCount > 0 || row.QuoteCount > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// uniqueIDs drops repeats, as = ANY() does.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	var unique []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			unique = append(unique, id)
+			seen[id] = true
+		}
+	}
+	return unique
+}
+
+func (m *Memory) LikeChirp(ctx context.Context, arg database.LikeChirpParams) error {
+	defer m.lock()()
+	if err := m.tables.checkUser(arg.UserID); err != nil {
+		return err
+	}
+	if err := m.tables.checkChirps(uuid.NullUUID{UUID: arg.ChirpID, Valid: true}); err != nil {
+		return err
+	}
+	key := idPair{arg.UserID, arg.ChirpID}
+	if _, ok := m.tables.chirpLikes[key]; !ok {
+		m.tables.chirpLikes[key] = database.ChirpLike{
+			UserID:    arg.UserID,
+			ChirpID:   arg.ChirpID,
+			CreatedAt: now(),
+		}
+	}
+	return nil
+}
+
+func (m *Memory) UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error {
+	defer m.lock()()
+	delete(m.tables.chirpLikes, idPair{arg.UserID, arg.ChirpID})
+	return nil
+}
+
+func (m *Memory) GetChirpLikeStats(ctx context.Context, arg database.GetChirpLikeStatsParams) ([]database.GetChirpLikeStatsRow, error) {
+	defer m.lock()()
+	var rows []database.GetChirpLikeStatsRow
+	for _, id := range uniqueIDs(arg.ChirpIds) {
+		row := database.GetChirpLikeStatsRow{ChirpID: id}
+		for _, like := range m.tables.chirpLikes {
+			if like.ChirpID == id {
+				row.LikeCount++
+				row.LikedByViewer = row.LikedByViewer || (arg.ViewerID.Valid && like.UserID == arg.ViewerID.UUID)
+			}
+		}
+		if row.LikeCount > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) ListChirpLikers(ctx context.Context, arg database.ListChirpLikersParams) ([]database.ListChirpLikersRow, error) {
+	defer m.lock()()
+	var rows []database.ListChirpLikersRow
+	for _, like := range m.tables.chirpLikes {
+		if like.ChirpID != arg.ChirpID {
+			continue
+		}
+		user := m.tables.users[like.UserID]
+		rows = append(rows, database.ListChirpLikersRow{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			IsChirpyRed: user.IsChirpyRed,
+			Username:    user.Username,
+			LikedAt:     like.CreatedAt,
+		})
+	}
+	return keysetPage(rows, func(row database.ListChirpLikersRow) (time.Time, uuid.UUID) {
+		return row.LikedAt, row.ID
+	}, arg.CursorCreatedAt, arg.CursorID, true, arg.PageLimit), nil
+}
+
+func (m *Memory) ListLikedChirps(ctx context.Context, arg database.ListLikedChirpsParams) ([]database.ListLikedChirpsRow, error) {
+	defer m.lock()()
+	var rows []database.ListLikedChirpsRow
+	for _, like := range m.tables.chirpLikes {
+		chirp, ok := m.tables.chirps[like.ChirpID]
+		if like.UserID != arg.UserID || !ok || chirp.DeletedAt.Valid {
+			continue
+		}
+		rows = append(rows, database.ListLikedChirpsRow{Chirp: chirp, LikedAt: like.CreatedAt})
+	}
+	return keysetPage(rows, func(row database.ListLikedChirpsRow) (time.Time, uuid.UUID) {
+		return row.LikedAt, row.Chirp.ID
+	}, arg.CursorCreatedAt, arg.CursorID, true, arg.PageLimit), nil
+}
+
+func (m *Memory) GetImportedChirpID(ctx context.Context, arg database.GetImportedChirpIDParams) (uuid.UUID, error) {
+	defer m.lock()()
+	imported, ok := m.tables.chirpImports[importKey{arg.UserID, arg.SourceID}]
+	if !ok {
+		return uuid.UUID{}, sql.ErrNoRows
+	}
+	return imported.ChirpID, nil
+}
+
+func (m *Memory) RecordChirpImport(ctx context.Context, arg database.RecordChirpImportParams) error {
+	defer m.lock()()
+	key := importKey{arg.UserID, arg.SourceID}
+	if _, ok := m.tables.chirpImports[key]; ok {
+		return &UniqueViolationError{Constraint: "chirp_imports_pkey"}
+	}
+	m.tables.chirpImports[key] = database.ChirpImport{
+		UserID:    arg.UserID,
+		SourceID:  arg.SourceID,
+		ChirpID:   arg.ChirpID,
+		CreatedAt: now(),
+	}
+	return nil
+}
+
+func (m *Memory) GetHeldImportID(ctx context.Context, arg database.GetHeldImportIDParams) (uuid.UUID, error) {
+	defer m.lock()()
+	for _, held := range m.tables.moderationQueue {
+		if held.UserID == arg.UserID && held.SourceID.Valid && held.SourceID.String == arg.SourceID {
+			return held.ID, nil
+		}
+	}
+	return uuid.UUID{}, sql.ErrNoRows
+}
+
+func (m *Memory) HoldChirp(ctx context.Context, arg database.HoldChirpParams) (database.ModerationQueue, error) {
+	defer m.lock()()
+	if err := m.tables.checkUser(arg.UserID); err != nil {
+		return database.ModerationQueue{}, err
+	}
+	if err := m.tables.checkChirps(arg.ChirpID, arg.ParentID, arg.QuoteOf); err != nil {
+		return database.ModerationQueue{}, err
+	}
+	for _, held := range m.tables.moderationQueue {
+		if arg.SourceID.Valid && held.UserID == arg.UserID && held.SourceID == arg.SourceID {
+			return database.ModerationQueue{}, &UniqueViolationError{Constraint: "idx_moderation_queue_source_id"}
+		}
+	}
+	held := database.ModerationQueue{
+		ID:              uuid.New(),
+		UserID:          arg.UserID,
+		ChirpID:         arg.ChirpID,
+		Body:            arg.Body,
+		ParentID:        arg.ParentID,
+		QuoteOf:         arg.QuoteOf,
+		Reason:          arg.Reason,
+		CreatedAt:       now(),
+		SourceID:        arg.SourceID,
+		SourceCreatedAt: arg.SourceCreatedAt,
+		SourceUpdatedAt: arg.SourceUpdatedAt,
+	}
+	m.tables.moderationQueue[held.ID] = held
+	return held, nil
+}
+
+func (m *Memory) ListHeldChirps(ctx context.Context, arg database.ListHeldChirpsParams) ([]database.ModerationQueue, error) {
+	defer m.lock()()
+	held := values(m.tables.moderationQueue, func(database.ModerationQueue) bool { return true })
+	return keysetPage(held, func(h database.ModerationQueue) (time.Time, uuid.UUID) {
+		return h.CreatedAt, h.ID
+	}, arg.CursorCreatedAt, arg.CursorID, false, arg.PageLimit), nil
+}
+
+func (m *Memory) GetHeldChirp(ctx context.Context, id uuid.UUID) (database.ModerationQueue, error) {
+	defer m.lock()()
+	held, ok := m.tables.moderationQueue[id]
+	if !ok {
+		return database.ModerationQueue{}, sql.ErrNoRows
+	}
+	return held, nil
+}
+
+func (m *Memory) DeleteHeldChirp(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	delete(m.tables.moderationQueue, id)
+	return nil
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// searchWords splits text into lowercase words the way the search handler splits queries.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsQuery is a parsed to_tsquery expression as the search handler writes them: terms joined by
+// &, each a word or a phrase of words joined by <->, where a word ending in :* is a prefix.
+type tsQuery [][]string
+
+func parseTSQuery(query string) tsQuery {
+	var q tsQuery
+	for _, term := range strings.Split(query, "&") {
+		term = strings.Trim(strings.TrimSpace(term), "()")
+		var phrase []string
+		for _, word := range strings.Split(term, "<->") {
+			phrase = append(phrase, strings.ToLower(strings.TrimSpace(word)))
+		}
+		q = append(q, phrase)
+	}
+	return q
+}
+
+func wordMatches(pattern, word string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, ":*"); ok {
+		return strings.HasPrefix(word, prefix)
+	}
+	return word == pattern
+}
+
+// phraseMatches reports whether words start with the phrase.
+func phraseMatches(phrase, words []string) bool {
+	for i, pattern := range phrase {
+		if !wordMatches(pattern, words[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// rank returns how well body matches the query, or false when it does not. Like ts_rank it
+// grows with the number of matches; unlike it there is no stemming or stop word list.
+func (q tsQuery) rank(body string) (float32, bool) {
+	words := searchWords(body)
+	var matches int
+	for _, phrase := range q {
+		found := 0
+		for start := 0; start+len(phrase) <= len(words); start++ {
+			if phraseMatches(phrase, words[start:]) {
+				found++
+			}
+		}
+		if found == 0 {
+			return 0, false
+		}
+		matches += found
+	}
+	return float32(matches) / float32(len(words)), true
+}
+
+// searchChirps finds live chirps matching the query within the search filters.
+func (m *Memory) searchChirps(query string, authorID uuid.NullUUID, since, until sql.NullTime) []database.SearchChirpsByRankRow {
+	defer m.lock()()
+	q := parseTSQuery(query)
+	var rows []database.SearchChirpsByRankRow
+	for _, chirp := range m.tables.chirps {
+		switch {
+		case chirp.DeletedAt.Valid,
+			authorID.Valid && chirp.UserID != authorID.UUID,
+			since.Valid && chirp.CreatedAt.Before(since.Time),
+			until.Valid && !chirp.CreatedAt.Before(until.Time):
+			continue
+		}
+		if rank, ok := q.rank(chirp.Body); ok {
+			rows = append(rows, database.SearchChirpsByRankRow{Chirp: chirp, Rank: rank})
+		}
+	}
+	return rows
+}
+
+func (m *Memory) SearchChirpsByRank(ctx context.Context, arg database.SearchChirpsByRankParams) ([]database.SearchChirpsByRankRow, error) {
+	rows := m.searchChirps(arg.Query, arg.AuthorID, arg.Since, arg.Until)
+	compare := func(a database.SearchChirpsByRankRow, rank float32, createdAt time.Time, id uuid.UUID) int {
+		if c := cmp.Compare(a.Rank, rank); c != 0 {
+			return c
+		}
+		return compareKeys(a.Chirp.CreatedAt, a.Chirp.ID, createdAt, id)
+	}
+	slices.SortFunc(rows, func(a, b database.SearchChirpsByRankRow) int {
+		return compare(b, a.Rank, a.Chirp.CreatedAt, a.Chirp.ID)
+	})
+	if arg.CursorRank.Valid {
+		rows = slices.DeleteFunc(rows, func(row database.SearchChirpsByRankRow) bool {
+			return compare(row, float32(arg.CursorRank.Float64), arg.CursorCreatedAt.Time, arg.CursorID.UUID) >= 0
+		})
+	}
+	if len(rows) > int(arg.PageLimit) {
+		rows = rows[:max(arg.PageLimit, 0)]
+	}
+	return rows, nil
+}
+
+func (m *Memory) SearchChirpsByDate(ctx context.Context, arg database.SearchChirpsByDateParams) ([]database.SearchChirpsByDateRow, error) {
+	rows := m.searchChirps(arg.Query, arg.AuthorID, arg.Since, arg.Until)
+	rows = keysetPage(rows, func(row database.SearchChirpsByRankRow) (time.Time, uuid.UUID) {
+		return row.Chirp.CreatedAt, row.Chirp.ID
+	}, arg.CursorCreatedAt, arg.CursorID, true, arg.PageLimit)
+
+	byDate := make([]database.SearchChirpsByDateRow, len(rows))
+	for i, row := range rows {
+		byDate[i] = database.SearchChirpsByDateRow(row)
+	}
+	return byDate, nil
+}
+
+func (m *Memory) SetChirpTags(ctx context.Context, arg database.SetChirpTagsParams) error {
+	defer m.lock()()
+	names := make(map[string]bool)
+	for _, name := range arg.Names {
+		names[name] = true
+	}
+	deleteRows(m.tables.chirpTags, func(ct database.ChirpTag) bool {
+		return ct.ChirpID == arg.ChirpID && !names[m.tables.tags[ct.TagID].Name]
+	})
+
+	tagIDs := make(map[string]uuid.UUID)
+	for _, tag := range m.tables.tags {
+		tagIDs[tag.Name] = tag.ID
+	}
+	for name := range names {
+		id, ok := tagIDs[name]
+		if !ok {
+			id = uuid.New()
+			m.tables.tags[id] = database.Tag{ID: id, Name: name, CreatedAt: now()}
+		}
+		key := idPair{arg.ChirpID, id}
+		if _, ok := m.tables.chirpTags[key]; !ok {
+			m.tables.chirpTags[key] = database.ChirpTag{ChirpID: arg.ChirpID, TagID: id, CreatedAt: now()}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ListHashtagChirps(ctx context.Context, arg database.ListHashtagChirpsParams) ([]database.Chirp, error) {
+	defer m.lock()()
+	var chirps []database.Chirp
+	for _, ct := range m.tables.chirpTags {
+		chirp := m.tables.chirps[ct.ChirpID]
+		if m.tables.tags[ct.TagID].Name == arg.Name && !chirp.DeletedAt.Valid {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return keysetPage(chirps, chirpKey, arg.CursorCreatedAt, arg.CursorID, true, arg.PageLimit), nil
+}
+
+func (m *Memory) ListTrendingHashtags(ctx context.Context, arg database.ListTrendingHashtagsParams) ([]database.ListTrendingHashtagsRow, error) {
+	defer m.lock()()
+	counts := make(map[string]int64)
+	for _, ct := range m.tables.chirpTags {
+		chirp := m.tables.chirps[ct.ChirpID]
+		if !chirp.CreatedAt.Before(arg.Since) && !chirp.DeletedAt.Valid {
+			counts[m.tables.tags[ct.TagID].Name]++
+		}
+	}
+
+	var rows []database.ListTrendingHashtagsRow
+	for name, count := range counts {
+		rows = append(rows, database.ListTrendingHashtagsRow{Name: name, ChirpCount: count})
+	}
+	slices.SortFunc(rows, func(a, b database.ListTrendingHashtagsRow) int {
+		if c := cmp.Compare(b.ChirpCount, a.ChirpCount); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(rows) > int(arg.RowLimit) {
+		rows = rows[:max(arg.RowLimit, 0)]
+	}
+	return rows, nil
+}
+
+func (m *Memory) SetChirpMentions(ctx context.Context, arg database.SetChirpMentionsParams) error {
+	defer m.lock()()
+	usernames := make(map[string]bool)
+	for _, username := range arg.Usernames {
+		usernames[username] = true
+	}
+	deleteRows(m.tables.chirpMentions, func(cm database.ChirpMention) bool {
+		return cm.ChirpID == arg.ChirpID && !usernames[strings.ToLower(m.tables.users[cm.UserID].Username)]
+	})
+
+	for _, user := range m.tables.users {
+		if !usernames[strings.ToLower(user.Username)] {
+			continue
+		}
+		key := idPair{arg.ChirpID, user.ID}
+		if _, ok := m.tables.chirpMentions[key]; !ok {
+			m.tables.chirpMentions[key] = database.ChirpMention{ChirpID: arg.ChirpID, UserID: user.ID, CreatedAt: now()}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetChirpMentions(ctx context.Context, chirpIds []uuid.UUID) ([]database.GetChirpMentionsRow, error) {
+	defer m.lock()()
+	ids := make(map[uuid.UUID]bool)
+	for _, id := range chirpIds {
+		ids[id] = true
+	}
+
+	var rows []database.GetChirpMentionsRow
+	for _, cm := range m.tables.chirpMentions {
+		if ids[cm.ChirpID] {
+			rows = append(rows, database.GetChirpMentionsRow{
+				ChirpID:  cm.ChirpID,
+				UserID:   cm.UserID,
+				Username: m.tables.users[cm.UserID].Username,
+			})
+		}
+	}
+	slices.SortFunc(rows, func(a, b database.GetChirpMentionsRow) int {
+		if c := strings.Compare(a.ChirpID.String(), b.ChirpID.String()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Username, b.Username)
+	})
+	return rows, nil
+}
+
+func (m *Memory) ListMentionChirps(ctx context.Context, arg database.ListMentionChirpsParams) ([]database.Chirp, error) {
+	defer m.lock()()
+	var chirps []database.Chirp
+	for _, cm := range m.tables.chirpMentions {
+		chirp := m.tables.chirps[cm.ChirpID]
+		if cm.UserID == arg.UserID && !chirp.DeletedAt.Valid {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return keysetPage(chirps, chirpKey, arg.CursorCreatedAt, arg.CursorID, true, arg.PageLimit), nil
+}
@@ -0,0 +1,442 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// checkUserUnique enforces the unique email and case-insensitive unique username.
+func (t *tables) checkUserUnique(id uuid.UUID, email, username string) error {
+	for _, user := range t.users {
+		if user.ID == id {
+			continue
+		}
+		if user.Email == email {
+			return &UniqueViolationError{Constraint: "users_email_key"}
+		}
+		if strings.EqualFold(user.Username, username) {
+			return &UniqueViolationError{Constraint: "idx_users_username"}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	defer m.lock()()
+	id := uuid.New()
+	username := arg.Username.String
+	if !arg.Username.Valid {
+		username = "user_" + strings.ReplaceAll(id.String(), "-", "")[:12]
+	}
+	if err := m.tables.checkUserUnique(id, arg.Email, username); err != nil {
+		return database.CreateUserRow{}, err
+	}
+
+	created := now()
+	m.tables.users[id] = database.User{
+		ID:             id,
+		CreatedAt:      created,
+		UpdatedAt:      created,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Username:       username,
+		Roles:          []string{},
+	}
+	return database.CreateUserRow{
+		ID:        id,
+		CreatedAt: created,
+		UpdatedAt: created,
+		Email:     arg.Email,
+		Username:  username,
+	}, nil
+}
+
+func (m *Memory) GetUsers(ctx context.Context) ([]database.GetUsersRow, error) {
+	defer m.lock()()
+	users := values(m.tables.users, func(database.User) bool { return true })
+	slices.SortFunc(users, func(a, b database.User) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+
+	rows := make([]database.GetUsersRow, len(users))
+	for i, user := range users {
+		rows[i] = database.GetUsersRow{
+			ID:            user.ID,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+			Email:         user.Email,
+			IsChirpyRed:   user.IsChirpyRed,
+			Username:      user.Username,
+			EmailVerified: user.EmailVerified,
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, id uuid.UUID) (database.GetUserRow, error) {
+	defer m.lock()()
+	user, ok := m.tables.users[id]
+	if !ok {
+		return database.GetUserRow{}, sql.ErrNoRows
+	}
+	return database.GetUserRow{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+		Roles:         user.Roles,
+		SuspendedAt:   user.SuspendedAt,
+	}, nil
+}
+
+func (m *Memory) AuthUser(ctx context.Context, email string) (database.User, error) {
+	defer m.lock()()
+	for _, user := range m.tables.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error) {
+	defer m.lock()()
+	user, ok := m.tables.users[arg.ID]
+	if !ok {
+		return database.UpdateUserRow{}, sql.ErrNoRows
+	}
+	if arg.Username.Valid {
+		user.Username = arg.Username.String
+	}
+	if err := m.tables.checkUserUnique(user.ID, arg.Email, user.Username); err != nil {
+		return database.UpdateUserRow{}, err
+	}
+
+	user.EmailVerified = user.EmailVerified && user.Email == arg.Email
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	user.UpdatedAt = now()
+	m.tables.users[user.ID] = user
+	return database.UpdateUserRow{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+	}, nil
+}
+
+// updateUser is the UPDATE users ... WHERE id = $1 most user queries are.
+func (m *Memory) updateUser(id uuid.UUID, match func(database.User) bool, change func(*database.User)) int64 {
+	defer m.lock()()
+	return update(m.tables.users, func(u database.User) bool {
+		return u.ID == id && match(u)
+	}, func(u *database.User) {
+		change(u)
+		u.UpdatedAt = now()
+	})
+}
+
+func anyUser(database.User) bool { return true }
+
+// notPlaceholder leaves out the placeholder account that owns deleted accounts' chirps.
+func notPlaceholder(u database.User) bool { return u.ID != uuid.Nil }
+
+func (m *Memory) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) error {
+	m.updateUser(id, anyUser, func(u *database.User) { u.IsChirpyRed = true })
+	return nil
+}
+
+func (m *Memory) MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error) {
+	return m.updateUser(arg.ID, func(u database.User) bool {
+		return u.Email == arg.Email
+	}, func(u *database.User) {
+		u.EmailVerified = true
+	}), nil
+}
+
+func (m *Memory) SetUserPassword(ctx context.Context, arg database.SetUserPasswordParams) error {
+	m.updateUser(arg.ID, anyUser, func(u *database.User) { u.HashedPassword = arg.HashedPassword })
+	return nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.ListUsersRow, error) {
+	defer m.lock()()
+	users := values(m.tables.users, notPlaceholder)
+	users = keysetPage(users, func(u database.User) (time.Time, uuid.UUID) {
+		return u.CreatedAt, u.ID
+	}, arg.CursorCreatedAt, arg.CursorID, false, arg.PageLimit)
+
+	rows := make([]database.ListUsersRow, len(users))
+	for i, user := range users {
+		rows[i] = database.ListUsersRow{
+			ID:            user.ID,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+			Email:         user.Email,
+			IsChirpyRed:   user.IsChirpyRed,
+			Username:      user.Username,
+			EmailVerified: user.EmailVerified,
+			Roles:         user.Roles,
+			SuspendedAt:   user.SuspendedAt,
+		}
+	}
+	return rows, nil
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	return m.updateUser(id, notPlaceholder, func(u *database.User) {
+		if !u.SuspendedAt.Valid {
+			u.SuspendedAt = sql.NullTime{Time: now(), Valid: true}
+		}
+	}), nil
+}
+
+func (m *Memory) UnsuspendUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	return m.updateUser(id, notPlaceholder, func(u *database.User) { u.SuspendedAt = sql.NullTime{} }), nil
+}
+
+func (m *Memory) ScheduleAccountDeletion(ctx context.Context, arg database.ScheduleAccountDeletionParams) error {
+	m.updateUser(arg.ID, anyUser, func(u *database.User) {
+		u.DeleteAfter = sql.NullTime{Time: arg.DeleteAfter.UTC(), Valid: true}
+	})
+	return nil
+}
+
+func (m *Memory) CancelAccountDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	return m.updateUser(id, func(u database.User) bool {
+		return u.DeleteAfter.Valid
+	}, func(u *database.User) {
+		u.DeleteAfter = sql.NullTime{}
+	}), nil
+}
+
+func (m *Memory) ListAccountsDueForDeletion(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	defer m.lock()()
+	users := values(m.tables.users, func(u database.User) bool {
+		return u.DeleteAfter.Valid && !u.DeleteAfter.Time.After(now)
+	})
+	slices.SortFunc(users, func(a, b database.User) int { return a.DeleteAfter.Time.Compare(b.DeleteAfter.Time) })
+
+	ids := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids, nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	defer m.lock()()
+	return m.tables.deleteUsers(map[uuid.UUID]bool{id: true})
+}
+
+func (m *Memory) DeleteAllUsers(ctx context.Context) error {
+	defer m.lock()()
+	ids := make(map[uuid.UUID]bool)
+	for id := range m.tables.users {
+		ids[id] = id != uuid.Nil
+	}
+	_, err := m.tables.deleteUsers(ids)
+	return err
+}
+
+func (m *Memory) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	defer m.lock()()
+	if err := m.tables.checkUser(arg.FollowerID); err != nil {
+		return err
+	}
+	if err := m.tables.checkUser(arg.FolloweeID); err != nil {
+		return err
+	}
+	key := idPair{arg.FollowerID, arg.FolloweeID}
+	if _, ok := m.tables.follows[key]; !ok {
+		m.tables.follows[key] = database.Follow{
+			FollowerID: arg.FollowerID,
+			FolloweeID: arg.FolloweeID,
+			CreatedAt:  now(),
+		}
+	}
+	return nil
+}
+
+func (m *Memory) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	defer m.lock()()
+	delete(m.tables.follows, idPair{arg.FollowerID, arg.FolloweeID})
+	return nil
+}
+
+// followPage lists the other side of a user's follows, newest follow first.
+func (m *Memory) followPage(match func(database.Follow) bool, other func(database.Follow) uuid.UUID, cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, limit int32) []database.ListFollowersRow {
+	defer m.lock()()
+	var rows []database.ListFollowersRow
+	for _, follow := range m.tables.follows {
+		if !match(follow) {
+			continue
+		}
+		user := m.tables.users[other(follow)]
+		rows = append(rows, database.ListFollowersRow{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			IsChirpyRed: user.IsChirpyRed,
+			Username:    user.Username,
+			FollowedAt:  follow.CreatedAt,
+		})
+	}
+	return keysetPage(rows, func(row database.ListFollowersRow) (time.Time, uuid.UUID) {
+		return row.FollowedAt, row.ID
+	}, cursorCreatedAt, cursorID, true, limit)
+}
+
+func (m *Memory) ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.ListFollowersRow, error) {
+	return m.followPage(func(f database.Follow) bool {
+		return f.FolloweeID == arg.UserID
+	}, func(f database.Follow) uuid.UUID {
+		return f.FollowerID
+	}, arg.CursorCreatedAt, arg.CursorID, arg.PageLimit), nil
+}
+
+func (m *Memory) ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.ListFollowingRow, error) {
+	rows := m.followPage(func(f database.Follow) bool {
+		return f.FollowerID == arg.UserID
+	}, func(f database.Follow) uuid.UUID {
+		return f.FolloweeID
+	}, arg.CursorCreatedAt, arg.CursorID, arg.PageLimit)
+
+	following := make([]database.ListFollowingRow, len(rows))
+	for i, row := range rows {
+		following[i] = database.ListFollowingRow(row)
+	}
+	return following, nil
+}
+
+func (m *Memory) RecordSubscriptionEvent(ctx context.Context, arg database.RecordSubscriptionEventParams) error {
+	defer m.lock()()
+	if _, ok := m.tables.users[arg.UserID]; !ok {
+		return nil
+	}
+	id := uuid.New()
+	m.tables.subscriptionEvents[id] = database.SubscriptionEvent{
+		ID:        id,
+		UserID:    arg.UserID,
+		Event:     arg.Event,
+		CreatedAt: now(),
+	}
+	return nil
+}
+
+func (m *Memory) ListSubscriptionEvents(ctx context.Context, userID uuid.UUID) ([]database.SubscriptionEvent, error) {
+	defer m.lock()()
+	events := values(m.tables.subscriptionEvents, func(e database.SubscriptionEvent) bool {
+		return e.UserID == userID
+	})
+	sortRows(events, func(e database.SubscriptionEvent) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	}, false)
+	return events, nil
+}
+
+func (m *Memory) CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error) {
+	defer m.lock()()
+	if err := m.tables.checkUser(userID); err != nil {
+		return database.DataExport{}, err
+	}
+	export := database.DataExport{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Status:    "pending",
+		CreatedAt: now(),
+	}
+	m.tables.dataExports[export.ID] = export
+	return export, nil
+}
+
+func (m *Memory) GetPendingDataExport(ctx context.Context, arg database.GetPendingDataExportParams) (database.DataExport, error) {
+	defer m.lock()()
+	exports := values(m.tables.dataExports, func(e database.DataExport) bool {
+		return e.UserID == arg.UserID && e.Status == "pending" && e.CreatedAt.After(arg.StartedAfter)
+	})
+	if len(exports) == 0 {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+	sortRows(exports, func(e database.DataExport) (time.Time, uuid.UUID) {
+		return e.CreatedAt, e.ID
+	}, true)
+	return exports[0], nil
+}
+
+func (m *Memory) GetDataExport(ctx context.Context, arg database.GetDataExportParams) (database.GetDataExportRow, error) {
+	defer m.lock()()
+	export, ok := m.tables.dataExports[arg.ID]
+	if !ok || export.UserID != arg.UserID {
+		return database.GetDataExportRow{}, sql.ErrNoRows
+	}
+	return database.GetDataExportRow{
+		ID:          export.ID,
+		UserID:      export.UserID,
+		Status:      export.Status,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+	}, nil
+}
+
+func (m *Memory) GetDataExportArchive(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	defer m.lock()()
+	export, ok := m.tables.dataExports[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return export.Archive, nil
+}
+
+func (m *Memory) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	defer m.lock()()
+	update(m.tables.dataExports, func(e database.DataExport) bool {
+		return e.ID == arg.ID
+	}, func(e *database.DataExport) {
+		e.Status = "ready"
+		e.Archive = arg.Archive
+		e.CompletedAt = sql.NullTime{Time: now(), Valid: true}
+		e.ExpiresAt = sql.NullTime{Time: arg.ExpiresAt.UTC(), Valid: true}
+	})
+	return nil
+}
+
+func (m *Memory) FailDataExport(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+	update(m.tables.dataExports, func(e database.DataExport) bool {
+		return e.ID == id
+	}, func(e *database.DataExport) {
+		e.Status = "failed"
+		e.CompletedAt = sql.NullTime{Time: now(), Valid: true}
+	})
+	return nil
+}
+
+func (m *Memory) FailStaleDataExports(ctx context.Context, startedBefore time.Time) error {
+	defer m.lock()()
+	update(m.tables.dataExports, func(e database.DataExport) bool {
+		return e.Status == "pending" && !e.CreatedAt.After(startedBefore)
+	}, func(e *database.DataExport) {
+		e.Status = "failed"
+		e.CompletedAt = sql.NullTime{Time: now(), Valid: true}
+	})
+	return nil
+}
+
+func (m *Memory) DeleteExpiredDataExports(ctx context.Context, now time.Time) error {
+	defer m.lock()()
+	deleteRows(m.tables.dataExports, func(e database.DataExport) bool {
+		return e.ExpiresAt.Valid && !e.ExpiresAt.Time.After(now)
+	})
+	return nil
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/ProjectEmu/chirpy/sql/schema"
+	sqliteschema "github.com/ProjectEmu/chirpy/sql/sqlite/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// NewPostgresMigrator runs the migrations of sql/schema, embedded in the binary, against a
+// Postgres database. Each run holds an advisory lock, so instances started together apply
+// them once and the rest wait for it.
+func NewPostgresMigrator(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.Migrations, goose.WithSessionLocker(locker))
+}
+
+// NewSQLiteMigrator runs the migrations of sql/sqlite/schema against a SQLite database opened
+// with OpenSQLite. SQLite has no advisory locks, but a SQLite database only has the one
+// instance in front of it.
+func NewSQLiteMigrator(db *sql.DB) (*goose.Provider, error) {
+	return goose.NewProvider(goose.DialectSQLite3, db, sqliteschema.Migrations)
+}
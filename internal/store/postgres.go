@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+)
+
+// Postgres runs the sqlc queries against a Postgres database.
+type Postgres struct {
+	*database.Queries
+	db *sql.DB
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{Queries: database.New(db), db: db}
+}
+
+func (s *Postgres) BeginTx(ctx context.Context) (Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Queries: s.Queries.WithTx(tx), tx: tx}, nil
+}
+
+// sqlTx is a transaction of a store on database/sql.
+type sqlTx struct {
+	*database.Queries
+	tx *sql.Tx
+}
+
+func (t *sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestSearchChirps(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		once := createChirp(t, s, database.CreateChirpParams{Body: "I like go and other languages", UserID: alice.ID})
+		twice := createChirp(t, s, database.CreateChirpParams{Body: "go go", UserID: bob.ID})
+		prefix := createChirp(t, s, database.CreateChirpParams{Body: "gophers everywhere", UserID: alice.ID})
+		createChirp(t, s, database.CreateChirpParams{Body: "nothing to see", UserID: alice.ID})
+		deleted := createChirp(t, s, database.CreateChirpParams{Body: "go away", UserID: alice.ID})
+		if err := s.TombstoneChirp(ctx, deleted.ID); err != nil {
+			t.Fatalf("TombstoneChirp: %v", err)
+		}
+
+		byRank, err := s.SearchChirpsByRank(ctx, database.SearchChirpsByRankParams{Query: "go", PageLimit: 10})
+		if err != nil {
+			t.Fatalf("SearchChirpsByRank: %v", err)
+		}
+		if len(byRank) != 2 || byRank[0].Chirp.ID != twice.ID || byRank[1].Chirp.ID != once.ID {
+			t.Fatalf("search for go by rank = %+v, want the chirp saying it twice first", byRank)
+		}
+		if byRank[0].Rank <= byRank[1].Rank {
+			t.Errorf("ranks = %v, %v, want them decreasing", byRank[0].Rank, byRank[1].Rank)
+		}
+
+		// The rank cursor picks up after the first result
+		page, err := s.SearchChirpsByRank(ctx, database.SearchChirpsByRankParams{
+			Query:           "go",
+			CursorRank:      sql.NullFloat64{Float64: float64(byRank[0].Rank), Valid: true},
+			CursorCreatedAt: sql.NullTime{Time: byRank[0].Chirp.CreatedAt, Valid: true},
+			CursorID:        nullID(byRank[0].Chirp.ID),
+			PageLimit:       10,
+		})
+		if err != nil || len(page) != 1 || page[0].Chirp.ID != once.ID {
+			t.Errorf("search after the first result = %+v, %v, want the other chirp", page, err)
+		}
+
+		tests := []struct {
+			name   string
+			params database.SearchChirpsByDateParams
+			want   []uuid.UUID
+		}{
+			{"prefix", database.SearchChirpsByDateParams{Query: "go:*"}, []uuid.UUID{prefix.ID, twice.ID, once.ID}},
+			{"author", database.SearchChirpsByDateParams{Query: "go:*", AuthorID: nullID(alice.ID)}, []uuid.UUID{prefix.ID, once.ID}},
+			{"phrase", database.SearchChirpsByDateParams{Query: "like <-> go"}, []uuid.UUID{once.ID}},
+			{"all terms", database.SearchChirpsByDateParams{Query: "go & languages"}, []uuid.UUID{once.ID}},
+			{"since", database.SearchChirpsByDateParams{Query: "go:*", Since: sql.NullTime{Time: prefix.CreatedAt, Valid: true}}, []uuid.UUID{prefix.ID}},
+			{"until", database.SearchChirpsByDateParams{Query: "go:*", Until: sql.NullTime{Time: twice.CreatedAt, Valid: true}}, []uuid.UUID{once.ID}},
+			{"cursor", database.SearchChirpsByDateParams{
+				Query:           "go:*",
+				CursorCreatedAt: sql.NullTime{Time: twice.CreatedAt, Valid: true},
+				CursorID:        nullID(twice.ID),
+			}, []uuid.UUID{once.ID}},
+			{"no match", database.SearchChirpsByDateParams{Query: "rust", Until: sql.NullTime{Time: time.Now(), Valid: true}}, nil},
+		}
+		for _, tt := range tests {
+			tt.params.PageLimit = 10
+			rows, err := s.SearchChirpsByDate(ctx, tt.params)
+			if err != nil {
+				t.Fatalf("SearchChirpsByDate(%s): %v", tt.name, err)
+			}
+			var got []uuid.UUID
+			for _, row := range rows {
+				got = append(got, row.Chirp.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("search by %s = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+}
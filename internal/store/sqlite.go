@@ -0,0 +1,275 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The SQLite version of every sqlc query, under the same name. They take the same arguments
+// in the same order, plus @now, and return the same columns.
+//
+//go:embed sqlite/*.sql
+var sqliteFiles embed.FS
+
+var sqliteQueries = loadSQLiteQueries()
+
+// sqliteOptions configure each connection the way the SQLite queries expect: foreign keys
+// enforced, times written in UTC in a layout that sorts in time order, and transactions that
+// take the write lock as they begin rather than failing when they first write.
+const sqliteOptions = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite&_timezone=UTC&_txlock=immediate"
+
+func init() {
+	sqlite.MustRegisterScalarFunction("gen_random_uuid", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+	// search_rank(body, query) ranks a chirp the way the memory store does, or is NULL when it
+	// does not match. query is a to_tsquery expression as the search handler writes them.
+	sqlite.MustRegisterDeterministicScalarFunction("search_rank", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		body, _ := args[0].(string)
+		query, _ := args[1].(string)
+		if rank, ok := parseTSQuery(query).rank(body); ok {
+			return float64(rank), nil
+		}
+		return nil, nil
+	})
+}
+
+type sqliteQuery struct {
+	text string
+	// script is set when the query takes more than one statement. Outside a transaction
+	// it gets one of its own, as Postgres does the same work in a single statement.
+	script bool
+}
+
+func loadSQLiteQueries() map[string]sqliteQuery {
+	files, err := fs.Glob(sqliteFiles, "sqlite/*.sql")
+	if err != nil {
+		panic(err)
+	}
+
+	queries := make(map[string]sqliteQuery)
+	for _, file := range files {
+		data, err := sqliteFiles.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		var name string
+		var lines []string
+		add := func() {
+			if name != "" {
+				text := strings.TrimSpace(strings.Join(lines, "\n"))
+				queries[name] = sqliteQuery{text: text, script: strings.Count(text, ";") > 1}
+			}
+			lines = nil
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if rest, ok := strings.CutPrefix(line, "-- name: "); ok {
+				add()
+				name, _, _ = strings.Cut(rest, " ")
+			} else if !strings.HasPrefix(line, "--") {
+				lines = append(lines, line)
+			}
+		}
+		add()
+	}
+	return queries
+}
+
+// checkSQLiteQueries makes sure every sqlc query has a SQLite version, so a query added to
+// sql/queries without one is caught when the store opens rather than when it is first run.
+func checkSQLiteQueries() error {
+	querier := reflect.TypeFor[database.Querier]()
+	for i := range querier.NumMethod() {
+		if name := querier.Method(i).Name; sqliteQueries[name].text == "" {
+			return fmt.Errorf("no SQLite version of query %s in internal/store/sqlite", name)
+		}
+	}
+	return nil
+}
+
+// OpenSQLite opens the SQLite database at dsn, a file name or file: URI, for NewSQLite.
+func OpenSQLite(dsn string) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", dsn+separator+sqliteOptions)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer anyway, and a single connection keeps :memory: one database.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// SQLite runs the sqlc queries against a SQLite database opened with OpenSQLite, swapping
+// each for its SQLite version.
+type SQLite struct {
+	*database.Queries
+	db *sql.DB
+}
+
+var _ Store = (*SQLite)(nil)
+
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	if err := checkSQLiteQueries(); err != nil {
+		return nil, err
+	}
+	return &SQLite{Queries: database.New(sqliteConn{db: db}), db: db}, nil
+}
+
+func (s *SQLite) BeginTx(ctx context.Context) (Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Queries: database.New(sqliteConn{db: s.db, tx: tx}), tx: tx}, nil
+}
+
+// EditChirp takes two statements that return a row, which sqliteConn cannot put in a
+// transaction of their own, so it gets one here.
+func (s *SQLite) EditChirp(ctx context.Context, arg database.EditChirpParams) (database.Chirp, error) {
+	return inSQLiteTx(ctx, s, func(tx Tx) (database.Chirp, error) {
+		return tx.EditChirp(ctx, arg)
+	})
+}
+
+// AnonymizeReferencedChirps is a script that returns a row, like EditChirp.
+func (s *SQLite) AnonymizeReferencedChirps(ctx context.Context, arg database.AnonymizeReferencedChirpsParams) (int64, error) {
+	return inSQLiteTx(ctx, s, func(tx Tx) (int64, error) {
+		return tx.AnonymizeReferencedChirps(ctx, arg)
+	})
+}
+
+func inSQLiteTx[T any](ctx context.Context, s *SQLite, query func(Tx) (T, error)) (T, error) {
+	var zero T
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		return zero, err
+	}
+	defer tx.Rollback()
+
+	result, err := query(tx)
+	if err != nil {
+		return zero, err
+	}
+	return result, tx.Commit()
+}
+
+// sqliteConn is the database.DBTX the sqlc queries of a SQLite store run on. tx is nil
+// outside a transaction.
+type sqliteConn struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (c sqliteConn) run() database.DBTX {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.db
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	q, args := sqliteArgs(query, args)
+	if !q.script || c.tx != nil {
+		return c.run().ExecContext(ctx, q.text, args...)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, q.text, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+func (c sqliteConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	q, _ := sqliteArgs(query, nil)
+	return c.run().PrepareContext(ctx, q.text)
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	q, args := sqliteArgs(query, args)
+	return c.run().QueryContext(ctx, q.text, args...)
+}
+
+func (c sqliteConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	q, args := sqliteArgs(query, args)
+	return c.run().QueryRowContext(ctx, q.text, args...)
+}
+
+// sqliteArgs looks up the SQLite version of a sqlc query by the name in its first line, and
+// adapts the arguments to it. Arrays are passed as JSON for json_each, and @now is the time
+// the query runs, which every NOW() of the Postgres version becomes.
+func sqliteArgs(query string, args []interface{}) (sqliteQuery, []interface{}) {
+	header, _, _ := strings.Cut(query, "\n")
+	name, _, _ := strings.Cut(strings.TrimPrefix(header, "-- name: "), " ")
+
+	sqliteArgs := make([]interface{}, 0, len(args)+1)
+	for _, arg := range args {
+		switch array := arg.(type) {
+		case *pq.StringArray:
+			arg = jsonArray([]string(*array))
+		case pq.GenericArray:
+			arg = jsonArray(array.A)
+		}
+		sqliteArgs = append(sqliteArgs, arg)
+	}
+	// TIMESTAMP keeps microseconds on Postgres, which is also all a page cursor carries
+	sqliteArgs = append(sqliteArgs, sql.Named("now", time.Now().Truncate(time.Microsecond)))
+	return sqliteQueries[name], sqliteArgs
+}
+
+// jsonArray encodes the strings or UUIDs of a pq.Array, which cannot fail.
+func jsonArray(elements interface{}) string {
+	if reflect.ValueOf(elements).Len() == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(elements)
+	return string(data)
+}
+
+// sqliteConstraint names the constraint behind a SQLite unique violation the way Postgres
+// would: SQLite reports the columns, or the index when it is over an expression.
+func sqliteConstraint(err *sqlite.Error) (string, bool) {
+	if err.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE && err.Code() != sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return "", false
+	}
+	_, detail, _ := strings.Cut(err.Error(), "UNIQUE constraint failed: ")
+	detail, _, _ = strings.Cut(detail, " (")
+	if index, ok := strings.CutPrefix(detail, "index "); ok {
+		return strings.Trim(index, "'"), true
+	}
+
+	var table string
+	var columns []string
+	for _, column := range strings.Split(detail, ", ") {
+		table, column, _ = strings.Cut(column, ".")
+		columns = append(columns, column)
+	}
+	if err.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return table + "_pkey", true
+	}
+	return table + "_" + strings.Join(columns, "_") + "_key", true
+}
@@ -0,0 +1,14 @@
+-- name: EditChirp :one
+INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+SELECT gen_random_uuid(), chirps.id, chirps.body, @now
+FROM chirps
+WHERE chirps.id = $1;
+UPDATE chirps
+SET body = $2, updated_at = @now
+WHERE chirps.id = $1
+RETURNING *;
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at DESC;
@@ -0,0 +1,121 @@
+-- name: CreateChirp :one
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, parent_id, root_id, quote_of)
+VALUES (
+gen_random_uuid(),
+$1,
+@now,
+@now,
+$2,
+$3,
+$4,
+$5
+)
+RETURNING *;
+
+-- name: GetChirps :many
+SELECT * FROM chirps
+ORDER BY created_at ASC;
+
+-- name: GetChirp :one
+SELECT * FROM chirps
+WHERE id = $1
+LIMIT 1;
+
+-- SQLite has no row locks. Transactions take the write lock as they begin, which holds off
+-- new references to the chirp all the same.
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+LIMIT 1;
+
+-- name: DeleteChirp :exec
+DELETE FROM chirps
+WHERE id = $1;
+
+-- name: GetChirpsByAuthor :many
+SELECT *
+FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListChirpsAsc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND ($1 IS NULL OR user_id = $1)
+AND ($2 IS NULL
+    OR (created_at, id) > ($2, $3))
+ORDER BY created_at ASC, id ASC
+LIMIT $4;
+
+-- name: ListChirpsDesc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND ($1 IS NULL OR user_id = $1)
+AND ($2 IS NULL
+    OR (created_at, id) < ($2, $3))
+ORDER BY created_at DESC, id DESC
+LIMIT $4;
+
+-- name: TombstoneChirp :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = $1;
+DELETE FROM chirp_tags
+WHERE chirp_id = $1;
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+UPDATE chirps
+SET body = '', deleted_at = @now, updated_at = @now
+WHERE id = $1;
+
+-- name: CountChirpReferences :one
+SELECT COUNT(*) FROM chirps
+WHERE parent_id = $1
+OR rechirp_of = $1
+OR quote_of = $1;
+
+-- name: ListChirpReplies :many
+SELECT *
+FROM chirps
+WHERE parent_id = $1
+AND ($2 IS NULL
+    OR (created_at, id) > ($2, $3))
+ORDER BY created_at ASC, id ASC
+LIMIT $4;
+
+-- name: GetChirpThread :many
+SELECT *
+FROM chirps
+WHERE id = $1 OR root_id = $1
+ORDER BY created_at ASC, id ASC;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id IN (SELECT value FROM json_each($1));
+
+-- The chirps this moves are the placeholder's chirps last updated @now, as every chirp moved by
+-- an earlier call was updated before it.
+-- name: AnonymizeReferencedChirps :one
+UPDATE chirps
+SET user_id = $1, body = '', deleted_at = COALESCE(deleted_at, @now), updated_at = @now
+WHERE user_id = $2
+AND EXISTS (
+    SELECT 1 FROM chirps c
+    WHERE c.user_id <> $2
+    AND (c.parent_id = chirps.id OR c.root_id = chirps.id OR c.rechirp_of = chirps.id OR c.quote_of = chirps.id)
+);
+DELETE FROM chirp_revisions
+WHERE chirp_id IN (SELECT id FROM chirps WHERE user_id = $1 AND updated_at = @now);
+DELETE FROM chirp_tags
+WHERE chirp_id IN (SELECT id FROM chirps WHERE user_id = $1 AND updated_at = @now);
+DELETE FROM chirp_mentions
+WHERE chirp_id IN (SELECT id FROM chirps WHERE user_id = $1 AND updated_at = @now);
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND updated_at = @now;
+
+-- name: DeleteUserChirps :exec
+DELETE FROM chirps
+WHERE user_id = $1;
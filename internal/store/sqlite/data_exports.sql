@@ -0,0 +1,37 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at)
+VALUES (gen_random_uuid(), $1, 'pending', @now)
+RETURNING *;
+
+-- name: GetPendingDataExport :one
+SELECT * FROM data_exports
+WHERE user_id = $1 AND status = 'pending' AND created_at > $2
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExport :one
+SELECT id, user_id, status, created_at, completed_at, expires_at FROM data_exports
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDataExportArchive :one
+SELECT archive FROM data_exports
+WHERE id = $1;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', archive = $2, completed_at = @now, expires_at = $3
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = @now
+WHERE id = $1;
+
+-- name: FailStaleDataExports :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = @now
+WHERE status = 'pending' AND created_at <= $1;
+
+-- name: DeleteExpiredDataExports :exec
+DELETE FROM data_exports
+WHERE expires_at <= $1;
@@ -0,0 +1,2 @@
+-- name: DeleteAllChirps :exec
+DELETE FROM chirps;
@@ -0,0 +1,10 @@
+-- name: CreateEmailToken :exec
+DELETE FROM email_tokens
+WHERE email_tokens.user_id = $2 AND email_tokens.purpose = $3;
+INSERT INTO email_tokens (token_hash, user_id, purpose, email, created_at, expires_at)
+VALUES ($1, $2, $3, $4, @now, $5);
+
+-- name: ConsumeEmailToken :one
+DELETE FROM email_tokens
+WHERE token_hash = $1 AND purpose = $2 AND expires_at > @now
+RETURNING user_id, email;
@@ -0,0 +1,40 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, @now)
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT users.id, users.created_at, users.is_chirpy_red, users.username, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = $1
+AND ($2 IS NULL
+    OR (follows.created_at, users.id) < ($2, $3))
+ORDER BY follows.created_at DESC, users.id DESC
+LIMIT $4;
+
+-- name: ListFollowing :many
+SELECT users.id, users.created_at, users.is_chirpy_red, users.username, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = $1
+AND ($2 IS NULL
+    OR (follows.created_at, users.id) < ($2, $3))
+ORDER BY follows.created_at DESC, users.id DESC
+LIMIT $4;
+
+-- name: ListTimelineChirps :many
+SELECT chirps.*
+FROM chirps
+WHERE chirps.deleted_at IS NULL
+AND (chirps.rechirp_of IS NULL OR chirps.rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND (chirps.user_id = $1
+    OR chirps.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1))
+AND ($2 IS NULL
+    OR (chirps.created_at, chirps.id) < ($2, $3))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4;
@@ -0,0 +1,37 @@
+-- name: SetChirpTags :exec
+DELETE FROM chirp_tags
+WHERE chirp_id = $1
+AND tag_id NOT IN (SELECT id FROM tags WHERE name IN (SELECT value FROM json_each($2)));
+INSERT INTO tags (id, name, created_at)
+SELECT gen_random_uuid(), value, @now
+FROM json_each($2)
+WHERE true
+ON CONFLICT (name) DO NOTHING;
+INSERT INTO chirp_tags (chirp_id, tag_id, created_at)
+SELECT $1, id, @now
+FROM tags
+WHERE name IN (SELECT value FROM json_each($2))
+ON CONFLICT (chirp_id, tag_id) DO NOTHING;
+
+-- name: ListHashtagChirps :many
+SELECT chirps.*
+FROM chirp_tags
+JOIN tags ON tags.id = chirp_tags.tag_id
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE tags.name = $1
+AND chirps.deleted_at IS NULL
+AND ($2 IS NULL
+    OR (chirps.created_at, chirps.id) < ($2, $3))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4;
+
+-- name: ListTrendingHashtags :many
+SELECT tags.name, COUNT(*) AS chirp_count
+FROM chirp_tags
+JOIN tags ON tags.id = chirp_tags.tag_id
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE chirps.created_at >= $1
+AND chirps.deleted_at IS NULL
+GROUP BY tags.name
+ORDER BY chirp_count DESC, tags.name ASC
+LIMIT $2;
@@ -0,0 +1,37 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, @now)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetChirpLikeStats :many
+SELECT chirp_id,
+    COUNT(*) AS like_count,
+    COALESCE(MAX(user_id = $1), false) AS liked_by_viewer
+FROM chirp_likes
+WHERE chirp_id IN (SELECT value FROM json_each($2))
+GROUP BY chirp_id;
+
+-- name: ListChirpLikers :many
+SELECT users.id, users.created_at, users.is_chirpy_red, users.username, chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN users ON users.id = chirp_likes.user_id
+WHERE chirp_likes.chirp_id = $1
+AND ($2 IS NULL
+    OR (chirp_likes.created_at, users.id) < ($2, $3))
+ORDER BY chirp_likes.created_at DESC, users.id DESC
+LIMIT $4;
+
+-- name: ListLikedChirps :many
+SELECT chirps.*, chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN chirps ON chirps.id = chirp_likes.chirp_id
+WHERE chirp_likes.user_id = $1
+AND chirps.deleted_at IS NULL
+AND ($2 IS NULL
+    OR (chirp_likes.created_at, chirps.id) < ($2, $3))
+ORDER BY chirp_likes.created_at DESC, chirps.id DESC
+LIMIT $4;
@@ -0,0 +1,23 @@
+-- name: GetLoginAttempts :one
+SELECT *
+FROM login_attempts
+WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (key, failures, last_failure)
+VALUES ($1, 1, $2)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure < $3 THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure = excluded.last_failure
+RETURNING *;
+
+-- name: ResetLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: DeleteStaleLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE last_failure < $1;
@@ -0,0 +1,27 @@
+-- name: SetChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1
+AND user_id NOT IN (SELECT id FROM users WHERE lower(username) IN (SELECT value FROM json_each($2)));
+INSERT INTO chirp_mentions (chirp_id, user_id, created_at)
+SELECT $1, users.id, @now
+FROM users
+WHERE lower(users.username) IN (SELECT value FROM json_each($2))
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: GetChirpMentions :many
+SELECT chirp_mentions.chirp_id, users.id AS user_id, users.username
+FROM chirp_mentions
+JOIN users ON users.id = chirp_mentions.user_id
+WHERE chirp_mentions.chirp_id IN (SELECT value FROM json_each($1))
+ORDER BY chirp_mentions.chirp_id, users.username;
+
+-- name: ListMentionChirps :many
+SELECT chirps.*
+FROM chirp_mentions
+JOIN chirps ON chirps.id = chirp_mentions.chirp_id
+WHERE chirp_mentions.user_id = $1
+AND chirps.deleted_at IS NULL
+AND ($2 IS NULL
+    OR (chirps.created_at, chirps.id) < ($2, $3))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4;
@@ -0,0 +1,33 @@
+-- name: HoldChirp :one
+INSERT INTO moderation_queue (id, user_id, chirp_id, body, parent_id, quote_of, reason, created_at, source_id, source_created_at, source_updated_at)
+VALUES (
+gen_random_uuid(),
+$1,
+$2,
+$3,
+$4,
+$5,
+$6,
+@now,
+$7,
+$8,
+$9
+)
+RETURNING *;
+
+-- name: ListHeldChirps :many
+SELECT *
+FROM moderation_queue
+WHERE ($1 IS NULL
+    OR (created_at, id) > ($1, $2))
+ORDER BY created_at ASC, id ASC
+LIMIT $3;
+
+-- name: GetHeldChirp :one
+SELECT * FROM moderation_queue
+WHERE id = $1
+LIMIT 1;
+
+-- name: DeleteHeldChirp :exec
+DELETE FROM moderation_queue
+WHERE id = $1;
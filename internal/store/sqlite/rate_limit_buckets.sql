@@ -0,0 +1,16 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES ($1, $2 - 1, true, $3)
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+        WHEN min($2, rate_limit_buckets.tokens + (unixepoch($3, 'subsec') - unixepoch(rate_limit_buckets.updated_at, 'subsec')) * $4) >= 1
+        THEN min($2, rate_limit_buckets.tokens + (unixepoch($3, 'subsec') - unixepoch(rate_limit_buckets.updated_at, 'subsec')) * $4) - 1
+        ELSE min($2, rate_limit_buckets.tokens + (unixepoch($3, 'subsec') - unixepoch(rate_limit_buckets.updated_at, 'subsec')) * $4)
+    END,
+    allowed = min($2, rate_limit_buckets.tokens + (unixepoch($3, 'subsec') - unixepoch(rate_limit_buckets.updated_at, 'subsec')) * $4) >= 1,
+    updated_at = $3
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
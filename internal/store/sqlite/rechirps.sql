@@ -0,0 +1,27 @@
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, rechirp_of)
+VALUES (
+gen_random_uuid(),
+'',
+@now,
+@now,
+$1,
+$2
+)
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
+RETURNING *;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2;
+
+-- name: GetChirpShareStats :many
+SELECT original.id AS chirp_id,
+    COUNT(*) FILTER (WHERE shares.rechirp_of = original.id) AS rechirp_count,
+    COUNT(*) FILTER (WHERE shares.quote_of = original.id) AS quote_count,
+    COALESCE(MAX(shares.rechirp_of = original.id AND shares.user_id = $1), false) AS rechirped_by_viewer
+FROM chirps original
+JOIN chirps shares ON shares.rechirp_of = original.id OR shares.quote_of = original.id
+WHERE original.id IN (SELECT value FROM json_each($2))
+AND shares.deleted_at IS NULL
+GROUP BY original.id;
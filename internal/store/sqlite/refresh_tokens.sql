@@ -0,0 +1,40 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+VALUES ($1, @now, @now, $2, $3, NULL, $4)
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at;
+
+-- name: GetRefreshToken :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
+FROM refresh_tokens
+WHERE token_hash = $1
+LIMIT 1;
+
+-- SQLite has no row locks. Transactions take the write lock as they begin, which serializes
+-- concurrent refreshes all the same.
+-- name: GetRefreshTokenForUpdate :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
+FROM refresh_tokens
+WHERE token_hash = $1
+LIMIT 1;
+
+-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET updated_at = @now, revoked_at = @now
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = @now, revoked_at = @now
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET updated_at = @now, revoked_at = @now, rotated_at = @now
+WHERE token_hash = $1;
+
+-- name: DeleteAllRefreshTokens :exec
+DELETE FROM refresh_tokens;
+
+-- name: DeleteUserRefreshTokens :exec
+DELETE FROM refresh_tokens
+WHERE user_id = $1;
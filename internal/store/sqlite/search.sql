@@ -0,0 +1,33 @@
+-- search_rank is registered by the store. It ranks a body against the to_tsquery expression
+-- the search handler writes, and is NULL when the body does not match.
+-- name: SearchChirpsByRank :many
+SELECT *
+FROM (
+    SELECT chirps.*, search_rank(chirps.body, $1) AS rank
+    FROM chirps
+    WHERE chirps.deleted_at IS NULL
+    AND ($2 IS NULL OR chirps.user_id = $2)
+    AND ($3 IS NULL OR chirps.created_at >= $3)
+    AND ($4 IS NULL OR chirps.created_at < $4)
+)
+WHERE rank IS NOT NULL
+AND ($5 IS NULL
+    OR (rank, created_at, id) < ($5, $6, $7))
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $8;
+
+-- name: SearchChirpsByDate :many
+SELECT *
+FROM (
+    SELECT chirps.*, search_rank(chirps.body, $1) AS rank
+    FROM chirps
+    WHERE chirps.deleted_at IS NULL
+    AND ($2 IS NULL OR chirps.user_id = $2)
+    AND ($3 IS NULL OR chirps.created_at >= $3)
+    AND ($4 IS NULL OR chirps.created_at < $4)
+)
+WHERE rank IS NOT NULL
+AND ($5 IS NULL
+    OR (created_at, id) < ($5, $6))
+ORDER BY created_at DESC, id DESC
+LIMIT $7;
@@ -0,0 +1,38 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_used_at)
+VALUES (
+gen_random_uuid(),
+$1,
+$2,
+$3,
+@now,
+@now
+)
+RETURNING *;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = @now
+WHERE id = $1;
+
+-- name: ListActiveSessions :many
+SELECT *
+FROM sessions
+WHERE user_id = $1
+AND EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE refresh_tokens.family_id = sessions.id
+    AND refresh_tokens.revoked_at IS NULL
+    AND refresh_tokens.expires_at > @now
+)
+ORDER BY last_used_at DESC, id DESC;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET updated_at = @now, revoked_at = @now
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllUserSessions :execrows
+UPDATE refresh_tokens
+SET updated_at = @now, revoked_at = @now
+WHERE user_id = $1 AND revoked_at IS NULL;
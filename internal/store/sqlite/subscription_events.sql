@@ -0,0 +1,10 @@
+-- name: RecordSubscriptionEvent :exec
+INSERT INTO subscription_events (id, user_id, event, created_at)
+SELECT gen_random_uuid(), id, $1, @now
+FROM users
+WHERE id = $2;
+
+-- name: ListSubscriptionEvents :many
+SELECT * FROM subscription_events
+WHERE user_id = $1
+ORDER BY created_at ASC, id ASC;
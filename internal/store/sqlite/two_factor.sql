@@ -0,0 +1,64 @@
+-- name: StartTOTPEnrolment :one
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES ($1, $2, @now)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = excluded.secret, created_at = @now, last_step = 0
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTOTPEnrolment :exec
+UPDATE user_totp
+SET confirmed_at = @now, last_step = $2
+WHERE user_id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_step = $2
+WHERE user_id = $1 AND last_step < $2;
+
+-- name: DisableTOTP :exec
+DELETE FROM recovery_codes
+WHERE recovery_codes.user_id = $1;
+DELETE FROM user_totp
+WHERE user_totp.user_id = $1;
+
+-- name: SetRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+SELECT gen_random_uuid(), $1, value, @now
+FROM json_each($2);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = @now
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CreateMFAChallenge :execrows
+DELETE FROM mfa_challenges
+WHERE mfa_challenges.user_id = $1 AND mfa_challenges.expires_at <= @now;
+INSERT INTO mfa_challenges (token_hash, user_id, expires_at)
+SELECT $2, $1, $3
+WHERE (
+    SELECT COUNT(*) FROM mfa_challenges
+    WHERE mfa_challenges.user_id = $1 AND mfa_challenges.expires_at > @now
+) < $4;
+
+-- name: AttemptMFAChallenge :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1 AND expires_at > @now AND attempts < $2
+RETURNING user_id;
+
+-- name: DeleteMFAChallenge :exec
+DELETE FROM mfa_challenges
+WHERE token_hash = $1;
+
+-- name: DeleteUserMFAChallenges :exec
+DELETE FROM mfa_challenges
+WHERE user_id = $1;
@@ -0,0 +1,91 @@
+-- Users who sign up without a username get a placeholder derived from their ID.
+-- name: CreateUser :one
+WITH new_user AS MATERIALIZED (
+    SELECT gen_random_uuid() AS id
+)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+SELECT
+id,
+@now,
+@now,
+$1,
+$2,
+COALESCE($3, 'user_' || substr(replace(id, '-', ''), 1, 12))
+FROM new_user
+RETURNING id, created_at, updated_at, email, username, email_verified;
+
+-- name: GetUsers :many
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified FROM users
+ORDER BY id;
+
+-- name: GetUser :one
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified, roles, suspended_at FROM users
+WHERE id = $1
+LIMIT 1;
+
+-- name: AuthUser :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, email_verified, roles, suspended_at, delete_after FROM users
+WHERE email = $1
+LIMIT 1;
+
+-- name: UpdateUser :one
+UPDATE users
+SET email = $1,
+    hashed_password = $2,
+    username = COALESCE($3, username),
+    email_verified = email_verified AND email = $1,
+    updated_at = @now
+WHERE id = $4
+RETURNING id, created_at, updated_at, email, username, email_verified;
+
+-- name: UpgradeUserToChirpyRed :exec
+UPDATE users
+SET is_chirpy_red = true, updated_at = @now
+WHERE id = $1;
+
+-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified = true, updated_at = @now
+WHERE id = $1 AND email = $2;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = @now
+WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified, roles, suspended_at
+FROM users
+WHERE id <> '00000000-0000-0000-0000-000000000000'
+AND ($1 IS NULL OR (created_at, id) > ($1, $2))
+ORDER BY created_at ASC, id ASC
+LIMIT $3;
+
+-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, @now), updated_at = @now
+WHERE id = $1 AND id <> '00000000-0000-0000-0000-000000000000';
+
+-- name: UnsuspendUser :execrows
+UPDATE users
+SET suspended_at = NULL, updated_at = @now
+WHERE id = $1 AND id <> '00000000-0000-0000-0000-000000000000';
+
+-- name: ScheduleAccountDeletion :exec
+UPDATE users
+SET delete_after = $1, updated_at = @now
+WHERE id = $2;
+
+-- name: CancelAccountDeletion :execrows
+UPDATE users
+SET delete_after = NULL, updated_at = @now
+WHERE id = $1 AND delete_after IS NOT NULL;
+
+-- name: ListAccountsDueForDeletion :many
+SELECT id FROM users
+WHERE delete_after <= $1
+ORDER BY delete_after;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
@@ -0,0 +1,56 @@
+// Package store is where the API keeps its data. Handlers depend on Store rather than on a
+// database, so the same code runs against Postgres or SQLite in production and in memory in tests.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// Store runs every query the API makes. Outside a transaction each call stands on its own.
+type Store interface {
+	database.Querier
+	// BeginTx starts a transaction. Its queries see each other's writes, and nobody else
+	// sees them until Commit.
+	BeginTx(ctx context.Context) (Tx, error)
+}
+
+// Tx is a transaction. Like *sql.Tx, Rollback after Commit returns sql.ErrTxDone, so a
+// deferred Rollback is safe.
+type Tx interface {
+	database.Querier
+	Commit() error
+	Rollback() error
+}
+
+// UniqueViolationError is returned by the memory store when a write would break a
+// unique constraint. Constraint carries the name Postgres gives that constraint.
+type UniqueViolationError struct {
+	Constraint string
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("duplicate key value violates unique constraint %q", e.Constraint)
+}
+
+// UniqueViolation reports which unique constraint, if any, rejected a write.
+func UniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint, true
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteConstraint(sqliteErr)
+	}
+	var uniqueErr *UniqueViolationError
+	if errors.As(err, &uniqueErr) {
+		return uniqueErr.Constraint, true
+	}
+	return "", false
+}
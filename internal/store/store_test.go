@@ -0,0 +1,346 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// eachStore runs test against every store that does not need a server, so they cannot drift
+// apart unnoticed.
+func eachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestSQLite(t))
+	})
+}
+
+// newTestSQLite opens a SQLite database in a temporary file and migrates it.
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	db, err := OpenSQLite(t.TempDir() + "/chirpy.db")
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := NewSQLiteMigrator(db)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+
+	s, err := NewSQLite(db)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	return s
+}
+
+func createUser(t *testing.T, q database.Querier, email, username string) database.CreateUserRow {
+	t.Helper()
+	user, err := q.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          email,
+		HashedPassword: "hash",
+		Username:       sql.NullString{String: username, Valid: username != ""},
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+func createChirp(t *testing.T, q database.Querier, params database.CreateChirpParams) database.Chirp {
+	t.Helper()
+	chirp, err := q.CreateChirp(context.Background(), params)
+	if err != nil {
+		t.Fatalf("CreateChirp(%q): %v", params.Body, err)
+	}
+	return chirp
+}
+
+func TestUserUniqueness(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "Alice")
+
+		got, err := s.GetUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("GetUser: %v", err)
+		}
+		if got.Email != "alice@example.com" || got.Username != "Alice" || got.IsChirpyRed || len(got.Roles) != 0 {
+			t.Errorf("GetUser = %+v", got)
+		}
+
+		tests := []struct {
+			name       string
+			email      string
+			username   string
+			constraint string
+		}{
+			{"email", "alice@example.com", "alice2", "users_email_key"},
+			{"username in another case", "other@example.com", "ALICE", "idx_users_username"},
+		}
+		for _, tt := range tests {
+			_, err := s.CreateUser(ctx, database.CreateUserParams{
+				Email:          tt.email,
+				HashedPassword: "hash",
+				Username:       sql.NullString{String: tt.username, Valid: true},
+			})
+			if constraint, ok := UniqueViolation(err); !ok || constraint != tt.constraint {
+				t.Errorf("duplicate %s: got error %v, want a violation of %s", tt.name, err, tt.constraint)
+			}
+		}
+
+		// Without a username one is made up from the ID
+		bob := createUser(t, s, "bob@example.com", "")
+		if want := placeholderUsername(bob.ID); bob.Username != want {
+			t.Errorf("generated username = %q, want %q", bob.Username, want)
+		}
+
+		if _, err := s.GetUser(ctx, uuid.New()); err != sql.ErrNoRows {
+			t.Errorf("GetUser of a missing user: got %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.AuthUser(ctx, "nobody@example.com"); err != sql.ErrNoRows {
+			t.Errorf("AuthUser of a missing email: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+// placeholderUsername is the username CreateUser makes up from the first 12 hex digits of the ID.
+func placeholderUsername(id uuid.UUID) string {
+	return fmt.Sprintf("user_%x", id[:6])
+}
+
+func TestForeignKeys(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		chirp := createChirp(t, s, database.CreateChirpParams{Body: "hello", UserID: alice.ID})
+		reply := createChirp(t, s, database.CreateChirpParams{
+			Body:     "hi",
+			UserID:   bob.ID,
+			ParentID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			RootID:   uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		})
+
+		if _, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New()}); err == nil {
+			t.Error("CreateChirp by a missing user succeeded")
+		}
+		if err := s.LikeChirp(ctx, database.LikeChirpParams{UserID: alice.ID, ChirpID: uuid.New()}); err == nil {
+			t.Error("LikeChirp of a missing chirp succeeded")
+		}
+		if err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: alice.ID, FolloweeID: uuid.New()}); err == nil {
+			t.Error("FollowUser of a missing user succeeded")
+		}
+
+		// A replied to chirp cannot go while the reply points at it
+		if err := s.DeleteChirp(ctx, chirp.ID); err == nil {
+			t.Error("DeleteChirp of a replied to chirp succeeded")
+		}
+		if n, err := s.CountChirpReferences(ctx, chirp.ID); err != nil || n != 1 {
+			t.Errorf("CountChirpReferences = %d, %v, want 1", n, err)
+		}
+
+		// Likes and follows go with the chirp or user they belong to
+		if err := s.LikeChirp(ctx, database.LikeChirpParams{UserID: alice.ID, ChirpID: reply.ID}); err != nil {
+			t.Fatalf("LikeChirp: %v", err)
+		}
+		if err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: alice.ID, FolloweeID: bob.ID}); err != nil {
+			t.Fatalf("FollowUser: %v", err)
+		}
+		if err := s.DeleteChirp(ctx, reply.ID); err != nil {
+			t.Fatalf("DeleteChirp: %v", err)
+		}
+		stats, err := s.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{ChirpIds: []uuid.UUID{reply.ID}})
+		if err != nil || len(stats) != 0 {
+			t.Errorf("likes of a deleted chirp = %v, %v, want none", stats, err)
+		}
+
+		// Users are only deleted once their chirps are
+		if _, err := s.DeleteUser(ctx, bob.ID); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+		following, err := s.ListFollowing(ctx, database.ListFollowingParams{UserID: alice.ID, PageLimit: 10})
+		if err != nil || len(following) != 0 {
+			t.Errorf("following a deleted user = %v, %v, want none", following, err)
+		}
+		if _, err := s.DeleteUser(ctx, alice.ID); err == nil {
+			t.Error("DeleteUser of a user with chirps succeeded")
+		}
+	})
+}
+
+func TestListChirpsKeyset(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+		bob := createUser(t, s, "bob@example.com", "bob")
+
+		var aliceChirps []database.Chirp
+		for i := range 5 {
+			aliceChirps = append(aliceChirps, createChirp(t, s, database.CreateChirpParams{Body: fmt.Sprint(i), UserID: alice.ID}))
+			createChirp(t, s, database.CreateChirpParams{Body: fmt.Sprint(i), UserID: bob.ID})
+		}
+
+		author := uuid.NullUUID{UUID: alice.ID, Valid: true}
+		var asc []database.Chirp
+		params := database.ListChirpsAscParams{AuthorID: author, PageLimit: 2}
+		for {
+			page, err := s.ListChirpsAsc(ctx, params)
+			if err != nil {
+				t.Fatalf("ListChirpsAsc: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			asc = append(asc, page...)
+			last := page[len(page)-1]
+			params.CursorCreatedAt = sql.NullTime{Time: last.CreatedAt, Valid: true}
+			params.CursorID = uuid.NullUUID{UUID: last.ID, Valid: true}
+		}
+		if len(asc) != len(aliceChirps) {
+			t.Fatalf("paged through %d chirps, want %d", len(asc), len(aliceChirps))
+		}
+		for i, chirp := range asc {
+			if chirp.ID != aliceChirps[i].ID {
+				t.Errorf("ascending chirp %d = %q, want %q", i, chirp.Body, aliceChirps[i].Body)
+			}
+		}
+
+		// A cursor from the middle picks up after it in either direction
+		middle := aliceChirps[2]
+		desc, err := s.ListChirpsDesc(ctx, database.ListChirpsDescParams{
+			AuthorID:        author,
+			CursorCreatedAt: sql.NullTime{Time: middle.CreatedAt, Valid: true},
+			CursorID:        uuid.NullUUID{UUID: middle.ID, Valid: true},
+			PageLimit:       10,
+		})
+		if err != nil {
+			t.Fatalf("ListChirpsDesc: %v", err)
+		}
+		if len(desc) != 2 || desc[0].ID != aliceChirps[1].ID || desc[1].ID != aliceChirps[0].ID {
+			t.Errorf("descending after the middle chirp = %v", chirpBodies(desc))
+		}
+
+		all, err := s.ListChirpsDesc(ctx, database.ListChirpsDescParams{PageLimit: 100})
+		if err != nil || len(all) != 10 {
+			t.Errorf("ListChirpsDesc of everyone = %d chirps, %v, want 10", len(all), err)
+		}
+	})
+}
+
+func chirpBodies(chirps []database.Chirp) []string {
+	bodies := make([]string, len(chirps))
+	for i, chirp := range chirps {
+		bodies[i] = chirp.Body
+	}
+	return bodies
+}
+
+func TestTransactions(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+
+		tx, err := s.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("BeginTx: %v", err)
+		}
+		committed := createUser(t, tx, "committed@example.com", "committed")
+		if _, err := tx.GetUser(ctx, committed.ID); err != nil {
+			t.Errorf("a transaction does not see its own write: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+		if err := tx.Rollback(); err != sql.ErrTxDone {
+			t.Errorf("Rollback after Commit = %v, want sql.ErrTxDone", err)
+		}
+		if _, err := s.GetUser(ctx, committed.ID); err != nil {
+			t.Errorf("committed user is missing: %v", err)
+		}
+
+		tx, err = s.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("BeginTx: %v", err)
+		}
+		rolledBack := createUser(t, tx, "rolled-back@example.com", "rolled_back")
+		if err := tx.UpgradeUserToChirpyRed(ctx, committed.ID); err != nil {
+			t.Fatalf("UpgradeUserToChirpyRed: %v", err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback: %v", err)
+		}
+		if _, err := s.GetUser(ctx, rolledBack.ID); err != sql.ErrNoRows {
+			t.Errorf("rolled back user: got %v, want sql.ErrNoRows", err)
+		}
+		if user, err := s.GetUser(ctx, committed.ID); err != nil || user.IsChirpyRed {
+			t.Errorf("rolled back upgrade stuck: %+v, %v", user, err)
+		}
+	})
+}
+
+func TestRefreshTokenFamilies(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice@example.com", "alice")
+
+		session, err := s.CreateSession(ctx, database.CreateSessionParams{UserID: alice.ID})
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		expires := time.Now().Add(time.Hour).UTC()
+		for _, hash := range []string{"first", "second", "third"} {
+			_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+				TokenHash: hash,
+				UserID:    alice.ID,
+				ExpiresAt: expires,
+				FamilyID:  session.ID,
+			})
+			if err != nil {
+				t.Fatalf("CreateRefreshToken: %v", err)
+			}
+		}
+
+		if err := s.RevokeRefreshToken(ctx, "first"); err != nil {
+			t.Fatalf("RevokeRefreshToken: %v", err)
+		}
+		first, err := s.GetRefreshToken(ctx, "first")
+		if err != nil || !first.RevokedAt.Valid {
+			t.Errorf("revoked token = %+v, %v", first, err)
+		}
+		if first.ExpiresAt.Sub(expires).Abs() > time.Microsecond {
+			t.Errorf("expires_at = %v, want %v", first.ExpiresAt, expires)
+		}
+		if first.RotatedAt.Valid {
+			t.Errorf("revoked token is marked rotated: %+v", first)
+		}
+
+		if err := s.RotateRefreshToken(ctx, "second"); err != nil {
+			t.Fatalf("RotateRefreshToken: %v", err)
+		}
+		second, err := s.GetRefreshTokenForUpdate(ctx, "second")
+		if err != nil || !second.RevokedAt.Valid || !second.RotatedAt.Valid {
+			t.Errorf("rotated token = %+v, %v", second, err)
+		}
+
+		revoked, err := s.RevokeRefreshTokenFamily(ctx, session.ID)
+		if err != nil || revoked != 1 {
+			t.Errorf("RevokeRefreshTokenFamily = %d, %v, want the 1 token still live", revoked, err)
+		}
+		if _, err := s.GetRefreshToken(ctx, "missing"); err != sql.ErrNoRows {
+			t.Errorf("GetRefreshToken of a missing token: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
@@ -10,9 +10,10 @@ import (
 	"time"
 
 	"github.com/ProjectEmu/chirpy/api/handlers"
-	"github.com/ProjectEmu/chirpy/internal/database"
+	"github.com/ProjectEmu/chirpy/internal/store"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
 )
 
 func main() {
@@ -21,20 +22,53 @@ func main() {
 		log.Fatalf("Failed to load environment variables: %v", err)
 	}
 
-	// Get database URL and platform from environment variables
+	// Get database driver and URL and platform from environment variables
+	dbDriver := os.Getenv("DB_DRIVER")
 	dbURL := os.Getenv("DB_URL")
 	platform := os.Getenv("PLATFORM")
 	JWTSecret := os.Getenv("JWTSECRET")
 
-	// Connect to the database
-	db, err := sql.Open("postgres", dbURL)
+	// Connect to the database and initialize the store the handlers run their queries against.
+	// DB_DRIVER is postgres (the default), or sqlite with DB_URL the path to the database file.
+	var db *sql.DB
+	var dataStore store.Store
+	var migrator *goose.Provider
+	var err error
+	switch dbDriver {
+	case "", "postgres":
+		db, err = sql.Open("postgres", dbURL)
+		if err == nil {
+			dataStore = store.NewPostgres(db)
+			migrator, err = store.NewPostgresMigrator(db)
+		}
+	case "sqlite":
+		db, err = store.OpenSQLite(dbURL)
+		if err == nil {
+			dataStore, err = store.NewSQLite(db)
+		}
+		if err == nil {
+			migrator, err = store.NewSQLiteMigrator(db)
+		}
+	default:
+		log.Fatalf("Unknown DB_DRIVER %q, use postgres or sqlite", dbDriver)
+	}
 	if err != nil {
 		log.Fatalf("Failed to connect to the database: %v", err)
 	}
 	defer db.Close()
 
-	// Initialize SQLC queries
-	dbQueries := database.New(db)
+	// chirpy migrate runs the embedded migrations instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), migrator, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Make sure the schema is not behind this build, migrating it first if DB_AUTO_MIGRATE is set
+	if err := checkSchema(context.Background(), migrator); err != nil {
+		log.Fatalf("Failed to check the database schema: %v", err)
+	}
 
 	// Setup the HTTP multiplexer
 	mux := http.NewServeMux()
@@ -58,7 +92,7 @@ func main() {
 	})
 
 	// Set up other API routes via handlers
-	handlers.SetupRoutes(mux, dbQueries, platform, JWTSecret)
+	handlers.SetupRoutes(mux, dataStore, platform, JWTSecret)
 
 	// Create the HTTP server
 	server := &http.Server{
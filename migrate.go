@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/pressly/goose/v3"
+)
+
+// runMigrate runs chirpy migrate: up applies every pending migration, down rolls back the
+// last one, redo rolls it back and applies it again, and status lists them all.
+func runMigrate(ctx context.Context, migrator *goose.Provider, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: chirpy migrate up|down|status|redo")
+	}
+
+	switch args[0] {
+	case "up":
+		results, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			log.Println(result)
+		}
+		version, err := migrator.GetDBVersion(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Database schema is at version %d", version)
+	case "down":
+		result, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		log.Println(result)
+	case "redo":
+		result, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		log.Println(result)
+		result, err = migrator.ApplyVersion(ctx, result.Source.Version, true)
+		if err != nil {
+			return err
+		}
+		log.Println(result)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "Pending"
+			if status.State == goose.StateApplied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %s\n", appliedAt, status.Source.Path)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down, status or redo", args[0])
+	}
+	return nil
+}
+
+// checkSchema refuses to start the server against a schema older than the binary. With
+// DB_AUTO_MIGRATE set the pending migrations are applied instead.
+func checkSchema(ctx context.Context, migrator *goose.Provider) error {
+	autoMigrate := false
+	if value := os.Getenv("DB_AUTO_MIGRATE"); value != "" {
+		var err error
+		autoMigrate, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("DB_AUTO_MIGRATE must be true or false, got %q", value)
+		}
+	}
+
+	pending, err := migrator.HasPending(ctx)
+	if err != nil {
+		return err
+	}
+	if !pending {
+		return nil
+	}
+	if !autoMigrate {
+		current, target, err := migrator.GetVersions(ctx)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("database schema is at version %d but this build needs %d, run chirpy migrate up or set DB_AUTO_MIGRATE=true", current, target)
+	}
+
+	results, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		log.Println(result)
+	}
+	return nil
+}
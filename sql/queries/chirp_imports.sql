@@ -0,0 +1,27 @@
+-- Like CreateChirp, but keeps the timestamps the chirp had where it came from.
+-- name: ImportChirp :one
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, parent_id, root_id, quote_of)
+VALUES (
+gen_random_uuid(),
+$1,
+$2,
+$3,
+$4,
+$5,
+$6,
+$7
+)
+RETURNING *;
+
+-- name: GetImportedChirpID :one
+SELECT chirp_id FROM chirp_imports
+WHERE user_id = $1 AND source_id = $2;
+
+-- An imported chirp still waiting in the moderation queue.
+-- name: GetHeldImportID :one
+SELECT id FROM moderation_queue
+WHERE user_id = sqlc.arg('user_id') AND source_id = sqlc.arg('source_id')::text;
+
+-- name: RecordChirpImport :exec
+INSERT INTO chirp_imports (user_id, source_id, chirp_id, created_at)
+VALUES ($1, $2, $3, NOW());
@@ -0,0 +1,18 @@
+-- Saves the current body as a revision and replaces it in a single statement.
+-- name: EditChirp :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, NOW()
+    FROM chirps
+    WHERE chirps.id = sqlc.arg('id')
+)
+UPDATE chirps
+SET body = sqlc.arg('body'), updated_at = NOW()
+WHERE chirps.id = sqlc.arg('id')
+RETURNING *;
+
+-- Prior bodies of a chirp, most recent first.
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at DESC;
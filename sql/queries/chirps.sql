@@ -1,13 +1,16 @@
 
 -- SQL Query to Create a Chirp in the Database
 -- name: CreateChirp :one
-INSERT INTO chirps (id, body, created_at, updated_at, user_id)
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, parent_id, root_id, quote_of)
 VALUES (
 gen_random_uuid(),
 $1,
 NOW(),
 NOW(),
-$2
+$2,
+$3,
+$4,
+$5
 )
 RETURNING *;
 
@@ -21,20 +24,124 @@ SELECT * FROM chirps
 WHERE id = $1
 LIMIT 1;
 
+-- Locks the chirp so nothing can reply to, rechirp or quote it until the transaction ends.
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+LIMIT 1
+FOR UPDATE;
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
 
 -- name: GetChirpsByAuthor :many
-SELECT id, body, created_at, updated_at, user_id
+SELECT *
 FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC;
 
 
--- name: GetChirpsWithFilterAndSort :many
-SELECT id, body, created_at, updated_at, user_id
+-- Keyset pagination over (created_at, id) so pages stay stable while new chirps arrive.
+-- name: ListChirpsAsc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
 FROM chirps
-WHERE ($1 = '00000000-0000-0000-0000-000000000000' OR user_id = $1::uuid)
-ORDER BY 
-created_at $2;
\ No newline at end of file
+WHERE deleted_at IS NULL
+AND (rechirp_of IS NULL OR rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Tombstones keep a deleted chirp's place in a thread so its replies are not orphaned.
+-- Earlier revisions, hashtags and mentions go with the body.
+-- name: TombstoneChirp :exec
+WITH revisions AS (
+    DELETE FROM chirp_revisions
+    WHERE chirp_id = $1
+),
+tags AS (
+    DELETE FROM chirp_tags
+    WHERE chirp_id = $1
+),
+mentions AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id = $1
+)
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- Replies, rechirps and quotes all need the chirp to stay around as a tombstone.
+-- name: CountChirpReferences :one
+SELECT COUNT(*) FROM chirps
+WHERE parent_id = sqlc.arg('chirp_id')::uuid
+OR rechirp_of = sqlc.arg('chirp_id')::uuid
+OR quote_of = sqlc.arg('chirp_id')::uuid;
+
+-- Direct replies to a chirp, oldest first.
+-- name: ListChirpReplies :many
+SELECT *
+FROM chirps
+WHERE parent_id = sqlc.arg('parent_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- The root chirp of a conversation together with every chirp in it.
+-- name: GetChirpThread :many
+SELECT *
+FROM chirps
+WHERE id = $1 OR root_id = $1
+ORDER BY created_at ASC, id ASC;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- A deleted account's chirps that other users still reply to, rechirp or quote become tombstones
+-- of the placeholder account. Moving a chirp can expose more of the account's chirps it refers
+-- to, so this is repeated until it moves none. Each of the account's chirps is looked up in the
+-- indexes on the reference columns rather than scanning every other user's chirps.
+-- name: AnonymizeReferencedChirps :one
+WITH moved AS (
+    UPDATE chirps
+    SET user_id = sqlc.arg('placeholder_id'), body = '', deleted_at = COALESCE(deleted_at, NOW()), updated_at = NOW()
+    WHERE user_id = sqlc.arg('user_id')
+    AND EXISTS (
+        SELECT 1 FROM chirps c
+        WHERE c.user_id <> sqlc.arg('user_id')
+        AND (c.parent_id = chirps.id OR c.root_id = chirps.id OR c.rechirp_of = chirps.id OR c.quote_of = chirps.id)
+    )
+    RETURNING id
+),
+revisions AS (
+    DELETE FROM chirp_revisions
+    WHERE chirp_id IN (SELECT id FROM moved)
+),
+tags AS (
+    DELETE FROM chirp_tags
+    WHERE chirp_id IN (SELECT id FROM moved)
+),
+mentions AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id IN (SELECT id FROM moved)
+)
+SELECT COUNT(*) FROM moved;
+
+-- name: DeleteUserChirps :exec
+DELETE FROM chirps
+WHERE user_id = $1;
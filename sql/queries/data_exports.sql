@@ -0,0 +1,41 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at)
+VALUES (gen_random_uuid(), $1, 'pending', NOW())
+RETURNING *;
+
+-- An export still being built is handed back instead of starting another. One started before
+-- started_after was cut off, by a restart most likely, and is left for the sweep.
+-- name: GetPendingDataExport :one
+SELECT * FROM data_exports
+WHERE user_id = $1 AND status = 'pending' AND created_at > sqlc.arg('started_after')::timestamp
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- The archive is left out, so polling an export does not load it.
+-- name: GetDataExport :one
+SELECT id, user_id, status, created_at, completed_at, expires_at FROM data_exports
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDataExportArchive :one
+SELECT archive FROM data_exports
+WHERE id = $1;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', archive = $2, completed_at = NOW(), expires_at = sqlc.arg('expires_at')::timestamp
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE id = $1;
+
+-- Exports whose build was cut off never finish, so they are failed for the user to start over.
+-- name: FailStaleDataExports :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE status = 'pending' AND created_at <= sqlc.arg('started_before')::timestamp;
+
+-- name: DeleteExpiredDataExports :exec
+DELETE FROM data_exports
+WHERE expires_at <= sqlc.arg('now')::timestamp;
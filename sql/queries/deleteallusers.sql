@@ -1,2 +1,4 @@
+-- The placeholder that owns deleted accounts' tombstones is kept.
 -- name: DeleteAllUsers :exec
-DELETE FROM users;
+DELETE FROM users
+WHERE id <> '00000000-0000-0000-0000-000000000000';
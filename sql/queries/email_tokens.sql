@@ -0,0 +1,14 @@
+-- Only the newest token for each purpose works, so earlier ones are removed.
+-- name: CreateEmailToken :exec
+WITH earlier AS (
+    DELETE FROM email_tokens
+    WHERE email_tokens.user_id = $2 AND email_tokens.purpose = $3
+)
+INSERT INTO email_tokens (token_hash, user_id, purpose, email, created_at, expires_at)
+VALUES ($1, $2, $3, $4, NOW(), $5);
+
+-- Deleting the token as it is read makes it single-use.
+-- name: ConsumeEmailToken :one
+DELETE FROM email_tokens
+WHERE token_hash = $1 AND purpose = $2 AND expires_at > NOW()
+RETURNING user_id, email;
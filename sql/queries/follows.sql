@@ -0,0 +1,43 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- Users following the given user, newest follow first.
+-- name: ListFollowers :many
+SELECT users.id, users.created_at, users.is_chirpy_red, users.username, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.follower_id
+WHERE follows.followee_id = sqlc.arg('user_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, users.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY follows.created_at DESC, users.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Users the given user follows, newest follow first.
+-- name: ListFollowing :many
+SELECT users.id, users.created_at, users.is_chirpy_red, users.username, follows.created_at AS followed_at
+FROM follows
+JOIN users ON users.id = follows.followee_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (follows.created_at, users.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY follows.created_at DESC, users.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Chirps by the user and everyone they follow, newest first.
+-- name: ListTimelineChirps :many
+SELECT chirps.*
+FROM chirps
+WHERE chirps.deleted_at IS NULL
+AND (chirps.rechirp_of IS NULL OR chirps.rechirp_of IN (SELECT id FROM chirps WHERE deleted_at IS NULL))
+AND (chirps.user_id = sqlc.arg('user_id')
+    OR chirps.user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id')))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
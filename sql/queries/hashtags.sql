@@ -0,0 +1,43 @@
+-- Replaces the tags on a chirp, creating any tag that is seen for the first time.
+-- name: SetChirpTags :exec
+WITH cleared AS (
+    DELETE FROM chirp_tags
+    WHERE chirp_id = sqlc.arg('chirp_id')::uuid
+    AND tag_id NOT IN (SELECT id FROM tags WHERE name = ANY(sqlc.arg('names')::text[]))
+),
+upserted AS (
+    INSERT INTO tags (id, name, created_at)
+    SELECT gen_random_uuid(), name, NOW()
+    FROM unnest(sqlc.arg('names')::text[]) AS name
+    ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+    RETURNING id
+)
+INSERT INTO chirp_tags (chirp_id, tag_id, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, id, NOW()
+FROM upserted
+ON CONFLICT (chirp_id, tag_id) DO NOTHING;
+
+-- Live chirps carrying a tag, newest first.
+-- name: ListHashtagChirps :many
+SELECT chirps.*
+FROM chirp_tags
+JOIN tags ON tags.id = chirp_tags.tag_id
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE tags.name = sqlc.arg('name')
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Tags ranked by how many live chirps used them since the start of the window.
+-- name: ListTrendingHashtags :many
+SELECT tags.name, COUNT(*) AS chirp_count
+FROM chirp_tags
+JOIN tags ON tags.id = chirp_tags.tag_id
+JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE chirps.created_at >= sqlc.arg('since')
+AND chirps.deleted_at IS NULL
+GROUP BY tags.name
+ORDER BY chirp_count DESC, tags.name ASC
+LIMIT sqlc.arg('row_limit');
@@ -0,0 +1,41 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- Like counts for a batch of chirps, plus whether the viewer liked each one.
+-- Chirps without likes are absent from the result.
+-- name: GetChirpLikeStats :many
+SELECT chirp_id,
+    COUNT(*) AS like_count,
+    COALESCE(BOOL_OR(user_id = sqlc.narg('viewer_id')::uuid), false)::boolean AS liked_by_viewer
+FROM chirp_likes
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+GROUP BY chirp_id;
+
+-- Users who liked a chirp, most recent like first.
+-- name: ListChirpLikers :many
+SELECT users.id, users.created_at, users.is_chirpy_red, users.username, chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN users ON users.id = chirp_likes.user_id
+WHERE chirp_likes.chirp_id = sqlc.arg('chirp_id')
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_likes.created_at, users.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirp_likes.created_at DESC, users.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Chirps a user liked, most recent like first.
+-- name: ListLikedChirps :many
+SELECT sqlc.embed(chirps), chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN chirps ON chirps.id = chirp_likes.chirp_id
+WHERE chirp_likes.user_id = sqlc.arg('user_id')
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_likes.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirp_likes.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
@@ -0,0 +1,24 @@
+-- name: GetLoginAttempts :one
+SELECT *
+FROM login_attempts
+WHERE key = $1;
+
+-- Counts a failure, starting over when the previous one fell outside the window.
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts (key, failures, last_failure)
+VALUES (sqlc.arg('key'), 1, sqlc.arg('last_failure'))
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure < sqlc.arg('window_start') THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure = EXCLUDED.last_failure
+RETURNING *;
+
+-- name: ResetLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: DeleteStaleLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE last_failure < $1;
@@ -0,0 +1,32 @@
+-- Replaces the users mentioned by a chirp. Handles that match no user are ignored.
+-- name: SetChirpMentions :exec
+WITH cleared AS (
+    DELETE FROM chirp_mentions
+    WHERE chirp_id = sqlc.arg('chirp_id')::uuid
+    AND user_id NOT IN (SELECT id FROM users WHERE lower(username) = ANY(sqlc.arg('usernames')::text[]))
+)
+INSERT INTO chirp_mentions (chirp_id, user_id, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, users.id, NOW()
+FROM users
+WHERE lower(users.username) = ANY(sqlc.arg('usernames')::text[])
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- Resolved mentions for a batch of chirps.
+-- name: GetChirpMentions :many
+SELECT chirp_mentions.chirp_id, users.id AS user_id, users.username
+FROM chirp_mentions
+JOIN users ON users.id = chirp_mentions.user_id
+WHERE chirp_mentions.chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_mentions.chirp_id, users.username;
+
+-- Live chirps mentioning a user, newest first.
+-- name: ListMentionChirps :many
+SELECT chirps.*
+FROM chirp_mentions
+JOIN chirps ON chirps.id = chirp_mentions.chirp_id
+WHERE chirp_mentions.user_id = sqlc.arg('user_id')
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
@@ -0,0 +1,37 @@
+-- Chirps held for review wait here until an admin approves or rejects them.
+-- chirp_id is set when the held body is an edit of an existing chirp, and the source columns
+-- when it is an imported chirp.
+-- name: HoldChirp :one
+INSERT INTO moderation_queue (id, user_id, chirp_id, body, parent_id, quote_of, reason, created_at, source_id, source_created_at, source_updated_at)
+VALUES (
+gen_random_uuid(),
+$1,
+$2,
+$3,
+$4,
+$5,
+$6,
+NOW(),
+$7,
+$8,
+$9
+)
+RETURNING *;
+
+-- Held chirps, oldest first.
+-- name: ListHeldChirps :many
+SELECT *
+FROM moderation_queue
+WHERE (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetHeldChirp :one
+SELECT * FROM moderation_queue
+WHERE id = $1
+LIMIT 1;
+
+-- name: DeleteHeldChirp :exec
+DELETE FROM moderation_queue
+WHERE id = $1;
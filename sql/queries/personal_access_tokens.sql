@@ -0,0 +1,34 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+VALUES (
+gen_random_uuid(),
+$1,
+$2,
+$3,
+$4,
+NOW(),
+$5
+)
+RETURNING *;
+
+-- Looks up an unexpired token of an active user and records that it was used, in one round trip.
+-- name: UsePersonalAccessToken :one
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE token_hash = $1 AND expires_at > NOW()
+AND user_id IN (SELECT id FROM users WHERE suspended_at IS NULL AND delete_after IS NULL)
+RETURNING *;
+
+-- name: ListPersonalAccessTokens :many
+SELECT *
+FROM personal_access_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: DeletePersonalAccessToken :execrows
+DELETE FROM personal_access_tokens
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteUserPersonalAccessTokens :exec
+DELETE FROM personal_access_tokens
+WHERE user_id = $1;
@@ -0,0 +1,18 @@
+-- Refills the bucket for the time since it was last touched, then takes a token if a whole
+-- one is left. Every SET expression sees the row as it was before the update.
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg('key'), sqlc.arg('capacity')::float8 - 1, true, sqlc.arg('now'))
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+        WHEN LEAST(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (sqlc.arg('now') - rate_limit_buckets.updated_at)) * sqlc.arg('refill_rate')::float8) >= 1
+        THEN LEAST(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (sqlc.arg('now') - rate_limit_buckets.updated_at)) * sqlc.arg('refill_rate')::float8) - 1
+        ELSE LEAST(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (sqlc.arg('now') - rate_limit_buckets.updated_at)) * sqlc.arg('refill_rate')::float8)
+    END,
+    allowed = LEAST(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (sqlc.arg('now') - rate_limit_buckets.updated_at)) * sqlc.arg('refill_rate')::float8) >= 1,
+    updated_at = sqlc.arg('now')
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
@@ -0,0 +1,30 @@
+-- Returns no row when the user has already rechirped the chirp.
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, rechirp_of)
+VALUES (
+gen_random_uuid(),
+'',
+NOW(),
+NOW(),
+$1,
+$2
+)
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
+RETURNING *;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2;
+
+-- Rechirp and quote counts for a batch of chirps, plus whether the viewer rechirped each one.
+-- Chirps that were never shared are absent from the result.
+-- name: GetChirpShareStats :many
+SELECT original.id AS chirp_id,
+    COUNT(*) FILTER (WHERE shares.rechirp_of = original.id) AS rechirp_count,
+    COUNT(*) FILTER (WHERE shares.quote_of = original.id) AS quote_count,
+    COALESCE(BOOL_OR(shares.rechirp_of = original.id AND shares.user_id = sqlc.narg('viewer_id')::uuid), false)::boolean AS rechirped_by_viewer
+FROM chirps original
+JOIN chirps shares ON shares.rechirp_of = original.id OR shares.quote_of = original.id
+WHERE original.id = ANY(sqlc.arg('chirp_ids')::uuid[])
+AND shares.deleted_at IS NULL
+GROUP BY original.id;
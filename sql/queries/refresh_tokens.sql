@@ -1,18 +1,43 @@
+-- Tokens issued at login start a new family; rotated tokens inherit their predecessor's.
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
-VALUES ($1, NOW(), NOW(), $2, $3, NULL)
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at;
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+VALUES ($1, NOW(), NOW(), $2, $3, NULL, $4)
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at;
 
 -- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
 FROM refresh_tokens
-WHERE token = $1
+WHERE token_hash = $1
 LIMIT 1;
 
+-- Locks the token so concurrent refreshes with it are serialized.
+-- name: GetRefreshTokenForUpdate :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at
+FROM refresh_tokens
+WHERE token_hash = $1
+LIMIT 1
+FOR UPDATE;
+
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- Revokes a token that has been replaced, so that seeing it again can be told apart from a
+-- token revoked by logging out.
+-- name: RotateRefreshToken :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), rotated_at = NOW()
+WHERE token_hash = $1;
 
 -- name: DeleteAllRefreshTokens :exec
-DELETE FROM refresh_tokens;
\ No newline at end of file
+DELETE FROM refresh_tokens;
+
+-- name: DeleteUserRefreshTokens :exec
+DELETE FROM refresh_tokens
+WHERE user_id = $1;
@@ -0,0 +1,28 @@
+-- Full-text search ordered by relevance; the cursor carries the rank of the last row.
+-- name: SearchChirpsByRank :many
+SELECT sqlc.embed(chirps), ts_rank(to_tsvector('english', chirps.body), query)::real AS rank
+FROM chirps, to_tsquery('english', sqlc.arg('query')) query
+WHERE to_tsvector('english', chirps.body) @@ query
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('since')::timestamp IS NULL OR chirps.created_at >= sqlc.narg('since')::timestamp)
+AND (sqlc.narg('until')::timestamp IS NULL OR chirps.created_at < sqlc.narg('until')::timestamp)
+AND (sqlc.narg('cursor_rank')::real IS NULL
+    OR (ts_rank(to_tsvector('english', chirps.body), query)::real, chirps.created_at, chirps.id)
+        < (sqlc.narg('cursor_rank')::real, sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- Full-text search ordered by recency.
+-- name: SearchChirpsByDate :many
+SELECT sqlc.embed(chirps), ts_rank(to_tsvector('english', chirps.body), query)::real AS rank
+FROM chirps, to_tsquery('english', sqlc.arg('query')) query
+WHERE to_tsvector('english', chirps.body) @@ query
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('since')::timestamp IS NULL OR chirps.created_at >= sqlc.narg('since')::timestamp)
+AND (sqlc.narg('until')::timestamp IS NULL OR chirps.created_at < sqlc.narg('until')::timestamp)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
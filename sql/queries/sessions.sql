@@ -0,0 +1,41 @@
+-- A session is a refresh token family, created at login.
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_used_at)
+VALUES (
+gen_random_uuid(),
+$1,
+$2,
+$3,
+NOW(),
+NOW()
+)
+RETURNING *;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- Sessions that still hold a usable refresh token, most recently used first.
+-- name: ListActiveSessions :many
+SELECT *
+FROM sessions
+WHERE user_id = $1
+AND EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE refresh_tokens.family_id = sessions.id
+    AND refresh_tokens.revoked_at IS NULL
+    AND refresh_tokens.expires_at > NOW()
+)
+ORDER BY last_used_at DESC, id DESC;
+
+-- The session row is kept so a rotated token presented later is still recognised as reuse.
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllUserSessions :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
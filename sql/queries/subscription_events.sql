@@ -0,0 +1,11 @@
+-- Users that do not exist are skipped, like the upgrade itself.
+-- name: RecordSubscriptionEvent :exec
+INSERT INTO subscription_events (id, user_id, event, created_at)
+SELECT gen_random_uuid(), id, sqlc.arg('event'), NOW()
+FROM users
+WHERE id = sqlc.arg('user_id');
+
+-- name: ListSubscriptionEvents :many
+SELECT * FROM subscription_events
+WHERE user_id = $1
+ORDER BY created_at ASC, id ASC;
@@ -0,0 +1,78 @@
+-- Starts or restarts an enrolment. Returns no row when two-factor authentication is already enabled.
+-- name: StartTOTPEnrolment :one
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = NOW(), last_step = 0
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTOTPEnrolment :exec
+UPDATE user_totp
+SET confirmed_at = NOW(), last_step = $2
+WHERE user_id = $1;
+
+-- Records a code's time step. No row is updated when that step or a later one was already used,
+-- so each code works once.
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_step = $2
+WHERE user_id = $1 AND last_step < $2;
+
+-- name: DisableTOTP :exec
+WITH codes AS (
+    DELETE FROM recovery_codes
+    WHERE recovery_codes.user_id = $1
+)
+DELETE FROM user_totp
+WHERE user_totp.user_id = $1;
+
+-- Replaces any earlier recovery codes.
+-- name: SetRecoveryCodes :exec
+WITH old AS (
+    DELETE FROM recovery_codes
+    WHERE user_id = sqlc.arg('user_id')
+)
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id'), code_hash, NOW()
+FROM unnest(sqlc.arg('code_hashes')::text[]) AS code_hash;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- Expired challenges of the same user are cleared out as new ones are made. No challenge is
+-- made while the user already has max_challenges live ones.
+-- name: CreateMFAChallenge :execrows
+WITH expired AS (
+    DELETE FROM mfa_challenges
+    WHERE mfa_challenges.user_id = sqlc.arg('user_id') AND mfa_challenges.expires_at <= NOW()
+)
+INSERT INTO mfa_challenges (token_hash, user_id, expires_at)
+SELECT sqlc.arg('token_hash')::text, sqlc.arg('user_id')::uuid, sqlc.arg('expires_at')::timestamp
+WHERE (
+    SELECT COUNT(*) FROM mfa_challenges
+    WHERE mfa_challenges.user_id = sqlc.arg('user_id') AND mfa_challenges.expires_at > NOW()
+) < sqlc.arg('max_challenges')::int;
+
+-- Counts an attempt against a live challenge. Returns no row once the challenge has
+-- expired or used up its attempts.
+-- name: AttemptMFAChallenge :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE token_hash = sqlc.arg('token_hash') AND expires_at > NOW() AND attempts < sqlc.arg('max_attempts')
+RETURNING user_id;
+
+-- name: DeleteMFAChallenge :exec
+DELETE FROM mfa_challenges
+WHERE token_hash = $1;
+
+-- name: DeleteUserMFAChallenges :exec
+DELETE FROM mfa_challenges
+WHERE user_id = $1;
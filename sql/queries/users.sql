@@ -1,35 +1,99 @@
+-- Users who sign up without a username get a placeholder derived from their ID.
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (
-gen_random_uuid(),
+WITH new_user AS (
+    SELECT gen_random_uuid() AS id
+)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+SELECT
+id,
 NOW(),
 NOW(),
-$1,
-$2
-)
-RETURNING id, created_at, updated_at, email;
+sqlc.arg('email'),
+sqlc.arg('hashed_password'),
+COALESCE(sqlc.narg('username')::text, 'user_' || left(replace(id::text, '-', ''), 12))
+FROM new_user
+RETURNING id, created_at, updated_at, email, username, email_verified;
 
 -- name: GetUsers :many
-SELECT id, created_at, updated_at, email, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified FROM users
 ORDER BY id;
 
 -- name: GetUser :one
-SELECT id, created_at, updated_at, email, is_chirpy_red FROM users 
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified, roles, suspended_at FROM users 
 WHERE id = $1
 LIMIT 1;
 
 -- name: AuthUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users 
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, email_verified, roles, suspended_at, delete_after FROM users 
 WHERE email = $1
 LIMIT 1;
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
-WHERE id = $1
-RETURNING id, created_at, updated_at, email;
+SET email = sqlc.arg('email'),
+    hashed_password = sqlc.arg('hashed_password'),
+    username = COALESCE(sqlc.narg('username')::text, username),
+    email_verified = email_verified AND email = sqlc.arg('email'),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING id, created_at, updated_at, email, username, email_verified;
 
 -- name: UpgradeUserToChirpyRed :exec
 UPDATE users
 SET is_chirpy_red = true, updated_at = NOW()
 WHERE id = $1;
+
+-- Only verifies the address the token was sent to, in case the email changed since.
+-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified = true, updated_at = NOW()
+WHERE id = $1 AND email = $2;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- Every user but the placeholder that owns deleted accounts' chirps, oldest account first, for
+-- administrators.
+-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, is_chirpy_red, username, email_verified, roles, suspended_at
+FROM users
+WHERE id <> '00000000-0000-0000-0000-000000000000'
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- The placeholder account of deleted users is never suspended.
+-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, NOW()), updated_at = NOW()
+WHERE id = $1 AND id <> '00000000-0000-0000-0000-000000000000';
+
+-- name: UnsuspendUser :execrows
+UPDATE users
+SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1 AND id <> '00000000-0000-0000-0000-000000000000';
+
+-- name: ScheduleAccountDeletion :exec
+UPDATE users
+SET delete_after = sqlc.arg('delete_after')::timestamp, updated_at = NOW()
+WHERE id = sqlc.arg('id');
+
+-- Logging in during the grace period keeps the account.
+-- name: CancelAccountDeletion :execrows
+UPDATE users
+SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NOT NULL;
+
+-- name: ListAccountsDueForDeletion :many
+SELECT id FROM users
+WHERE delete_after <= sqlc.arg('now')::timestamp
+ORDER BY delete_after;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
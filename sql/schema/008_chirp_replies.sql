@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN parent_id UUID REFERENCES chirps(id),
+ADD COLUMN root_id UUID REFERENCES chirps(id),
+ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_chirps_parent_id ON chirps (parent_id, created_at, id);
+CREATE INDEX idx_chirps_root_id ON chirps (root_id, created_at, id);
+
+-- +goose Down
+DROP INDEX idx_chirps_root_id;
+DROP INDEX idx_chirps_parent_id;
+
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN root_id,
+DROP COLUMN parent_id;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE chirp_likes (
+    user_id UUID NOT NULL,
+    chirp_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chirp_id),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_likes_chirp_created_at ON chirp_likes (chirp_id, created_at, user_id);
+CREATE INDEX idx_chirp_likes_user_created_at ON chirp_likes (user_id, created_at, chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_likes;
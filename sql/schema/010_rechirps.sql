@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN rechirp_of UUID REFERENCES chirps(id),
+ADD COLUMN quote_of UUID REFERENCES chirps(id);
+
+-- A user can rechirp a given chirp only once
+CREATE UNIQUE INDEX idx_chirps_rechirp_once ON chirps (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX idx_chirps_rechirp_of ON chirps (rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX idx_chirps_quote_of ON chirps (quote_of) WHERE quote_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_chirps_quote_of;
+DROP INDEX idx_chirps_rechirp_of;
+DROP INDEX idx_chirps_rechirp_once;
+
+ALTER TABLE chirps
+DROP COLUMN quote_of,
+DROP COLUMN rechirp_of;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Search matches an index over the body's tsvector, so no vector is stored or read back with
+-- every chirp.
+CREATE INDEX idx_chirps_search ON chirps USING GIN (to_tsvector('english', body));
+
+-- +goose Down
+DROP INDEX idx_chirps_search;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE tags (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE chirp_tags (
+    chirp_id UUID NOT NULL,
+    tag_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, tag_id),
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_tag
+        FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_tags_tag_id ON chirp_tags (tag_id, chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_tags;
+DROP TABLE tags;
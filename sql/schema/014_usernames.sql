@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN username TEXT;
+
+-- Existing accounts get a placeholder handle they can change later
+UPDATE users
+SET username = 'user_' || left(replace(id::text, '-', ''), 12);
+
+ALTER TABLE users
+ALTER COLUMN username SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_users_username ON users (lower(username));
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN username;
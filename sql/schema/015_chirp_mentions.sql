@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, user_id),
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_mentions_user_id ON chirp_mentions (user_id, chirp_id);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
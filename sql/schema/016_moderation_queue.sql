@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE moderation_queue (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    chirp_id UUID,
+    body TEXT NOT NULL,
+    parent_id UUID,
+    quote_of UUID,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_parent
+        FOREIGN KEY (parent_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_quote_of
+        FOREIGN KEY (quote_of) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_moderation_queue_created_at ON moderation_queue (created_at, id);
+
+-- +goose Down
+DROP TABLE moderation_queue;
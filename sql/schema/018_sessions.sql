@@ -0,0 +1,40 @@
+-- +goose Up
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- Each refresh token family is a session; existing ones have no client details
+INSERT INTO sessions (id, user_id, created_at, last_used_at)
+SELECT family_id, (array_agg(user_id))[1], MIN(created_at), MAX(updated_at)
+FROM refresh_tokens
+GROUP BY family_id;
+
+ALTER TABLE refresh_tokens
+ADD CONSTRAINT fk_session
+    FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+-- Only a SHA-256 of each refresh token is kept from now on
+UPDATE refresh_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- +goose Down
+-- Hashes cannot be turned back into tokens, so existing sessions stop working
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
+
+ALTER TABLE refresh_tokens
+DROP CONSTRAINT fk_session;
+
+DROP TABLE sessions;
@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT false;
+
+-- Single-use tokens mailed to a user. The address is kept so a token stops working
+-- once the user changes their email.
+CREATE TABLE email_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    purpose TEXT NOT NULL CHECK (purpose IN ('password_reset', 'verify_email')),
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_email_tokens_user_id ON email_tokens (user_id);
+
+-- +goose Down
+DROP TABLE email_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Failed logins per client IP ("ip:...") and per account ("account:...")
+CREATE TABLE login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_last_failure ON login_attempts (last_failure);
+
+-- +goose Down
+DROP TABLE login_attempts;
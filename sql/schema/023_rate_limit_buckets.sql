@@ -0,0 +1,14 @@
+-- +goose Up
+-- Token buckets for rate limiting. allowed records whether the request that last touched
+-- the bucket got a token, so a single upsert can both take the token and report the outcome.
+CREATE TABLE rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
+
+-- +goose Down
+DROP TABLE rate_limit_buckets;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Roles are granted directly in the database, for example:
+--   UPDATE users SET roles = '{admin}' WHERE email = 'you@example.com';
+ALTER TABLE users
+ADD COLUMN roles TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN suspended_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN suspended_at,
+DROP COLUMN roles;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN delete_after TIMESTAMP;
+
+-- Chirps of deleted accounts that others still reply to, rechirp or quote are handed to this
+-- placeholder as tombstones. Its password hash is well formed but no password matches it.
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username, suspended_at)
+VALUES (
+    '00000000-0000-0000-0000-000000000000',
+    NOW(),
+    NOW(),
+    'deleted-user@chirpy.invalid',
+    '$2a$10$.....................................................',
+    'user_000000000000',
+    NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- +goose Down
+-- The placeholder account stays, since tombstones may still belong to it
+ALTER TABLE users
+DROP COLUMN delete_after;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Chirpy Red changes as reported by Polka, so a user can see their subscription history.
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    event TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_subscription_events_user_id ON subscription_events (user_id, created_at);
+
+-- Archives of a user's data, built in the background and kept until they expire.
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    archive BYTEA,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports (user_id, created_at);
+
+-- +goose Down
+DROP TABLE data_exports;
+DROP TABLE subscription_events;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Maps the IDs chirps had where they were imported from to the chirps they became, so
+-- importing the same file twice does not duplicate them.
+CREATE TABLE chirp_imports (
+    user_id UUID NOT NULL,
+    source_id TEXT NOT NULL,
+    chirp_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, source_id),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE chirp_imports;
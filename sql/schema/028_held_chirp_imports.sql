@@ -0,0 +1,18 @@
+-- +goose Up
+-- Imported chirps held for review keep the ID they had where they came from, so importing
+-- them again is caught as a duplicate, and the timestamps they are published with once approved.
+ALTER TABLE moderation_queue
+    ADD COLUMN source_id TEXT,
+    ADD COLUMN source_created_at TIMESTAMP,
+    ADD COLUMN source_updated_at TIMESTAMP;
+
+CREATE UNIQUE INDEX idx_moderation_queue_source_id ON moderation_queue (user_id, source_id)
+    WHERE source_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_moderation_queue_source_id;
+
+ALTER TABLE moderation_queue
+    DROP COLUMN source_id,
+    DROP COLUMN source_created_at,
+    DROP COLUMN source_updated_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Only a token replaced by rotation coming back means it was copied; one revoked by logging
+-- out is just stale
+ALTER TABLE refresh_tokens
+ADD COLUMN rotated_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN rotated_at;
@@ -0,0 +1,9 @@
+// Package schema embeds the goose migrations of the Postgres schema.
+package schema
+
+import "embed"
+
+// Migrations holds the migration files, numbered in the order they apply.
+//
+//go:embed *.sql
+var Migrations embed.FS
@@ -0,0 +1,329 @@
+-- +goose Up
+-- The schema of sql/schema as of 027_chirp_imports, for SQLite. UUIDs are stored as text and
+-- timestamps as UTC text that sorts in time order, and arrays as Postgres array literals so they
+-- scan the same way.
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL DEFAULT 'unset',
+    is_chirpy_red BOOLEAN NOT NULL DEFAULT false,
+    username TEXT NOT NULL,
+    email_verified BOOLEAN NOT NULL DEFAULT false,
+    roles TEXT NOT NULL DEFAULT '{}',
+    suspended_at TIMESTAMP,
+    delete_after TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_users_username ON users (lower(username));
+
+CREATE TABLE chirps (
+    id TEXT PRIMARY KEY,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL,
+    parent_id TEXT REFERENCES chirps(id),
+    root_id TEXT REFERENCES chirps(id),
+    deleted_at TIMESTAMP,
+    rechirp_of TEXT REFERENCES chirps(id),
+    quote_of TEXT REFERENCES chirps(id),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_chirps_created_at_id ON chirps (created_at, id);
+CREATE INDEX idx_chirps_user_id_created_at_id ON chirps (user_id, created_at, id);
+CREATE INDEX idx_chirps_parent_id ON chirps (parent_id, created_at, id);
+CREATE INDEX idx_chirps_root_id ON chirps (root_id, created_at, id);
+
+-- A user can rechirp a given chirp only once
+CREATE UNIQUE INDEX idx_chirps_rechirp_once ON chirps (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX idx_chirps_rechirp_of ON chirps (rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX idx_chirps_quote_of ON chirps (quote_of) WHERE quote_of IS NOT NULL;
+
+CREATE TABLE follows (
+    follower_id TEXT NOT NULL,
+    followee_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT fk_follower
+        FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_followee
+        FOREIGN KEY (followee_id) REFERENCES users(id) ON DELETE CASCADE,
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX idx_follows_follower_created_at ON follows (follower_id, created_at, followee_id);
+CREATE INDEX idx_follows_followee_created_at ON follows (followee_id, created_at, follower_id);
+
+CREATE TABLE chirp_likes (
+    user_id TEXT NOT NULL,
+    chirp_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (user_id, chirp_id),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_likes_chirp_created_at ON chirp_likes (chirp_id, created_at, user_id);
+CREATE INDEX idx_chirp_likes_user_created_at ON chirp_likes (user_id, created_at, chirp_id);
+
+CREATE TABLE chirp_revisions (
+    id TEXT PRIMARY KEY,
+    chirp_id TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_revisions_chirp_id ON chirp_revisions (chirp_id, created_at);
+
+CREATE TABLE tags (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE chirp_tags (
+    chirp_id TEXT NOT NULL,
+    tag_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (chirp_id, tag_id),
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_tag
+        FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_tags_tag_id ON chirp_tags (tag_id, chirp_id);
+
+CREATE TABLE chirp_mentions (
+    chirp_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (chirp_id, user_id),
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_chirp_mentions_user_id ON chirp_mentions (user_id, chirp_id);
+
+CREATE TABLE moderation_queue (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    chirp_id TEXT,
+    body TEXT NOT NULL,
+    parent_id TEXT,
+    quote_of TEXT,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_parent
+        FOREIGN KEY (parent_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_quote_of
+        FOREIGN KEY (quote_of) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_moderation_queue_created_at ON moderation_queue (created_at, id);
+
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    last_used_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- SQLite does not allow CHECK (expires_at > NOW()), as the result would change over time
+CREATE TABLE refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    user_id TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    family_id TEXT NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_session
+        FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_id ON refresh_tokens (user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE TABLE personal_access_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+
+-- A row without confirmed_at is an enrolment the user has not finished yet
+CREATE TABLE user_totp (
+    user_id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    confirmed_at TIMESTAMP,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    used_at TIMESTAMP,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE mfa_challenges (
+    token_hash TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges (user_id);
+
+-- Single-use tokens mailed to a user. The address is kept so a token stops working
+-- once the user changes their email.
+CREATE TABLE email_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    purpose TEXT NOT NULL CHECK (purpose IN ('password_reset', 'verify_email')),
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_email_tokens_user_id ON email_tokens (user_id);
+
+-- Failed logins per client IP ("ip:...") and per account ("account:...")
+CREATE TABLE login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_last_failure ON login_attempts (last_failure);
+
+-- Token buckets for rate limiting. allowed records whether the request that last touched
+-- the bucket got a token, so a single upsert can both take the token and report the outcome.
+CREATE TABLE rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens REAL NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
+
+-- Chirpy Red changes as reported by Polka, so a user can see their subscription history.
+CREATE TABLE subscription_events (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_subscription_events_user_id ON subscription_events (user_id, created_at);
+
+-- Archives of a user's data, built in the background and kept until they expire.
+CREATE TABLE data_exports (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    archive BLOB,
+    created_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports (user_id, created_at);
+
+-- Maps the IDs chirps had where they were imported from to the chirps they became, so
+-- importing the same file twice does not duplicate them.
+CREATE TABLE chirp_imports (
+    user_id TEXT NOT NULL,
+    source_id TEXT NOT NULL,
+    chirp_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, source_id),
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+-- Chirps of deleted accounts that others still reply to, rechirp or quote are handed to this
+-- placeholder as tombstones. Its password hash is well formed but no password matches it.
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username, suspended_at)
+VALUES (
+    '00000000-0000-0000-0000-000000000000',
+    strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+    'deleted-user@chirpy.invalid',
+    '$2a$10$.....................................................',
+    'user_000000000000',
+    strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')
+);
+
+-- +goose Down
+DROP TABLE chirp_imports;
+DROP TABLE data_exports;
+DROP TABLE subscription_events;
+DROP TABLE rate_limit_buckets;
+DROP TABLE login_attempts;
+DROP TABLE email_tokens;
+DROP TABLE mfa_challenges;
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
+DROP TABLE personal_access_tokens;
+DROP TABLE refresh_tokens;
+DROP TABLE sessions;
+DROP TABLE moderation_queue;
+DROP TABLE chirp_mentions;
+DROP TABLE chirp_tags;
+DROP TABLE tags;
+DROP TABLE chirp_revisions;
+DROP TABLE chirp_likes;
+DROP TABLE follows;
+DROP TABLE chirps;
+DROP TABLE users;
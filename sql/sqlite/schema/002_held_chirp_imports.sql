@@ -0,0 +1,15 @@
+-- +goose Up
+-- sql/schema/028_held_chirp_imports.sql, for SQLite.
+ALTER TABLE moderation_queue ADD COLUMN source_id TEXT;
+ALTER TABLE moderation_queue ADD COLUMN source_created_at TIMESTAMP;
+ALTER TABLE moderation_queue ADD COLUMN source_updated_at TIMESTAMP;
+
+CREATE UNIQUE INDEX idx_moderation_queue_source_id ON moderation_queue (user_id, source_id)
+    WHERE source_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_moderation_queue_source_id;
+
+ALTER TABLE moderation_queue DROP COLUMN source_updated_at;
+ALTER TABLE moderation_queue DROP COLUMN source_created_at;
+ALTER TABLE moderation_queue DROP COLUMN source_id;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- sql/schema/029_refresh_token_rotation.sql, for SQLite.
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN rotated_at;
@@ -0,0 +1,10 @@
+// Package schema embeds the goose migrations of the SQLite schema, the Postgres schema
+// translated and squashed into its final shape.
+package schema
+
+import "embed"
+
+// Migrations holds the migration files, numbered in the order they apply.
+//
+//go:embed *.sql
+var Migrations embed.FS